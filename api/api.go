@@ -3,6 +3,9 @@ package api
 import (
 	v1 "github.com/TemurMannonov/blog/api/v1"
 	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/pkg/rbac"
+	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/TemurMannonov/blog/storage"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,9 +17,12 @@ import (
 )
 
 type RouterOptions struct {
-	Cfg      *config.Config
-	Storage  storage.StorageI
-	InMemory storage.InMemoryStorageI
+	Cfg            *config.Config
+	Storage        storage.StorageI
+	InMemory       storage.InMemoryStorageI
+	EmailSender    email.Sender
+	PasswordPolicy *utils.PasswordPolicy
+	KeyRing        *utils.KeyRing
 }
 
 // @title           Swagger for blog api
@@ -27,9 +33,14 @@ type RouterOptions struct {
 // @in header
 // @name Authorization
 // @Security ApiKeyAuth
-func New(opt *RouterOptions) *gin.Engine {
+func New(opt *RouterOptions) (*gin.Engine, error) {
 	router := gin.Default()
 
+	err := router.SetTrustedProxies(opt.Cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
 	corsConfig.AllowCredentials = true
@@ -37,46 +48,94 @@ func New(opt *RouterOptions) *gin.Engine {
 	router.Use(cors.New(corsConfig))
 
 	handlerV1 := v1.New(&v1.HandlerV1Options{
-		Cfg:      opt.Cfg,
-		Storage:  opt.Storage,
-		InMemory: opt.InMemory,
+		Cfg:            opt.Cfg,
+		Storage:        opt.Storage,
+		InMemory:       opt.InMemory,
+		EmailSender:    opt.EmailSender,
+		PasswordPolicy: opt.PasswordPolicy,
+		KeyRing:        opt.KeyRing,
 	})
 
 	router.Static("/media", "./media")
+	router.GET("/.well-known/jwks.json", handlerV1.GetJWKS)
 
-	apiV1 := router.Group("/v1")
+	limits := opt.Cfg.RateLimits
+	apiV1 := router.Group("/v1", handlerV1.RateLimitMiddleware("default", limits.Default))
 
 	apiV1.GET("/users/:id", handlerV1.GetUser)
-	apiV1.POST("/users", handlerV1.AuthMiddleware, handlerV1.CreateUser)
+	apiV1.POST("/users", handlerV1.AuthMiddleware(rbac.ScopeAdmin), handlerV1.RequirePermission(rbac.ManageUsers), handlerV1.CreateUser)
 	apiV1.GET("/users", handlerV1.GetAllUsers)
-	apiV1.GET("/users/me", handlerV1.AuthMiddleware, handlerV1.GetUserProfile)
+	apiV1.GET("/users/me", handlerV1.AuthMiddleware(rbac.ScopeUsersRead), handlerV1.GetUserProfile)
+	apiV1.PUT("/users/me", handlerV1.AuthMiddleware(rbac.ScopeUsersWrite), handlerV1.UpdateUserProfile)
+	apiV1.PATCH("/users/me", handlerV1.AuthMiddleware(rbac.ScopeUsersWrite), handlerV1.PatchUserProfile)
+	apiV1.DELETE("/users/me", handlerV1.SessionAuthMiddleware, handlerV1.DeleteUserProfile)
+	apiV1.POST("/users/me/email", handlerV1.SessionAuthMiddleware, handlerV1.ChangeEmail)
+	apiV1.POST("/users/me/email/verify", handlerV1.SessionAuthMiddleware, handlerV1.VerifyChangeEmail)
+	apiV1.POST("/users/me/tokens", handlerV1.SessionAuthMiddleware, handlerV1.CreateAPIToken)
+	apiV1.GET("/users/me/tokens", handlerV1.SessionAuthMiddleware, handlerV1.GetAllAPITokens)
+	apiV1.DELETE("/users/me/tokens/:id", handlerV1.SessionAuthMiddleware, handlerV1.DeleteAPIToken)
+	apiV1.POST("/users/me/identities/:provider", handlerV1.SessionAuthMiddleware, handlerV1.LinkUserIdentity)
+	apiV1.POST("/users/me/identities/:provider/confirm", handlerV1.SessionAuthMiddleware, handlerV1.ConfirmUserIdentity)
+	apiV1.GET("/users/me/identities", handlerV1.SessionAuthMiddleware, handlerV1.GetAllUserIdentities)
+	apiV1.DELETE("/users/me/identities/:id", handlerV1.SessionAuthMiddleware, handlerV1.DeleteUserIdentity)
+	apiV1.GET("/users/me/sessions", handlerV1.SessionAuthMiddleware, handlerV1.GetAllSessions)
+	apiV1.DELETE("/users/me/sessions", handlerV1.SessionAuthMiddleware, handlerV1.DeleteAllSessions)
+	apiV1.DELETE("/users/me/sessions/:id", handlerV1.SessionAuthMiddleware, handlerV1.DeleteSession)
+	apiV1.PUT("/users/:id/role", handlerV1.AuthMiddleware(rbac.ScopeAdmin), handlerV1.RequirePermission(rbac.ManageUsers), handlerV1.UpdateUserRole)
 
 	apiV1.GET("/categories/:id", handlerV1.GetCategory)
-	apiV1.POST("/categories", handlerV1.AuthMiddleware, handlerV1.CreateCategory)
+	apiV1.POST("/categories", handlerV1.AuthMiddleware(rbac.ScopeCategoriesWrite), handlerV1.RequirePermission(rbac.ManageCategories), handlerV1.CreateCategory)
 	apiV1.GET("/categories", handlerV1.GetAllCategories)
-	apiV1.PUT("/categories/:id", handlerV1.AuthMiddleware, handlerV1.UpdateCategory)
-	apiV1.DELETE("/categories/:id", handlerV1.AuthMiddleware, handlerV1.DeleteCategory)
-
-	apiV1.GET("/posts/:id", handlerV1.GetPost)
-	apiV1.POST("/posts", handlerV1.AuthMiddleware, handlerV1.CreatePost)
-	apiV1.GET("/posts", handlerV1.GetAllPosts)
-
-	apiV1.POST("/comments", handlerV1.AuthMiddleware, handlerV1.CreateComment)
-	apiV1.GET("/comments", handlerV1.GetAllComments)
-
-	apiV1.POST("/likes", handlerV1.AuthMiddleware, handlerV1.CreateOrUpdateLike)
-	apiV1.GET("/likes/user-post", handlerV1.AuthMiddleware, handlerV1.GetLike)
-
-	apiV1.POST("/auth/register", handlerV1.Register)
-	apiV1.POST("/auth/verify", handlerV1.Verify)
-	apiV1.POST("/auth/login", handlerV1.Login)
-	apiV1.POST("/auth/forgot-password", handlerV1.ForgotPassword)
-	apiV1.POST("/auth/verify-forgot-password", handlerV1.VerifyForgotPassword)
-	apiV1.POST("/auth/update-password", handlerV1.AuthMiddleware, handlerV1.UpdatePassword)
-
-	apiV1.POST("/file-upload", handlerV1.AuthMiddleware, handlerV1.UploadFile)
+	apiV1.PUT("/categories/:id", handlerV1.AuthMiddleware(rbac.ScopeCategoriesWrite), handlerV1.RequirePermission(rbac.ManageCategories), handlerV1.UpdateCategory)
+	apiV1.DELETE("/categories/:id", handlerV1.AuthMiddleware(rbac.ScopeCategoriesWrite), handlerV1.RequirePermission(rbac.ManageCategories), handlerV1.DeleteCategory)
+
+	apiV1.GET("/posts/:id", handlerV1.OptionalAuthMiddleware(rbac.ScopePostsRead), handlerV1.GetPost)
+	apiV1.POST("/posts", handlerV1.AuthMiddleware(rbac.ScopePostsWrite), handlerV1.RequirePermission(rbac.CreatePosts), handlerV1.CreatePost)
+	apiV1.GET("/posts", handlerV1.OptionalAuthMiddleware(rbac.ScopePostsRead), handlerV1.GetAllPosts)
+	apiV1.PUT("/posts/:id", handlerV1.AuthMiddleware(rbac.ScopePostsWrite), handlerV1.UpdatePost)
+	apiV1.DELETE("/posts/:id", handlerV1.AuthMiddleware(rbac.ScopePostsWrite), handlerV1.DeletePost)
+	apiV1.GET("/posts/:id/revisions", handlerV1.OptionalAuthMiddleware(rbac.ScopePostsRead), handlerV1.GetPostRevisions)
+	apiV1.GET("/posts/:id/revisions/diff", handlerV1.OptionalAuthMiddleware(rbac.ScopePostsRead), handlerV1.GetPostRevisionsDiff)
+	apiV1.POST("/posts/:id/revisions/:revision/restore", handlerV1.AuthMiddleware(rbac.ScopePostsWrite), handlerV1.RestorePostRevision)
+
+	apiV1.POST("/comments", handlerV1.AuthMiddleware(rbac.ScopeCommentsWrite), handlerV1.RequirePermission(rbac.CreateComments), handlerV1.CreateComment)
+	apiV1.GET("/comments", handlerV1.OptionalAuthMiddleware(rbac.ScopeCommentsRead), handlerV1.GetAllComments)
+	apiV1.PUT("/comments/:id", handlerV1.AuthMiddleware(rbac.ScopeCommentsWrite), handlerV1.UpdateComment)
+	apiV1.DELETE("/comments/:id", handlerV1.AuthMiddleware(rbac.ScopeCommentsWrite), handlerV1.DeleteComment)
+
+	apiV1.GET("/tags", handlerV1.GetAllTags)
+
+	apiV1.GET("/search", handlerV1.OptionalAuthMiddleware(rbac.ScopeUsersRead), handlerV1.Search)
+
+	apiV1.POST("/likes", handlerV1.AuthMiddleware(rbac.ScopeLikesWrite), handlerV1.CreateOrUpdateLike)
+	apiV1.GET("/likes/user-post", handlerV1.AuthMiddleware(rbac.ScopeLikesRead), handlerV1.GetLike)
+
+	auth := apiV1.Group("/auth", handlerV1.RateLimitMiddleware("auth", limits.Auth))
+	auth.POST("/register", handlerV1.Register)
+	auth.POST("/verify", handlerV1.Verify)
+	auth.POST("/login", handlerV1.Login)
+	auth.POST("/forgot-password", handlerV1.ForgotPassword)
+	auth.POST("/verify-forgot-password", handlerV1.VerifyForgotPassword)
+	auth.POST("/update-password", handlerV1.PasswordResetAuthMiddleware, handlerV1.UpdatePassword)
+	auth.POST("/magic-link", handlerV1.SendMagicLink)
+	auth.GET("/magic-link/consume", handlerV1.ConfirmMagicLink)
+	auth.POST("/magic-link/consume", handlerV1.ConsumeMagicLink)
+	auth.POST("/refresh", handlerV1.RefreshToken)
+	auth.POST("/logout", handlerV1.SessionAuthMiddleware, handlerV1.Logout)
+	auth.POST("/2fa/enroll", handlerV1.SessionAuthMiddleware, handlerV1.EnrollTwoFactor)
+	auth.POST("/2fa/confirm", handlerV1.SessionAuthMiddleware, handlerV1.ConfirmTwoFactor)
+	auth.POST("/2fa/disable", handlerV1.SessionAuthMiddleware, handlerV1.DisableTwoFactor)
+	auth.POST("/2fa/verify", handlerV1.VerifyTwoFactor)
+	auth.GET("/oidc/providers", handlerV1.GetOIDCProviders)
+	auth.GET("/oidc/:provider/authorize", handlerV1.AuthorizeOIDC)
+	auth.GET("/oidc/:provider/callback", handlerV1.OIDCCallback)
+
+	apiV1.GET("/admin/emails", handlerV1.AuthMiddleware(rbac.ScopeAdmin), handlerV1.RequirePermission(rbac.ManageEmails), handlerV1.GetAllEmails)
+	apiV1.POST("/admin/emails/:id/resend", handlerV1.AuthMiddleware(rbac.ScopeAdmin), handlerV1.RequirePermission(rbac.ManageEmails), handlerV1.ResendEmail)
+
+	apiV1.POST("/file-upload", handlerV1.RateLimitMiddleware("upload", limits.Upload), handlerV1.AuthMiddleware(rbac.ScopeFilesWrite), handlerV1.UploadFile)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	return router
+	return router, nil
 }
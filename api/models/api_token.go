@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"required,min=1,max=365"`
+}
+
+// CreateAPITokenResponse holds the token, it can't be shown again later
+type CreateAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+type GetAllAPITokensResponse struct {
+	Tokens []*APIToken `json:"tokens"`
+	Count  int32       `json:"count"`
+}
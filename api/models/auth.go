@@ -6,23 +6,24 @@ type RegisterRequest struct {
 	FirstName string `json:"first_name" binding:"required,min=2,max=30"`
 	LastName  string `json:"last_name" binding:"required,min=2,max=30"`
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6,max=16"`
+	Password  string `json:"password" binding:"required"`
 }
 
 type AuthResponse struct {
-	ID          int64     `json:"id"`
-	FirstName   string    `json:"first_name"`
-	LastName    string    `json:"last_name"`
-	Email       string    `json:"email"`
-	Username    string    `json:"username"`
-	Type        string    `json:"type"`
-	CreatedAt   time.Time `json:"created_at"`
-	AccessToken string    `json:"access_token"`
+	ID           int64     `json:"id"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	Username     string    `json:"username"`
+	Type         string    `json:"type"`
+	CreatedAt    time.Time `json:"created_at"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6,max=16"`
+	Password string `json:"password" binding:"required"`
 }
 
 type VerifyRequest struct {
@@ -34,6 +35,21 @@ type ForgotPasswordRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+// UpdatePasswordRequest needs the current password unless it is sent
+// with the password reset token of a forgot password flow
 type UpdatePasswordRequest struct {
-	Password string `json:"password" binding:"required"`
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password" binding:"required"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
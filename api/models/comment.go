@@ -3,13 +3,17 @@ package models
 import "time"
 
 type Comment struct {
-	ID          int64        `json:"id"`
-	UserID      int64        `json:"user_id"`
-	PostID      int64        `json:"post_id"`
-	Description string       `json:"description"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   *time.Time   `json:"updated_at"`
-	User        *CommentUser `json:"user"`
+	ID           int64        `json:"id"`
+	UserID       int64        `json:"user_id"`
+	PostID       int64        `json:"post_id"`
+	ParentID     *int64       `json:"parent_id"`
+	Description  string       `json:"description"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    *time.Time   `json:"updated_at"`
+	IsDeleted    bool         `json:"is_deleted"`
+	RepliesCount int32        `json:"replies_count"`
+	User         *CommentUser `json:"user"`
+	Replies      []*Comment   `json:"replies,omitempty"`
 }
 
 type CommentUser struct {
@@ -23,16 +27,28 @@ type CommentUser struct {
 type CreateCommentRequest struct {
 	Description string `json:"description" binding:"required"`
 	PostID      int64  `json:"post_id" binding:"required"`
+	ParentID    *int64 `json:"parent_id"`
+}
+
+type UpdateCommentRequest struct {
+	Description string `json:"description" binding:"required"`
 }
 
 type GetAllCommentsParams struct {
-	Limit  int32 `json:"limit" binding:"required" default:"10"`
-	Page   int32 `json:"page" binding:"required" default:"1"`
-	UserID int64 `json:"user_id"`
-	PostID int64 `json:"post_id"`
+	Limit    int32 `json:"limit" binding:"required" default:"10"`
+	Page     int32 `json:"page" binding:"required" default:"1"`
+	UserID   int64 `json:"user_id"`
+	PostID   int64 `json:"post_id"`
+	ParentID int64 `json:"parent_id"`
+	Depth    int32 `json:"depth" default:"3"`
+	// Cursor is next_cursor or prev_cursor of a previous response,
+	// page is ignored and count is not returned when it is set
+	Cursor string `json:"cursor"`
 }
 
 type GetAllCommentsResponse struct {
-	Comments []*Comment `json:"comments"`
-	Count    int32      `json:"count"`
+	Comments   []*Comment `json:"comments"`
+	Count      int32      `json:"count"`
+	NextCursor *string    `json:"next_cursor"`
+	PrevCursor *string    `json:"prev_cursor"`
 }
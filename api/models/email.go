@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type OutboxEmail struct {
+	ID            int64      `json:"id"`
+	To            []string   `json:"to"`
+	Subject       string     `json:"subject"`
+	Status        string     `json:"status" enums:"pending,sent,failed"`
+	Attempts      int32      `json:"attempts"`
+	LastError     *string    `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at"`
+}
+
+type GetAllEmailsParams struct {
+	Limit  int32  `json:"limit" binding:"required" default:"10"`
+	Page   int32  `json:"page" binding:"required" default:"1"`
+	Status string `json:"status" enums:"pending,sent,failed"`
+}
+
+type GetAllEmailsResponse struct {
+	Emails []*OutboxEmail `json:"emails"`
+	Count  int32          `json:"count"`
+}
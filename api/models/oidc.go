@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// OIDCAuthorizeResponse holds the provider URL to send the user to. The
+// provider redirects back to the callback route
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// OIDCLinkResponse holds the token the user confirms the link of the
+// provider account with
+type OIDCLinkResponse struct {
+	LinkToken string    `json:"link_token"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ConfirmUserIdentityRequest struct {
+	LinkToken string `json:"link_token" binding:"required"`
+	Password  string `json:"password"`
+}
+
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GetAllUserIdentitiesResponse struct {
+	Identities []*UserIdentity `json:"identities"`
+	Count      int32           `json:"count"`
+}
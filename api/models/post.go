@@ -12,6 +12,9 @@ type Post struct {
 	UpdatedAt   *time.Time    `json:"updated_at"`
 	ViewsCount  int32         `json:"views_count"`
 	CreatedAt   time.Time     `json:"created_at"`
+	Tags        []string      `json:"tags"`
+	Status      string        `json:"status"`
+	PublishAt   *time.Time    `json:"publish_at"`
 	LikeInfo    *PostLikeInfo `json:"like_info"`
 }
 
@@ -21,10 +24,14 @@ type PostLikeInfo struct {
 }
 
 type CreatePostRequest struct {
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
-	ImageUrl    *string `json:"image_url"`
-	CategoryID  int64   `json:"category_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	ImageUrl    *string  `json:"image_url"`
+	CategoryID  int64    `json:"category_id"`
+	Tags        []string `json:"tags" binding:"max=10,dive,max=50"`
+	// Status defaults to published on create and is kept on update when empty
+	Status    string     `json:"status" binding:"omitempty,oneof=draft scheduled published archived" enums:"draft,scheduled,published,archived"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type GetAllPostsParams struct {
@@ -34,9 +41,18 @@ type GetAllPostsParams struct {
 	UserID     int64  `json:"user_id"`
 	CategoryID int64  `json:"category_id"`
 	SortByData string `json:"sort_by_date" enums:"asc,desc" default:"desc"`
+	Tags       string `json:"tags" example:"go,postgres"`
+	TagsMatch  string `json:"tags_match" enums:"any,all" default:"any"`
+	// Status other than published lists only your own posts
+	Status string `json:"status" enums:"draft,scheduled,published,archived"`
+	// Cursor is next_cursor or prev_cursor of a previous response,
+	// page is ignored and count is not returned when it is set
+	Cursor string `json:"cursor"`
 }
 
 type GetAllPostsResponse struct {
-	Posts []*Post `json:"posts"`
-	Count int32   `json:"count"`
+	Posts      []*Post `json:"posts"`
+	Count      int32   `json:"count"`
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
 }
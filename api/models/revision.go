@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type PostRevision struct {
+	Revision    int32     `json:"revision"`
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageUrl    *string   `json:"image_url"`
+	CategoryID  int64     `json:"category_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type GetAllRevisionsParams struct {
+	Limit int32 `json:"limit" binding:"required" default:"10"`
+	Page  int32 `json:"page" binding:"required" default:"1"`
+}
+
+type GetAllRevisionsResponse struct {
+	Revisions []*PostRevision `json:"revisions"`
+	Count     int32           `json:"count"`
+}
+
+type RevisionDiffParams struct {
+	From int32 `json:"from" binding:"required"`
+	To   int32 `json:"to" binding:"required"`
+}
+
+type DiffLine struct {
+	Op   string `json:"op" enums:"equal,insert,delete"`
+	Text string `json:"text"`
+}
+
+// RevisionDiff holds the line based changes of each field between two revisions
+type RevisionDiff struct {
+	From        int32       `json:"from"`
+	To          int32       `json:"to"`
+	Title       []*DiffLine `json:"title"`
+	Description []*DiffLine `json:"description"`
+	ImageUrl    []*DiffLine `json:"image_url"`
+	CategoryID  []*DiffLine `json:"category_id"`
+}
@@ -0,0 +1,30 @@
+package models
+
+type SearchParams struct {
+	Query string `json:"q" binding:"required"`
+	Types string `json:"types" example:"posts,comments,users" default:"posts,comments,users"`
+	Limit int32  `json:"limit" default:"10"`
+	Page  int32  `json:"page" default:"1"`
+}
+
+type SearchPost struct {
+	Post     *Post   `json:"post"`
+	Rank     float32 `json:"rank"`
+	Headline string  `json:"headline"`
+	Snippet  string  `json:"snippet"`
+}
+
+type SearchComment struct {
+	Comment *Comment `json:"comment"`
+	Rank    float32  `json:"rank"`
+	Snippet string   `json:"snippet"`
+}
+
+type SearchResponse struct {
+	Posts         []*SearchPost    `json:"posts"`
+	PostsCount    int32            `json:"posts_count"`
+	Comments      []*SearchComment `json:"comments"`
+	CommentsCount int32            `json:"comments_count"`
+	Users         []*User          `json:"users"`
+	UsersCount    int32            `json:"users_count"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session of the request
+	Current bool `json:"current"`
+}
+
+type GetAllSessionsResponse struct {
+	Sessions []*Session `json:"sessions"`
+	Count    int32      `json:"count"`
+}
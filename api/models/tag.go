@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Tag struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	PostsCount int32     `json:"posts_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type GetAllTagsResponse struct {
+	Tags  []*Tag `json:"tags"`
+	Count int32  `json:"count"`
+}
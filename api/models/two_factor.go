@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code
+	URI string `json:"uri"`
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorRecoveryCodesResponse struct {
+	// RecoveryCodes are shown once, each one can replace a code a single time
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorDisableRequest is confirmed with either the current password or
+// a code of the authenticator app, which users without a password use
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required_without=Code"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorChallengeResponse is the response of a login needing the second step
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// TwoFactorVerifyRequest completes a login with either a code of the
+// authenticator app or a recovery code
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code"`
+}
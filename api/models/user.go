@@ -23,11 +23,43 @@ type CreateUserRequest struct {
 	Gender          *string `json:"gender" binding:"oneof=male female"`
 	Username        *string `json:"username"`
 	ProfileImageUrl *string `json:"profile_image_url"`
-	Type            string  `json:"type" binding:"required,oneof=superadmin user"`
-	Password        string  `json:"password" binding:"required,min=6,max=16"`
+	Type            string  `json:"type" binding:"required,oneof=superadmin editor moderator author reader"`
+	Password        string  `json:"password" binding:"required"`
 }
 
 type GetAllUsersResponse struct {
 	Users []*User `json:"categories"`
 	Count int32   `json:"count"`
 }
+
+type UpdateUserRoleRequest struct {
+	Type string `json:"type" binding:"required,oneof=superadmin editor moderator author reader"`
+}
+
+// UpdateUserRequest replaces the profile, omitted optional fields are cleared
+type UpdateUserRequest struct {
+	FirstName       string  `json:"first_name" binding:"required,min=2,max=30"`
+	LastName        string  `json:"last_name" binding:"required,min=2,max=30"`
+	PhoneNumber     *string `json:"phone_number" binding:"omitempty,max=20"`
+	Gender          *string `json:"gender" binding:"omitempty,oneof=male female"`
+	Username        *string `json:"username" binding:"omitempty,min=3,max=30,alphanum"`
+	ProfileImageUrl *string `json:"profile_image_url"`
+}
+
+// PatchUserRequest updates the given fields of the profile only
+type PatchUserRequest struct {
+	FirstName       *string `json:"first_name" binding:"omitempty,min=2,max=30"`
+	LastName        *string `json:"last_name" binding:"omitempty,min=2,max=30"`
+	PhoneNumber     *string `json:"phone_number" binding:"omitempty,max=20"`
+	Gender          *string `json:"gender" binding:"omitempty,oneof=male female"`
+	Username        *string `json:"username" binding:"omitempty,min=3,max=30,alphanum"`
+	ProfileImageUrl *string `json:"profile_image_url"`
+}
+
+type ChangeEmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyChangeEmailRequest struct {
+	Code string `json:"code" binding:"required"`
+}
@@ -0,0 +1,279 @@
+package v1
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/rbac"
+	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// apiTokenPrefix starts every personal access token, so they can be
+	// told apart from JWTs and found by secret scanners
+	apiTokenPrefix = "blog_pat_"
+	// apiTokenShownPrefix is the length of the token start kept in the storage
+	apiTokenShownPrefix = len(apiTokenPrefix) + 6
+	apiTokenSize        = 32
+	// apiTokenContextKey caches the token of the request looked up by
+	// the rate limiter for the authentication
+	apiTokenContextKey = "api_token"
+	// apiTokenLastUsedInterval spares writing the last use of a token on
+	// every request
+	apiTokenLastUsedInterval = time.Minute
+)
+
+// @Security ApiKeyAuth
+// @Router /users/me/tokens [post]
+// @Summary Create a personal access token
+// @Description Create a personal access token for scripts and integrations. The token
+// @Description is only returned once, it is sent in the Authorization header like an access token
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param token body models.CreateAPITokenRequest true "Token"
+// @Success 201 {object} models.CreateAPITokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreateAPIToken(c *gin.Context) {
+	var (
+		req models.CreateAPITokenRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !rbac.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidScope))
+			return
+		}
+
+		if !rbac.HasScope(scopes, rbac.Scope(scope)) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	resp, err := h.storage.APIToken().Create(&repo.APIToken{
+		UserID:    payload.UserID,
+		Name:      req.Name,
+		Prefix:    token[:apiTokenShownPrefix],
+		TokenHash: hashAPIToken(token),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateAPITokenResponse{
+		APIToken: *parseAPITokenModel(resp),
+		Token:    token,
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/tokens [get]
+// @Summary Get personal access tokens
+// @Description Get the personal access tokens of the user, newest first
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.GetAllAPITokensResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllAPITokens(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	tokens, err := h.storage.APIToken().GetAll(payload.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	response := models.GetAllAPITokensResponse{
+		Tokens: make([]*models.APIToken, 0),
+		Count:  int32(len(tokens)),
+	}
+	for _, t := range tokens {
+		response.Tokens = append(response.Tokens, parseAPITokenModel(t))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/tokens/{id} [delete]
+// @Summary Revoke a personal access token
+// @Description Revoke a personal access token
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteAPIToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.storage.APIToken().Delete(payload.UserID, int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully revoked",
+	})
+}
+
+// apiTokenAuth authenticates a personal access token having the scope. Its
+// payload carries the scopes of the token and the current role of the user
+func (h *handlerV1) apiTokenAuth(c *gin.Context, scope rbac.Scope) {
+	token, err := h.lookupAPIToken(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	now := time.Now()
+	if now.After(token.ExpiresAt) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(utils.ErrExpiredToken))
+		return
+	}
+
+	if !rbac.HasScope(token.Scopes, scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, errorResponse(ErrMissingScope))
+		return
+	}
+
+	user, err := h.storage.User().Get(token.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenLastUsedInterval {
+		err = h.storage.APIToken().UpdateLastUsed(token.ID, now)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	c.Set(authorizationPayloadKey, &utils.Payload{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypePersonalAccess,
+		Scopes:    token.Scopes,
+		IssuedAt:  token.CreatedAt,
+		ExpiredAt: token.ExpiresAt,
+	})
+	c.Next()
+}
+
+// lookupAPIToken returns the personal access token of the request, looking
+// it up only once per request
+func (h *handlerV1) lookupAPIToken(c *gin.Context) (*repo.APIToken, error) {
+	if token, ok := c.Get(apiTokenContextKey); ok {
+		return token.(*repo.APIToken), nil
+	}
+
+	token, err := h.storage.APIToken().GetByHash(hashAPIToken(c.GetHeader(authorizationHeaderKey)))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(apiTokenContextKey, token)
+	return token, nil
+}
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, apiTokenSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIToken hashes the token to look it up. The tokens are random
+// enough for a plain SHA-256
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseAPITokenModel(t *repo.APIToken) *models.APIToken {
+	return &models.APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
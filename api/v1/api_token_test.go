@@ -0,0 +1,101 @@
+package v1_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	token := s.createAPIToken(s.login(user.Email, testPassword).AccessToken, "users:read")
+
+	w := s.request(http.MethodGet, "/v1/users/me", nil, token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = s.request(http.MethodGet, "/v1/likes/user-post", nil, token)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// the routes without a scope only accept the access tokens of a login
+	w = s.request(http.MethodGet, "/v1/users/me/sessions", nil, token)
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+}
+
+func TestAPITokenLastUsed(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	token := s.createAPIToken(s.login(user.Email, testPassword).AccessToken, "users:read")
+
+	lastUsedAt := func() string {
+		tokens, err := s.storage.APIToken().GetAll(user.ID)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		require.NotNil(t, tokens[0].LastUsedAt)
+		return tokens[0].LastUsedAt.String()
+	}
+
+	w := s.request(http.MethodGet, "/v1/users/me", nil, token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	first := lastUsedAt()
+
+	// the last use isn't written again within a minute
+	w = s.request(http.MethodGet, "/v1/users/me", nil, token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, first, lastUsedAt())
+}
+
+func TestAPITokenRevoked(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(s *testServer, accessToken string)
+	}{
+		{
+			name: "password change",
+			revoke: func(s *testServer, accessToken string) {
+				w := s.request(http.MethodPost, "/v1/auth/update-password", models.UpdatePasswordRequest{
+					CurrentPassword: testPassword,
+					Password:        "NewSecret123",
+				}, accessToken)
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			},
+		},
+		{
+			name: "email change",
+			revoke: func(s *testServer, accessToken string) {
+				address := "changed@example.com"
+				w := s.request(http.MethodPost, "/v1/users/me/email", models.ChangeEmailRequest{
+					Email: address,
+				}, accessToken)
+				require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+				w = s.request(http.MethodPost, "/v1/users/me/email/verify", models.VerifyChangeEmailRequest{
+					Code: s.code(address),
+				}, accessToken)
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			},
+		},
+		{
+			name: "log out everywhere",
+			revoke: func(s *testServer, accessToken string) {
+				w := s.request(http.MethodDelete, "/v1/users/me/sessions", nil, accessToken)
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			accessToken := s.login(s.createUser().Email, testPassword).AccessToken
+			token := s.createAPIToken(accessToken, "users:read")
+
+			tt.revoke(s, accessToken)
+
+			w := s.request(http.MethodGet, "/v1/users/me", nil, token)
+			require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+		})
+	}
+}
@@ -4,20 +4,31 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/TemurMannonov/blog/api/models"
 	emailPkg "github.com/TemurMannonov/blog/pkg/email"
 	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/TemurMannonov/blog/storage"
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 const (
 	RegisterCodeKey   = "register_code_"
 	ForgotPasswordKey = "forgot_password_code_"
+	RefreshTokenKey   = "refresh_token_"
+	RevokedTokenKey   = "revoked_token_"
+	RevokedFamilyKey  = "revoked_token_family_"
+	RevokedUserKey    = "revoked_user_tokens_"
+	ChangeEmailKey    = "change_email_"
+	ChangeEmailCode   = "change_email_code_"
+
+	verificationCodeDuration   = 10 * time.Minute
+	passwordResetTokenDuration = 30 * time.Minute
 )
 
 // @Router /auth/register [post]
@@ -46,6 +57,12 @@ func (h *handlerV1) Register(c *gin.Context) {
 		return
 	}
 
+	err = h.password.Validate(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
@@ -56,7 +73,7 @@ func (h *handlerV1) Register(c *gin.Context) {
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		Email:     req.Email,
-		Type:      repo.UserTypeUser,
+		Type:      repo.UserTypeAuthor,
 		Password:  hashedPassword,
 	}
 
@@ -66,48 +83,64 @@ func (h *handlerV1) Register(c *gin.Context) {
 		return
 	}
 
-	err = h.inMemory.Set("user_"+user.Email, string(userData), 10*time.Minute)
+	err = h.inMemory.Set("user_"+user.Email, string(userData), h.codeDuration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	go func() {
-		err := h.sendVerificationCode(RegisterCodeKey, req.Email)
-		if err != nil {
-			fmt.Printf("failed to send verification code: %v", err)
-		}
-	}()
+	err = h.sendVerificationCode(RegisterCodeKey+req.Email, emailPkg.VerificationEmail, req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
 
 	c.JSON(http.StatusCreated, models.ResponseOK{
 		Message: "Verification code has been sent!",
 	})
 }
 
-func (h *handlerV1) sendVerificationCode(key, email string) error {
+// sendVerificationCode stores a new code at codeKey and emails it to the email
+func (h *handlerV1) sendVerificationCode(codeKey, emailType, email string) error {
 	code, err := utils.GenerateRandomCode(6)
 	if err != nil {
 		return err
 	}
 
-	err = h.inMemory.Set(key+email, code, time.Minute)
+	err = h.inMemory.Set(codeKey, code, h.codeDuration)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.inMemory.Delete(CodeAttemptsKey + codeKey)
 	if err != nil {
 		return err
 	}
 
-	err = emailPkg.SendEmail(h.cfg, &emailPkg.SendEmailRequest{
-		To:      []string{email},
-		Subject: "Verification email",
-		Body: map[string]string{
-			"code": code,
+	return h.queueEmail(&emailPkg.SendEmailRequest{
+		To: []string{email},
+		Secrets: map[string]string{
+			"code": codeKey,
 		},
-		Type: emailPkg.VerificationEmail,
+		Type: emailType,
 	})
+}
+
+// queueEmail puts the email into the outbox the worker renders and sends it from
+func (h *handlerV1) queueEmail(req *emailPkg.SendEmailRequest) error {
+	subject, err := emailPkg.Subject(req.Type)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = h.storage.EmailOutbox().Create(&repo.OutboxEmail{
+		To:      req.To,
+		Subject: subject,
+		Type:    req.Type,
+		Body:    req.Body,
+		Secrets: req.Secrets,
+	})
+	return err
 }
 
 // @Router /auth/verify [post]
@@ -118,6 +151,7 @@ func (h *handlerV1) sendVerificationCode(key, email string) error {
 // @Produce json
 // @Param data body models.VerifyRequest true "Data"
 // @Success 200 {object} models.AuthResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) Verify(c *gin.Context) {
 	var (
@@ -130,6 +164,18 @@ func (h *handlerV1) Verify(c *gin.Context) {
 		return
 	}
 
+	keys := newAttemptKeys(c, "verify", req.Email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
 	userData, err := h.inMemory.Get("user_" + req.Email)
 	if err != nil {
 		c.JSON(http.StatusForbidden, errorResponse(err))
@@ -150,7 +196,13 @@ func (h *handlerV1) Verify(c *gin.Context) {
 	}
 
 	if req.Code != code {
-		c.JSON(http.StatusForbidden, errorResponse(ErrIncorrectCode))
+		h.wrongCode(c, keys, RegisterCodeKey+user.Email)
+		return
+	}
+
+	err = h.resetFailedAttempts(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
@@ -160,36 +212,26 @@ func (h *handlerV1) Verify(c *gin.Context) {
 		return
 	}
 
-	token, _, err := utils.CreateToken(h.cfg, &utils.TokenParams{
-		UserID:   result.ID,
-		Email:    result.Email,
-		UserType: result.Type,
-		Duration: time.Hour * 24,
-	})
+	resp, err := h.newSession(c, result)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.AuthResponse{
-		ID:          result.ID,
-		FirstName:   result.FirstName,
-		LastName:    result.LastName,
-		Email:       result.Email,
-		Type:        result.Type,
-		CreatedAt:   result.CreatedAt,
-		AccessToken: token,
-	})
+	c.JSON(http.StatusCreated, resp)
 }
 
 // @Router /auth/login [post]
 // @Summary Login user
-// @Description Login user
+// @Description Login user. Users with two-factor authentication get a challenge token
+// @Description to complete the login at /auth/2fa/verify
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param data body models.LoginRequest true "Data"
-// @Success 200 {object} models.AuthResponse
+// @Success 201 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) Login(c *gin.Context) {
 	var (
@@ -202,10 +244,22 @@ func (h *handlerV1) Login(c *gin.Context) {
 		return
 	}
 
+	keys := newAttemptKeys(c, "login", req.Email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
 	result, err := h.storage.User().GetByEmail(req.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusForbidden, errorResponse(ErrWrongEmailOrPass))
+			h.wrongCredentials(c, keys)
 			return
 		}
 
@@ -215,30 +269,17 @@ func (h *handlerV1) Login(c *gin.Context) {
 
 	err = utils.CheckPassword(req.Password, result.Password)
 	if err != nil {
-		c.JSON(http.StatusForbidden, errorResponse(ErrWrongEmailOrPass))
+		h.wrongCredentials(c, keys)
 		return
 	}
 
-	token, _, err := utils.CreateToken(h.cfg, &utils.TokenParams{
-		UserID:   result.ID,
-		Email:    result.Email,
-		UserType: result.Type,
-		Duration: time.Hour * 24,
-	})
+	err = h.resetFailedAttempts(keys)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.AuthResponse{
-		ID:          result.ID,
-		FirstName:   result.FirstName,
-		LastName:    result.LastName,
-		Email:       result.Email,
-		Type:        result.Type,
-		CreatedAt:   result.CreatedAt,
-		AccessToken: token,
-	})
+	h.login(c, result)
 }
 
 // @Router /auth/forgot-password [post]
@@ -272,12 +313,11 @@ func (h *handlerV1) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	go func() {
-		err := h.sendVerificationCode(ForgotPasswordKey, req.Email)
-		if err != nil {
-			fmt.Printf("failed to send verification code: %v", err)
-		}
-	}()
+	err = h.sendVerificationCode(ForgotPasswordKey+req.Email, emailPkg.ForgotPasswordEmail, req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
 
 	c.JSON(http.StatusCreated, models.ResponseOK{
 		Message: "Verification code has been sent!",
@@ -286,12 +326,13 @@ func (h *handlerV1) ForgotPassword(c *gin.Context) {
 
 // @Router /auth/verify-forgot-password [post]
 // @Summary Verify forgot password
-// @Description Verify forgot password
+// @Description Verify forgot password. The returned token only allows to set a new password
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param data body models.VerifyRequest true "Data"
 // @Success 200 {object} models.AuthResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 	var (
@@ -304,6 +345,18 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 		return
 	}
 
+	keys := newAttemptKeys(c, "verify_forgot_password", req.Email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
 	code, err := h.inMemory.Get(ForgotPasswordKey + req.Email)
 	if err != nil {
 		c.JSON(http.StatusForbidden, errorResponse(ErrCodeExpired))
@@ -311,7 +364,13 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 	}
 
 	if req.Code != code {
-		c.JSON(http.StatusForbidden, errorResponse(ErrIncorrectCode))
+		h.wrongCode(c, keys, ForgotPasswordKey+req.Email)
+		return
+	}
+
+	err = h.resetFailedAttempts(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
@@ -321,10 +380,12 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 		return
 	}
 
-	token, _, err := utils.CreateToken(h.cfg, &utils.TokenParams{
-		UserID:   result.ID,
-		Email:    result.Email,
-		Duration: time.Minute * 30,
+	token, _, err := utils.CreateToken(h.keys, &utils.TokenParams{
+		UserID:    result.ID,
+		Email:     result.Email,
+		UserType:  result.Type,
+		TokenType: utils.TokenTypePasswordReset,
+		Duration:  passwordResetTokenDuration,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
@@ -345,12 +406,17 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 // @Security ApiKeyAuth
 // @Router /auth/update-password [post]
 // @Summary Update password
-// @Description Update password
+// @Description Update password. current_password is required unless the token is a password reset one.
+// @Description Every other login of the user is logged out and the personal access tokens are revoked
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param data body models.UpdatePasswordRequest true "Data"
-// @Success 200 {object} models.ResponseOK
+// @Success 200 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UpdatePassword(c *gin.Context) {
 	var (
@@ -369,6 +435,55 @@ func (h *handlerV1) UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// users who signed up with an identity provider have no password to confirm
+	if payload.TokenType != utils.TokenTypePasswordReset && user.Password != "" {
+		if req.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, errorResponse(ErrCurrentPassword))
+			return
+		}
+
+		keys := newAttemptKeys(c, "update_password", user.Email)
+		retryAfter, err := h.checkLockout(keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if retryAfter > 0 {
+			tooManyAttempts(c, retryAfter)
+			return
+		}
+
+		err = utils.CheckPassword(req.CurrentPassword, user.Password)
+		if err != nil {
+			h.failedAttempt(c, keys, ErrWrongPassword)
+			return
+		}
+
+		err = h.resetFailedAttempts(keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	err = h.password.Validate(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
@@ -376,7 +491,7 @@ func (h *handlerV1) UpdatePassword(c *gin.Context) {
 	}
 
 	err = h.storage.User().UpdatePassword(&repo.UpdatePassword{
-		UserID:   payload.UserID,
+		UserID:   user.ID,
 		Password: hashedPassword,
 	})
 	if err != nil {
@@ -384,7 +499,273 @@ func (h *handlerV1) UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.ResponseOK{
-		Message: "Password has been updated!",
+	// the password reset token, the other logins and the personal access
+	// tokens are revoked, this client gets a new login instead
+	err = h.revokeCredentials(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// a password reset doesn't pass the second factor
+	if payload.TokenType == utils.TokenTypePasswordReset {
+		h.login(c, user)
+		return
+	}
+
+	resp, err := h.newSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Router /auth/refresh [post]
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access and refresh token pair.
+// @Description Every refresh token can be used once, reusing one revokes all tokens of the login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body models.RefreshTokenRequest true "Data"
+// @Success 200 {object} models.AuthResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RefreshToken(c *gin.Context) {
+	var (
+		req models.RefreshTokenRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := utils.VerifyToken(h.keys, req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if payload.TokenType != utils.TokenTypeRefresh {
+		c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+		return
+	}
+
+	revoked, err := h.isTokenRevoked(payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if revoked {
+		c.JSON(http.StatusUnauthorized, errorResponse(ErrTokenRevoked))
+		return
+	}
+
+	existed, err := h.inMemory.Delete(RefreshTokenKey + payload.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !existed {
+		err = h.revokeTokenFamily(payload.FamilyID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusUnauthorized, errorResponse(ErrRefreshTokenReused))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.storage.Session().UpdateLastSeen(payload.FamilyID, c.ClientIP(), time.Now())
+	if err == nil {
+		err = h.storage.Session().Extend(payload.FamilyID, time.Now().Add(h.cfg.RefreshTokenDuration))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, errorResponse(ErrTokenRevoked))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	resp, err := h.newAuthResponse(user, payload.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Security ApiKeyAuth
+// @Router /auth/logout [post]
+// @Summary Logout user
+// @Description Revoke the access token and all refresh tokens of the current login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) Logout(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.revokeLogin(payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully logged out",
+	})
+}
+
+// newAuthResponse issues an access token and a refresh token of the given family
+func (h *handlerV1) newAuthResponse(user *repo.User, familyID uuid.UUID) (*models.AuthResponse, error) {
+	accessToken, _, err := utils.CreateToken(h.keys, &utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypeAccess,
+		FamilyID:  familyID,
+		Duration:  h.cfg.AccessTokenDuration,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshPayload, err := utils.CreateToken(h.keys, &utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypeRefresh,
+		FamilyID:  familyID,
+		Duration:  h.cfg.RefreshTokenDuration,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.inMemory.Set(RefreshTokenKey+refreshPayload.ID.String(), familyID.String(), h.cfg.RefreshTokenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		ID:           user.ID,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		Type:         user.Type,
+		CreatedAt:    user.CreatedAt,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// revokeTokenFamily revokes every token issued for a login and ends its
+// session. It is kept as long as the longest living refresh token of the family
+func (h *handlerV1) revokeTokenFamily(familyID uuid.UUID) error {
+	err := h.inMemory.Set(RevokedFamilyKey+familyID.String(), "1", h.cfg.RefreshTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	err = h.storage.Session().Delete(familyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// revokeLogin revokes the access token and all refresh tokens of the login
+func (h *handlerV1) revokeLogin(payload *utils.Payload) error {
+	err := h.inMemory.Set(RevokedTokenKey+payload.ID.String(), "1", time.Until(payload.ExpiredAt))
+	if err != nil {
+		return err
+	}
+
+	if payload.FamilyID != uuid.Nil {
+		return h.revokeTokenFamily(payload.FamilyID)
+	}
+
+	return nil
+}
+
+// revokeUserTokens revokes every token issued to the user so far and
+// ends all sessions
+func (h *handlerV1) revokeUserTokens(userID int64) error {
+	err := h.inMemory.Set(
+		RevokedUserKey+strconv.FormatInt(userID, 10),
+		strconv.FormatInt(time.Now().UnixNano(), 10),
+		h.cfg.RefreshTokenDuration,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.storage.Session().DeleteAll(userID)
+	return err
+}
+
+// revokeCredentials revokes the logins of the user like revokeUserTokens
+// and the personal access tokens too
+func (h *handlerV1) revokeCredentials(userID int64) error {
+	err := h.revokeUserTokens(userID)
+	if err != nil {
+		return err
+	}
+
+	return h.storage.APIToken().DeleteAll(userID)
+}
+
+func (h *handlerV1) isTokenRevoked(payload *utils.Payload) (bool, error) {
+	revoked, err := h.inMemory.Exists(RevokedTokenKey + payload.ID.String())
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	revoked, err = h.inMemory.Exists(RevokedFamilyKey + payload.FamilyID.String())
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	revokedAt, err := h.inMemory.Get(RevokedUserKey + strconv.FormatInt(payload.UserID, 10))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ns, err := strconv.ParseInt(revokedAt, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return !payload.IssuedAt.After(time.Unix(0, ns)), nil
 }
@@ -0,0 +1,113 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/bxcodec/faker/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	s := newTestServer(t)
+	address := faker.Email()
+
+	w := s.request(http.MethodPost, "/v1/auth/register", models.RegisterRequest{
+		FirstName: faker.FirstName(),
+		LastName:  faker.LastName(),
+		Email:     address,
+		Password:  testPassword,
+	}, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	msg := s.lastEmail(address)
+	require.Equal(t, "Verification email", msg.Subject)
+	code := s.code(address)
+	require.Contains(t, msg.HTML, code)
+
+	// the outbox only keeps the key the code is looked up by
+	queued, err := s.storage.EmailOutbox().GetAll(&repo.GetAllEmailsParams{Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Len(t, queued.Emails, 1)
+	require.NotContains(t, fmt.Sprint(*queued.Emails[0]), code)
+
+	w = s.request(http.MethodPost, "/v1/auth/verify", models.VerifyRequest{
+		Email: address,
+		Code:  wrongCode(code),
+	}, "")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	var resp models.AuthResponse
+	decode(t, s.request(http.MethodPost, "/v1/auth/verify", models.VerifyRequest{
+		Email: address,
+		Code:  code,
+	}, ""), http.StatusCreated, &resp)
+	require.Equal(t, address, resp.Email)
+	require.NotEmpty(t, resp.AccessToken)
+	require.NotEmpty(t, resp.RefreshToken)
+
+	s.login(address, testPassword)
+
+	w = s.request(http.MethodPost, "/v1/auth/register", models.RegisterRequest{
+		FirstName: faker.FirstName(),
+		LastName:  faker.LastName(),
+		Email:     address,
+		Password:  testPassword,
+	}, "")
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+func TestForgotPassword(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+
+	w := s.request(http.MethodPost, "/v1/auth/forgot-password", models.ForgotPasswordRequest{
+		Email: user.Email,
+	}, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	require.Equal(t, "Reset your password", s.lastEmail(user.Email).Subject)
+	code := s.code(user.Email)
+
+	w = s.request(http.MethodPost, "/v1/auth/verify-forgot-password", models.VerifyRequest{
+		Email: user.Email,
+		Code:  wrongCode(code),
+	}, "")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	var reset models.AuthResponse
+	decode(t, s.request(http.MethodPost, "/v1/auth/verify-forgot-password", models.VerifyRequest{
+		Email: user.Email,
+		Code:  code,
+	}, ""), http.StatusCreated, &reset)
+	require.Empty(t, reset.RefreshToken)
+
+	// the reset token only allows to set a new password
+	w = s.request(http.MethodGet, "/v1/users/me", nil, reset.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	newPassword := testPassword + "New"
+	w = s.request(http.MethodPost, "/v1/auth/update-password", models.UpdatePasswordRequest{
+		Password: newPassword,
+	}, reset.AccessToken)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/auth/login", models.LoginRequest{
+		Email:    user.Email,
+		Password: testPassword,
+	}, "")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	s.login(user.Email, newPassword)
+}
+
+// wrongCode returns a code different from code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
@@ -0,0 +1,222 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FailedAttemptsKey = "failed_attempts_"
+	LockoutKey        = "lockout_"
+	LockoutCountKey   = "lockout_count_"
+	CodeAttemptsKey   = "code_attempts_"
+
+	// lockoutCountDuration is how long the lockouts are remembered to
+	// increase the cooldown of the next one
+	lockoutCountDuration = 24 * time.Hour
+)
+
+// attemptKeys are the keys the failed attempts of an action are
+// counted by, one for the email tried from the client IP, one for the
+// client IP and one for the email from any IP
+type attemptKeys struct {
+	emailIP string
+	ip      string
+	email   string
+}
+
+func newAttemptKeys(c *gin.Context, action, email string) attemptKeys {
+	ip := c.ClientIP()
+
+	return attemptKeys{
+		emailIP: action + "_email_" + strings.ToLower(email) + "_ip_" + ip,
+		ip:      action + "_ip_" + ip,
+		email:   action + "_address_" + strings.ToLower(email),
+	}
+}
+
+// checkLockout returns how long the email is still locked out for the
+// client IP, or the client IP or the email are locked out altogether
+func (h *handlerV1) checkLockout(keys attemptKeys) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	for _, key := range []string{keys.emailIP, keys.ip, keys.email} {
+		exists, err := h.inMemory.Exists(LockoutKey + key)
+		if err != nil {
+			return 0, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		value, err := h.inMemory.Get(LockoutKey + key)
+		if err != nil {
+			// the lockout expired in between
+			continue
+		}
+
+		until, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		if d := time.Until(time.Unix(until, 0)); d > retryAfter {
+			retryAfter = d
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// recordFailedAttempt counts a failed attempt of the email from the client
+// IP, of the client IP and of the email and locks out the ones reaching
+// their limit. It returns the lockout duration if the attempt caused one
+func (h *handlerV1) recordFailedAttempt(keys attemptKeys) (time.Duration, error) {
+	cfg := h.cfg.BruteForce
+
+	var retryAfter time.Duration
+	for key, maxAttempts := range map[string]int64{
+		keys.emailIP: cfg.MaxAttempts,
+		keys.ip:      cfg.MaxAttemptsPerIP,
+		keys.email:   cfg.MaxAttemptsPerEmail,
+	} {
+		count, err := h.inMemory.Incr(FailedAttemptsKey+key, cfg.Window)
+		if err != nil {
+			return 0, err
+		}
+
+		if maxAttempts <= 0 || count < maxAttempts {
+			continue
+		}
+
+		_, err = h.inMemory.Delete(FailedAttemptsKey + key)
+		if err != nil {
+			return 0, err
+		}
+
+		lockouts, err := h.inMemory.Incr(LockoutCountKey+key, lockoutCountDuration)
+		if err != nil {
+			return 0, err
+		}
+
+		d := h.lockoutDuration(lockouts)
+		err = h.inMemory.Set(LockoutKey+key, strconv.FormatInt(time.Now().Add(d).Unix(), 10), d)
+		if err != nil {
+			return 0, err
+		}
+
+		if d > retryAfter {
+			retryAfter = d
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// resetFailedAttempts forgets the failed attempts of the email from the
+// client IP after a successful one. The attempts of the client IP and
+// of the email are kept, so an attacker can't reset them by logging into
+// an own account or waiting for the owner to log in
+func (h *handlerV1) resetFailedAttempts(keys attemptKeys) error {
+	_, err := h.inMemory.Delete(FailedAttemptsKey + keys.emailIP)
+	return err
+}
+
+// lockoutDuration doubles the cooldown with every lockout up to the maximum
+func (h *handlerV1) lockoutDuration(lockouts int64) time.Duration {
+	d := h.cfg.BruteForce.Lockout
+	for i := int64(1); i < lockouts && d < h.cfg.BruteForce.MaxLockout; i++ {
+		d *= 2
+	}
+
+	if max := h.cfg.BruteForce.MaxLockout; max > 0 && d > max {
+		d = max
+	}
+
+	return d
+}
+
+// recordWrongCode counts a wrong guess of the verification code stored
+// at codeKey and reports whether the code got invalidated
+func (h *handlerV1) recordWrongCode(codeKey string) (bool, error) {
+	count, err := h.inMemory.Incr(CodeAttemptsKey+codeKey, h.codeDuration)
+	if err != nil {
+		return false, err
+	}
+
+	maxAttempts := h.cfg.BruteForce.CodeMaxAttempts
+	if maxAttempts <= 0 || count < maxAttempts {
+		return false, nil
+	}
+
+	_, err = h.inMemory.Delete(codeKey)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = h.inMemory.Delete(CodeAttemptsKey + codeKey)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// wrongCredentials records a failed login and responds to it
+func (h *handlerV1) wrongCredentials(c *gin.Context, keys attemptKeys) {
+	h.failedAttempt(c, keys, ErrWrongEmailOrPass)
+}
+
+// failedAttempt records a failed attempt and responds with err or the lockout it caused
+func (h *handlerV1) failedAttempt(c *gin.Context, keys attemptKeys, failure error) {
+	retryAfter, err := h.recordFailedAttempt(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	c.JSON(http.StatusForbidden, errorResponse(failure))
+}
+
+// wrongCode records a wrong guess of the code stored at codeKey and responds to it
+func (h *handlerV1) wrongCode(c *gin.Context, keys attemptKeys, codeKey string) {
+	retryAfter, err := h.recordFailedAttempt(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	invalidated, err := h.recordWrongCode(codeKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	if invalidated {
+		c.JSON(http.StatusForbidden, errorResponse(ErrCodeInvalidated))
+		return
+	}
+
+	c.JSON(http.StatusForbidden, errorResponse(ErrIncorrectCode))
+}
+
+func tooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusTooManyRequests, errorResponse(ErrTooManyAttempts))
+}
@@ -0,0 +1,135 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/config"
+	"github.com/bxcodec/faker/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func bruteForceConfig(maxAttempts, maxAttemptsPerIP int64) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.BruteForce = config.BruteForce{
+			MaxAttempts:      maxAttempts,
+			MaxAttemptsPerIP: maxAttemptsPerIP,
+			Window:           15 * time.Minute,
+			Lockout:          time.Minute,
+			MaxLockout:       time.Hour,
+		}
+	}
+}
+
+// loginFrom tries to log in from the remote address, forwarded for the
+// forwardedFor IP unless it is empty
+func (s *testServer) loginFrom(remoteAddr, forwardedFor, address, password string) *http.Response {
+	req := s.newRequest(http.MethodPost, "/v1/auth/login", models.LoginRequest{
+		Email:    address,
+		Password: password,
+	}, "")
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	return s.send(req).Result()
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, bruteForceConfig(3, 0))
+	user := s.createUser()
+
+	for i := 0; i < 2; i++ {
+		resp := s.loginFrom("192.0.2.1:1234", "", user.Email, "wrong")
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	resp := s.loginFrom("192.0.2.1:1234", "", user.Email, "wrong")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	// the right password is refused too while locked out
+	resp = s.loginFrom("192.0.2.1:1234", "", user.Email, testPassword)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// the owner can still log in from another IP
+	resp = s.loginFrom("198.51.100.1:1234", "", user.Email, testPassword)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestLoginResetsFailedAttempts(t *testing.T) {
+	s := newTestServer(t, bruteForceConfig(3, 0))
+	user := s.createUser()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			resp := s.loginFrom("192.0.2.1:1234", "", user.Email, "wrong")
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		}
+
+		resp := s.loginFrom("192.0.2.1:1234", "", user.Email, testPassword)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	s := newTestServer(t, bruteForceConfig(0, 3))
+
+	// untrusted X-Forwarded-For headers don't change the client IP
+	for i, forwardedFor := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		resp := s.loginFrom("192.0.2.1:1234", forwardedFor, faker.Email(), "wrong")
+		if i < 2 {
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		} else {
+			require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		}
+	}
+
+	resp := s.loginFrom("198.51.100.1:1234", "", faker.Email(), "wrong")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestLoginLockoutTrustedProxy(t *testing.T) {
+	s := newTestServer(t, bruteForceConfig(0, 3), func(cfg *config.Config) {
+		cfg.TrustedProxies = []string{"192.0.2.1"}
+	})
+
+	for i := 0; i < 3; i++ {
+		s.loginFrom("192.0.2.1:1234", "203.0.113.1", faker.Email(), "wrong")
+	}
+
+	resp := s.loginFrom("192.0.2.1:1234", "203.0.113.1", faker.Email(), "wrong")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// clients behind the proxy are told apart by the forwarded IP
+	resp = s.loginFrom("192.0.2.1:1234", "203.0.113.2", faker.Email(), "wrong")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestLoginLockoutPerEmail(t *testing.T) {
+	s := newTestServer(t, bruteForceConfig(3, 0), func(cfg *config.Config) {
+		cfg.BruteForce.MaxAttemptsPerEmail = 5
+	})
+	user := s.createUser()
+
+	// an attacker spread over many IPs stays below the limit of each IP
+	for i := 1; i <= 5; i++ {
+		resp := s.loginFrom(fmt.Sprintf("198.51.100.%d:1234", i), "", user.Email, "wrong")
+		if i < 5 {
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		} else {
+			require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		}
+	}
+
+	resp := s.loginFrom("198.51.100.6:1234", "", user.Email, testPassword)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// other accounts can still log in from the same IPs
+	resp = s.loginFrom("198.51.100.1:1234", "", s.createUser().Email, testPassword)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
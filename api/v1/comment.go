@@ -1,23 +1,35 @@
 package v1
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/rbac"
+	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	deletedCommentPlaceholder = "[deleted]"
+	defaultCommentsDepth      = 3
+	maxCommentsDepth          = 10
+)
+
 // @Security ApiKeyAuth
 // @Router /comments [post]
 // @Summary Create a comment
-// @Description Create a comment
+// @Description Create a comment or a reply to another comment of the same post
 // @Tags comment
 // @Accept json
 // @Produce json
 // @Param comment body models.CreateCommentRequest true "comment"
 // @Success 201 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreateComment(c *gin.Context) {
 	var (
@@ -36,9 +48,27 @@ func (h *handlerV1) CreateComment(c *gin.Context) {
 		return
 	}
 
+	if _, ok := h.getVisiblePostByID(c, req.PostID); !ok {
+		return
+	}
+
+	if req.ParentID != nil {
+		parent, err := h.storage.Comment().Get(*req.ParentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if parent == nil || parent.PostID != req.PostID || parent.DeletedAt != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidParentComment))
+			return
+		}
+	}
+
 	resp, err := h.storage.Comment().Create(&repo.Comment{
 		Description: req.Description,
 		PostID:      req.PostID,
+		ParentID:    req.ParentID,
 		UserID:      payload.UserID,
 	})
 	if err != nil {
@@ -52,12 +82,17 @@ func (h *handlerV1) CreateComment(c *gin.Context) {
 
 // @Router /comments [get]
 // @Summary Get all comments
-// @Description Get all comments
+// @Description Get all comments. Filtering by post_id or parent_id only (without user_id)
+// @Description returns a thread: top level comments with their replies nested down to depth levels.
+// @Description Pass next_cursor or prev_cursor of a response as cursor to paginate by cursor.
+// @Description Comments of drafts are listed only to their author
 // @Tags comment
 // @Accept json
 // @Produce json
 // @Param filter query models.GetAllCommentsParams false "Filter"
 // @Success 200 {object} models.GetAllCommentsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetAllComments(c *gin.Context) {
 	req, err := validateGetAllCommentsParams(c)
@@ -66,26 +101,192 @@ func (h *handlerV1) GetAllComments(c *gin.Context) {
 		return
 	}
 
+	cursor, err := decodeCursor(req.Cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if req.PostID != 0 {
+		if _, ok := h.getVisiblePostByID(c, req.PostID); !ok {
+			return
+		}
+	}
+
+	threaded := req.UserID == 0 && (req.PostID != 0 || req.ParentID != 0)
+
 	result, err := h.storage.Comment().GetAll(&repo.GetAllCommentsParams{
-		Page:   req.Page,
-		Limit:  req.Limit,
-		UserID: req.UserID,
-		PostID: req.PostID,
+		Page:     req.Page,
+		Limit:    req.Limit,
+		UserID:   req.UserID,
+		PostID:   req.PostID,
+		ParentID: req.ParentID,
+		RootOnly: threaded && req.ParentID == 0,
+		Cursor:   cursor,
+		ViewerID: viewerID(h.viewer(c)),
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, getCommentsResponse(result))
+	response := getCommentsResponse(result, cursor, req.Page)
+
+	if threaded && req.Depth > 1 && len(result.Comments) > 0 {
+		ids := make([]int64, 0, len(result.Comments))
+		for _, comment := range result.Comments {
+			ids = append(ids, comment.ID)
+		}
+
+		replies, err := h.storage.Comment().GetReplies(ids, req.Depth-1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		attachReplies(response.Comments, replies)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /comments/{id} [put]
+// @Summary Update a comment
+// @Description Update a comment. Only the comment author, the post author or a superadmin can update it
+// @Tags comment
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param comment body models.UpdateCommentRequest true "comment"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateComment(c *gin.Context) {
+	var (
+		req models.UpdateCommentRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	comment, err := h.storage.Comment().Get(int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !canModifyComment(payload, comment) {
+		c.JSON(http.StatusForbidden, errorResponse(ErrForbidden))
+		return
+	}
+
+	comment.Description = req.Description
+	resp, err := h.storage.Comment().Update(comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parseCommentModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /comments/{id} [delete]
+// @Summary Delete a comment
+// @Description Delete a comment. Only the comment author, the post author or a superadmin can delete it.
+// @Description A comment with replies is replaced by a "[deleted]" placeholder, which is
+// @Description removed along with its last reply
+// @Tags comment
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteComment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	comment, err := h.storage.Comment().Get(int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !canModifyComment(payload, comment) {
+		c.JSON(http.StatusForbidden, errorResponse(ErrForbidden))
+		return
+	}
+
+	err = h.storage.Comment().Delete(comment.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
+}
+
+func canModifyComment(payload *utils.Payload, comment *repo.Comment) bool {
+	return comment.UserID == payload.UserID ||
+		comment.Post.UserID == payload.UserID ||
+		rbac.Can(payload.UserType, rbac.ModerateComments)
 }
 
 func validateGetAllCommentsParams(c *gin.Context) (*models.GetAllCommentsParams, error) {
 	var (
-		limit          int = 10
-		page           int = 1
-		err            error
-		userID, postID int
+		limit                    int = 10
+		page                     int = 1
+		depth                    int = defaultCommentsDepth
+		err                      error
+		userID, postID, parentID int
 	)
 
 	if c.Query("limit") != "" {
@@ -116,15 +317,40 @@ func validateGetAllCommentsParams(c *gin.Context) (*models.GetAllCommentsParams,
 		}
 	}
 
+	if c.Query("parent_id") != "" {
+		parentID, err = strconv.Atoi(c.Query("parent_id"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Query("depth") != "" {
+		depth, err = strconv.Atoi(c.Query("depth"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if depth < 1 {
+		depth = 1
+	}
+
+	if depth > maxCommentsDepth {
+		depth = maxCommentsDepth
+	}
+
 	return &models.GetAllCommentsParams{
-		Limit:  int32(limit),
-		Page:   int32(page),
-		UserID: int64(userID),
-		PostID: int64(postID),
+		Limit:    int32(limit),
+		Page:     int32(page),
+		UserID:   int64(userID),
+		PostID:   int64(postID),
+		ParentID: int64(parentID),
+		Depth:    int32(depth),
+		Cursor:   c.Query("cursor"),
 	}, nil
 }
 
-func getCommentsResponse(data *repo.GetAllCommentsResult) *models.GetAllCommentsResponse {
+func getCommentsResponse(data *repo.GetAllCommentsResult, cursor *repo.Cursor, page int32) *models.GetAllCommentsResponse {
 	response := models.GetAllCommentsResponse{
 		Comments: make([]*models.Comment, 0),
 		Count:    data.Count,
@@ -135,17 +361,51 @@ func getCommentsResponse(data *repo.GetAllCommentsResult) *models.GetAllComments
 		response.Comments = append(response.Comments, &p)
 	}
 
+	if len(data.Comments) > 0 {
+		first, last := data.Comments[0], data.Comments[len(data.Comments)-1]
+		response.NextCursor, response.PrevCursor = listingCursors(
+			cursor, page, data.HasMore,
+			repo.Cursor{CreatedAt: first.CreatedAt, ID: first.ID},
+			repo.Cursor{CreatedAt: last.CreatedAt, ID: last.ID},
+		)
+	}
+
 	return &response
 }
 
+// attachReplies nests replies under their parents, oldest reply first
+func attachReplies(roots []*models.Comment, replies []*repo.Comment) {
+	comments := make(map[int64]*models.Comment, len(roots)+len(replies))
+	for _, root := range roots {
+		comments[root.ID] = root
+	}
+
+	parsed := make([]*models.Comment, 0, len(replies))
+	for _, reply := range replies {
+		r := parseCommentModel(reply)
+		comments[r.ID] = &r
+		parsed = append(parsed, &r)
+	}
+
+	for _, reply := range parsed {
+		parent, ok := comments[*reply.ParentID]
+		if !ok {
+			continue
+		}
+		parent.Replies = append(parent.Replies, reply)
+	}
+}
+
 func parseCommentModel(comment *repo.Comment) models.Comment {
-	return models.Comment{
-		ID:          comment.ID,
-		UserID:      comment.UserID,
-		PostID:      comment.PostID,
-		Description: comment.Description,
-		CreatedAt:   comment.CreatedAt,
-		UpdatedAt:   comment.UpdatedAt,
+	result := models.Comment{
+		ID:           comment.ID,
+		UserID:       comment.UserID,
+		PostID:       comment.PostID,
+		ParentID:     comment.ParentID,
+		Description:  comment.Description,
+		CreatedAt:    comment.CreatedAt,
+		UpdatedAt:    comment.UpdatedAt,
+		RepliesCount: comment.RepliesCount,
 		User: &models.CommentUser{
 			ID:              comment.UserID,
 			FirstName:       comment.User.FirstName,
@@ -154,4 +414,13 @@ func parseCommentModel(comment *repo.Comment) models.Comment {
 			ProfileImageUrl: comment.User.ProfileImageUrl,
 		},
 	}
+
+	if comment.DeletedAt != nil {
+		result.Description = deletedCommentPlaceholder
+		result.IsDeleted = true
+		result.UserID = 0
+		result.User = nil
+	}
+
+	return result
 }
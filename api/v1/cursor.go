@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+// cursor is the opaque keyset pagination cursor handed out to clients
+type cursor struct {
+	CreatedAt int64 `json:"t"`
+	ID        int64 `json:"id"`
+	Backward  bool  `json:"b,omitempty"`
+}
+
+func encodeCursor(createdAt time.Time, id int64, backward bool) *string {
+	data, _ := json.Marshal(cursor{
+		CreatedAt: createdAt.UnixMicro(),
+		ID:        id,
+		Backward:  backward,
+	})
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return &encoded
+}
+
+// decodeCursor parses a cursor query value, an empty value means page mode
+func decodeCursor(value string) (*repo.Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &repo.Cursor{
+		CreatedAt: time.UnixMicro(c.CreatedAt).UTC(),
+		ID:        c.ID,
+		Backward:  c.Backward,
+	}, nil
+}
+
+// listingCursors returns the cursors of the pages around a non empty
+// listing fetched with the params cursor or page
+func listingCursors(params *repo.Cursor, page int32, hasMore bool, first, last repo.Cursor) (next, prev *string) {
+	hasNext, hasPrev := hasMore, params != nil || page > 1
+	if params != nil && params.Backward {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if hasNext {
+		next = encodeCursor(last.CreatedAt, last.ID, false)
+	}
+
+	if hasPrev {
+		prev = encodeCursor(first.CreatedAt, first.ID, true)
+	}
+
+	return next, prev
+}
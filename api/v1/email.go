@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	emailPkg "github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/storage"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// resendLease keeps the workers away from an email while it is resent
+const resendLease = time.Minute
+
+// @Security ApiKeyAuth
+// @Router /admin/emails [get]
+// @Summary Get all outbox emails
+// @Description Get all outbox emails, newest first. Only for superadmins
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param filter query models.GetAllEmailsParams false "Filter"
+// @Success 200 {object} models.GetAllEmailsResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllEmails(c *gin.Context) {
+	req, err := validateGetAllParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", repo.EmailStatusPending, repo.EmailStatusSent, repo.EmailStatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidEmailStatus))
+		return
+	}
+
+	result, err := h.storage.EmailOutbox().GetAll(&repo.GetAllEmailsParams{
+		Page:   req.Page,
+		Limit:  req.Limit,
+		Status: status,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	response := models.GetAllEmailsResponse{
+		Emails: make([]*models.OutboxEmail, 0),
+		Count:  result.Count,
+	}
+	for _, e := range result.Emails {
+		response.Emails = append(response.Emails, parseOutboxEmailModel(e))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /admin/emails/{id}/resend [post]
+// @Summary Resend an outbox email
+// @Description Send a failed outbox email again right away. Emails whose code has expired
+// @Description cannot be resent, the user has to request a new code. Only for superadmins
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.OutboxEmail
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+func (h *handlerV1) ResendEmail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	outbox := h.storage.EmailOutbox()
+	e, err := outbox.Get(int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if e.Status != repo.EmailStatusFailed {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrEmailNotFailed))
+		return
+	}
+
+	msg, err := emailPkg.RenderWithSecrets(storage.OutboxEmailRequest(e), storage.NewEmailSecrets(h.inMemory))
+	if errors.Is(err, emailPkg.ErrSecretExpired) {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrEmailExpired))
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the status is checked again by the claim, so a concurrent resend
+	// doesn't send the email twice
+	_, err = outbox.ClaimFailed(e.ID, time.Now(), resendLease)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrEmailNotFailed))
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	sendErr := h.emailSender.Send(msg)
+	if sendErr != nil {
+		err = outbox.MarkFailed(e.ID, sendErr.Error(), nil)
+	} else {
+		err = outbox.MarkSent(e.ID, time.Now())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if sendErr != nil {
+		c.JSON(http.StatusBadGateway, errorResponse(sendErr))
+		return
+	}
+
+	e, err = outbox.Get(e.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parseOutboxEmailModel(e))
+}
+
+func parseOutboxEmailModel(e *repo.OutboxEmail) *models.OutboxEmail {
+	return &models.OutboxEmail{
+		ID:            e.ID,
+		To:            e.To,
+		Subject:       e.Subject,
+		Status:        e.Status,
+		Attempts:      e.Attempts,
+		LastError:     e.LastError,
+		NextAttemptAt: e.NextAttemptAt,
+		CreatedAt:     e.CreatedAt,
+		SentAt:        e.SentAt,
+	}
+}
@@ -0,0 +1,43 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	v1 "github.com/TemurMannonov/blog/api/v1"
+	"github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResendEmail(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createUserOfType(repo.UserTypeSuperadmin)
+	accessToken := s.login(admin.Email, testPassword).AccessToken
+
+	queued, err := s.storage.EmailOutbox().Create(&repo.OutboxEmail{
+		To:      []string{"resend@example.com"},
+		Subject: "Your email has been changed",
+		Type:    email.EmailChangedEmail,
+		Body:    map[string]string{"new_email": "resend@example.com"},
+	})
+	require.NoError(t, err)
+	path := fmt.Sprintf("/v1/admin/emails/%d/resend", queued.ID)
+
+	// a pending email may already be claimed by a worker
+	w := s.request(http.MethodPost, path, nil, accessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), v1.ErrEmailNotFailed.Error())
+
+	require.NoError(t, s.storage.EmailOutbox().MarkFailed(queued.ID, "mailbox unavailable", nil))
+
+	var resent models.OutboxEmail
+	decode(t, s.request(http.MethodPost, path, nil, accessToken), http.StatusOK, &resent)
+	require.Equal(t, repo.EmailStatusSent, resent.Status)
+	require.Len(t, s.emails("resend@example.com"), 1)
+
+	w = s.request(http.MethodPost, path, nil, accessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
@@ -2,40 +2,91 @@ package v1
 
 import (
 	"errors"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/TemurMannonov/blog/api/models"
 	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/pkg/oidc"
+	"github.com/TemurMannonov/blog/pkg/ratelimit"
+	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/TemurMannonov/blog/storage"
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	ErrWrongEmailOrPass = errors.New("wrong email or password")
-	ErrEmailExists      = errors.New("email already exists")
-	ErrUserNotVerified  = errors.New("user not verified")
-	ErrIncorrectCode    = errors.New("incorrect verification code")
-	ErrCodeExpired      = errors.New("verification code has been expired")
-	ErrForbidden        = errors.New("forbidden")
+	ErrWrongEmailOrPass   = errors.New("wrong email or password")
+	ErrEmailExists        = errors.New("email already exists")
+	ErrUserNotVerified    = errors.New("user not verified")
+	ErrIncorrectCode      = errors.New("incorrect verification code")
+	ErrCodeExpired        = errors.New("verification code has been expired")
+	ErrForbidden          = errors.New("forbidden")
+	ErrTokenRevoked       = errors.New("token has been revoked")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	ErrTooManyAttempts    = errors.New("too many failed attempts, try again later")
+	ErrTooManyRequests    = errors.New("too many requests, try again later")
+	ErrCodeInvalidated    = errors.New("too many incorrect codes, request a new verification code")
+	ErrWrongPassword      = errors.New("wrong current password")
+	ErrCurrentPassword    = errors.New("current_password is required")
+
+	ErrTwoFactorEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorDisabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled  = errors.New("two-factor enrollment has expired, start it again")
+	ErrIncorrectRecoveryCode = errors.New("incorrect recovery code")
+	ErrInvalidScope          = errors.New("unknown token scope")
+	ErrMissingScope          = errors.New("token is missing the scope of this route")
+
+	ErrInvalidParentComment = errors.New("parent comment not found in this post")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrInvalidPublishAt     = errors.New("publish_at must be in the future for scheduled posts")
+	ErrInvalidEmailStatus   = errors.New("status must be one of pending, sent or failed")
+	ErrEmailNotFailed       = errors.New("only failed emails can be resent")
+	ErrEmailExpired         = errors.New("code of the email has expired, a new one has to be requested")
 )
 
 type handlerV1 struct {
-	cfg      *config.Config
-	storage  storage.StorageI
-	inMemory storage.InMemoryStorageI
+	cfg         *config.Config
+	storage     storage.StorageI
+	inMemory    storage.InMemoryStorageI
+	emailSender email.Sender
+	limiter     *ratelimit.Limiter
+	password    *utils.PasswordPolicy
+	keys        *utils.KeyRing
+	oidc        map[string]*oidc.Provider
+	// codeDuration is how long verification codes are valid. It outlasts
+	// the outbox retries, so a code that is delivered late still works
+	codeDuration time.Duration
 }
 
 type HandlerV1Options struct {
-	Cfg      *config.Config
-	Storage  storage.StorageI
-	InMemory storage.InMemoryStorageI
+	Cfg            *config.Config
+	Storage        storage.StorageI
+	InMemory       storage.InMemoryStorageI
+	EmailSender    email.Sender
+	PasswordPolicy *utils.PasswordPolicy
+	KeyRing        *utils.KeyRing
 }
 
 func New(options *HandlerV1Options) *handlerV1 {
+	codeDuration := email.NewOutboxOptions(options.Cfg.EmailOutbox).RetryWindow()
+	if codeDuration < verificationCodeDuration {
+		codeDuration = verificationCodeDuration
+	}
+
 	return &handlerV1{
-		cfg:      options.Cfg,
-		storage:  options.Storage,
-		inMemory: options.InMemory,
+		cfg:         options.Cfg,
+		storage:     options.Storage,
+		inMemory:    options.InMemory,
+		emailSender: options.EmailSender,
+		limiter:     ratelimit.New(options.InMemory),
+		password:    options.PasswordPolicy,
+		keys:        options.KeyRing,
+		oidc: oidc.NewProviders(options.Cfg.OIDC, &http.Client{
+			Timeout: 10 * time.Second,
+		}),
+		codeDuration: codeDuration,
 	}
 }
 
@@ -0,0 +1,204 @@
+package v1_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/api"
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/TemurMannonov/blog/storage"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/bxcodec/faker/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "Secret123"
+
+var codePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// testServer runs the api on the in-memory storage and sends the emails
+// of the outbox to a CaptureSender
+type testServer struct {
+	t        *testing.T
+	cfg      *config.Config
+	router   *gin.Engine
+	storage  storage.StorageI
+	inMemory storage.InMemoryStorageI
+	keys     *utils.KeyRing
+	sender   *email.CaptureSender
+	outbox   *email.OutboxWorker
+}
+
+func newTestServer(t *testing.T, configure ...func(cfg *config.Config)) *testServer {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+
+	cfg := config.Load("/nonexistent")
+	cfg.AuthSecretKey = "test_secret_key"
+	cfg.JWT = config.JWT{}
+	cfg.OIDC = nil
+	cfg.RateLimits = config.RateLimits{}
+	cfg.Password.BreachedFile = ""
+	for _, f := range configure {
+		f(&cfg)
+	}
+
+	keys, err := utils.NewKeyRing(cfg.JWT, cfg.AuthSecretKey)
+	require.NoError(t, err)
+
+	policy, err := utils.NewPasswordPolicy(cfg.Password)
+	require.NoError(t, err)
+
+	s := &testServer{
+		t:        t,
+		cfg:      &cfg,
+		storage:  storage.NewStorageMemory(),
+		inMemory: storage.NewInMemoryStorageLocal(),
+		keys:     keys,
+		sender:   email.NewCaptureSender(),
+	}
+
+	s.outbox = email.NewOutboxWorker(
+		storage.NewEmailOutbox(s.storage.EmailOutbox()),
+		storage.NewEmailSecrets(s.inMemory),
+		s.sender,
+		email.OutboxOptions{},
+	)
+	s.router, err = api.New(&api.RouterOptions{
+		Cfg:            s.cfg,
+		Storage:        s.storage,
+		InMemory:       s.inMemory,
+		EmailSender:    s.sender,
+		PasswordPolicy: policy,
+		KeyRing:        keys,
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+// request sends body as JSON, authorized with token unless it is empty
+func (s *testServer) request(method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	return s.send(s.newRequest(method, path, body, token))
+}
+
+// newRequest builds the request sent by request, from the peer address
+// 192.0.2.1 of httptest
+func (s *testServer) newRequest(method, path string, body interface{}, token string) *http.Request {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(s.t, err)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	return req
+}
+
+func (s *testServer) send(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	return w
+}
+
+// decode decodes the JSON response into v, checking its status first
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	require.Equal(t, status, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+}
+
+// emails sends the due emails of the outbox and returns the emails sent
+// to the address so far, oldest first
+func (s *testServer) emails(address string) []*email.Message {
+	require.NoError(s.t, s.outbox.ProcessDue(time.Now().Add(time.Second)))
+
+	result := make([]*email.Message, 0)
+	for _, msg := range s.sender.Messages() {
+		for _, to := range msg.To {
+			if to == address {
+				result = append(result, msg)
+			}
+		}
+	}
+
+	return result
+}
+
+// lastEmail returns the latest email sent to the address
+func (s *testServer) lastEmail(address string) *email.Message {
+	emails := s.emails(address)
+	require.NotEmpty(s.t, emails, "no email sent to %s", address)
+
+	return emails[len(emails)-1]
+}
+
+// code returns the verification code of the latest email sent to the address
+func (s *testServer) code(address string) string {
+	code := codePattern.FindString(s.lastEmail(address).Text)
+	require.NotEmpty(s.t, code)
+
+	return code
+}
+
+// createUser creates an author with testPassword
+func (s *testServer) createUser() *repo.User {
+	return s.createUserOfType(repo.UserTypeAuthor)
+}
+
+// createUserOfType creates a user of the type with testPassword
+func (s *testServer) createUserOfType(userType string) *repo.User {
+	hash, err := utils.HashPassword(testPassword)
+	require.NoError(s.t, err)
+
+	user, err := s.storage.User().Create(&repo.User{
+		FirstName: faker.FirstName(),
+		LastName:  faker.LastName(),
+		Email:     faker.Email(),
+		Password:  hash,
+		Type:      userType,
+	})
+	require.NoError(s.t, err)
+
+	return user
+}
+
+// login logs the user in with the password
+func (s *testServer) login(address, password string) *models.AuthResponse {
+	var resp models.AuthResponse
+	decode(s.t, s.request(http.MethodPost, "/v1/auth/login", models.LoginRequest{
+		Email:    address,
+		Password: password,
+	}, ""), http.StatusCreated, &resp)
+
+	return &resp
+}
+
+// createAPIToken creates a personal access token with the scopes for the
+// user logged in with accessToken
+func (s *testServer) createAPIToken(accessToken string, scopes ...string) string {
+	var resp models.CreateAPITokenResponse
+	decode(s.t, s.request(http.MethodPost, "/v1/users/me/tokens", models.CreateAPITokenRequest{
+		Name:          faker.Word(),
+		Scopes:        scopes,
+		ExpiresInDays: 30,
+	}, accessToken), http.StatusCreated, &resp)
+
+	return resp.Token
+}
@@ -0,0 +1,18 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jwksMaxAge is how long verifiers may cache the keys. A new key has to be
+// published for as long before it starts signing
+const jwksMaxAge = "max-age=300"
+
+// GetJWKS serves the public keys verifying the tokens at
+// /.well-known/jwks.json, outside of the /v1 api
+func (h *handlerV1) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, "+jwksMaxAge)
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
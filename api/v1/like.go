@@ -18,6 +18,8 @@ import (
 // @Produce json
 // @Param like body models.CreateOrUpdateLikeRequest true "like"
 // @Success 201 {object} models.Like
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreateOrUpdateLike(c *gin.Context) {
 	var (
@@ -36,6 +38,10 @@ func (h *handlerV1) CreateOrUpdateLike(c *gin.Context) {
 		return
 	}
 
+	if _, ok := h.getVisiblePostByID(c, req.PostID); !ok {
+		return
+	}
+
 	err = h.storage.Like().CreateOrUpdate(&repo.Like{
 		UserID: payload.UserID,
 		PostID: req.PostID,
@@ -0,0 +1,247 @@
+package v1
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	emailPkg "github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MagicLinkKey     = "magic_link_"
+	MagicLinkSentKey = "magic_link_sent_"
+
+	// magicLinkResendInterval limits the links emailed to an address
+	magicLinkResendInterval = time.Minute
+)
+
+var ErrMagicLinkUsed = errors.New("login link has already been used or has expired")
+
+// magicLinkPage asks to confirm the login before the token is posted, so
+// mail scanners opening the link don't use it up
+var magicLinkPage = template.Must(template.New("magic_link").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Log in</title>
+</head>
+<body>
+<form method="post" action="{{ .Action }}">
+<input type="hidden" name="token" value="{{ .Token }}">
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// @Router /auth/magic-link [post]
+// @Summary Email a login link
+// @Description Email a link logging in without a password. The response is the same
+// @Description for unknown emails, and a new link is sent at most once a minute
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body models.MagicLinkRequest true "Data"
+// @Success 201 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) SendMagicLink(c *gin.Context) {
+	var (
+		req models.MagicLinkRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	err = h.sendMagicLink(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ResponseOK{
+		Message: "If the email is registered, a login link has been sent!",
+	})
+}
+
+// sendMagicLink emails a login link to the user of the email, if there is one
+func (h *handlerV1) sendMagicLink(email string) error {
+	user, err := h.storage.User().GetByEmail(email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	count, err := h.inMemory.Incr(MagicLinkSentKey+user.Email, magicLinkResendInterval)
+	if err != nil || count > 1 {
+		return err
+	}
+
+	token, payload, err := utils.CreateToken(h.keys, &utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypeMagicLink,
+		Duration:  h.cfg.MagicLink.Duration,
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(h.cfg.MagicLink.URL)
+	if err != nil {
+		return err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	// the link is kept until it is used or expires, the outbox only
+	// holds its key
+	linkKey := MagicLinkKey + payload.ID.String()
+	err = h.inMemory.Set(linkKey, link.String(), h.cfg.MagicLink.Duration)
+	if err != nil {
+		return err
+	}
+
+	return h.queueEmail(&emailPkg.SendEmailRequest{
+		To: []string{user.Email},
+		Body: map[string]string{
+			"expires_in": fmt.Sprintf("%d minutes", int(h.cfg.MagicLink.Duration.Minutes())),
+		},
+		Secrets: map[string]string{
+			"link": linkKey,
+		},
+		Type: emailPkg.MagicLinkEmail,
+	})
+}
+
+// @Router /auth/magic-link/consume [get]
+// @Summary Confirm a login link
+// @Description The page the emailed login links open by default. It doesn't log in, but
+// @Description posts the token of the link to the consume route once the user confirms
+// @Tags auth
+// @Produce html
+// @Param token query string true "Token"
+// @Success 200 {string} string "Confirm page"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ConfirmMagicLink(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, errorResponse(errors.New("token is required")))
+		return
+	}
+
+	var page bytes.Buffer
+	err := magicLinkPage.Execute(&page, map[string]string{
+		"Action": c.Request.URL.Path,
+		"Token":  token,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the token is in the URL of the page
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// @Router /auth/magic-link/consume [post]
+// @Summary Log in with a login link
+// @Description Exchange the token of an emailed login link for a login. The token is
+// @Description posted as JSON or by the form of the confirm page. A link works once
+// @Tags auth
+// @Accept json,x-www-form-urlencoded
+// @Produce json
+// @Param data body models.ConsumeMagicLinkRequest true "Data"
+// @Success 201 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ConsumeMagicLink(c *gin.Context) {
+	var (
+		req models.ConsumeMagicLinkRequest
+	)
+
+	err := c.ShouldBind(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	h.consumeMagicLink(c, req.Token)
+}
+
+func (h *handlerV1) consumeMagicLink(c *gin.Context, token string) {
+	payload, err := utils.VerifyToken(h.keys, token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if payload.TokenType != utils.TokenTypeMagicLink {
+		c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+		return
+	}
+
+	revoked, err := h.isTokenRevoked(payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if revoked {
+		c.JSON(http.StatusUnauthorized, errorResponse(ErrTokenRevoked))
+		return
+	}
+
+	existed, err := h.inMemory.Delete(MagicLinkKey + payload.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !existed {
+		c.JSON(http.StatusUnauthorized, errorResponse(ErrMagicLinkUsed))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the link was sent to the email of the token
+	if user.Email != payload.Email {
+		c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+		return
+	}
+
+	h.login(c, user)
+}
@@ -0,0 +1,152 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	v1 "github.com/TemurMannonov/blog/api/v1"
+	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// magicLink requests a login link for the address and returns the token
+// of the emailed link
+func (s *testServer) magicLink(address string) string {
+	w := s.request(http.MethodPost, "/v1/auth/magic-link", models.MagicLinkRequest{
+		Email: address,
+	}, "")
+	require.Equal(s.t, http.StatusCreated, w.Code, w.Body.String())
+
+	link, err := url.Parse(linkPattern.FindString(s.lastEmail(address).Text))
+	require.NoError(s.t, err)
+	require.Equal(s.t, s.cfg.MagicLink.URL, link.Scheme+"://"+link.Host+link.Path)
+
+	token := link.Query().Get("token")
+	require.NotEmpty(s.t, token)
+	return token
+}
+
+func (s *testServer) consumeMagicLink(token string) *models.AuthResponse {
+	var resp models.AuthResponse
+	decode(s.t, s.request(http.MethodPost, "/v1/auth/magic-link/consume", models.ConsumeMagicLinkRequest{
+		Token: token,
+	}, ""), http.StatusCreated, &resp)
+
+	return &resp
+}
+
+func TestMagicLink(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+
+	token := s.magicLink(user.Email)
+
+	// the outbox only keeps the key the link is looked up by
+	queued, err := s.storage.EmailOutbox().GetAll(&repo.GetAllEmailsParams{Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Len(t, queued.Emails, 1)
+	require.NotContains(t, fmt.Sprint(*queued.Emails[0]), token)
+
+	resp := s.consumeMagicLink(token)
+	require.Equal(t, user.Email, resp.Email)
+
+	w := s.request(http.MethodGet, "/v1/users/me", nil, resp.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestMagicLinkReuse(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+
+	token := s.magicLink(user.Email)
+	s.consumeMagicLink(token)
+
+	w := s.request(http.MethodPost, "/v1/auth/magic-link/consume", models.ConsumeMagicLinkRequest{
+		Token: token,
+	}, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), v1.ErrMagicLinkUsed.Error())
+}
+
+func TestMagicLinkExpired(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+
+	token, _, err := utils.CreateToken(s.keys, &utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypeMagicLink,
+		Duration:  -time.Minute,
+	})
+	require.NoError(t, err)
+
+	w := s.request(http.MethodPost, "/v1/auth/magic-link/consume", models.ConsumeMagicLinkRequest{
+		Token: token,
+	}, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), utils.ErrExpiredToken.Error())
+
+	// a valid token whose link has expired from the storage
+	token, _, err = utils.CreateToken(s.keys, &utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypeMagicLink,
+		Duration:  time.Minute,
+	})
+	require.NoError(t, err)
+
+	w = s.request(http.MethodPost, "/v1/auth/magic-link/consume", models.ConsumeMagicLinkRequest{
+		Token: token,
+	}, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), v1.ErrMagicLinkUsed.Error())
+}
+
+func TestMagicLinkUnknownEmail(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.request(http.MethodPost, "/v1/auth/magic-link", models.MagicLinkRequest{
+		Email: "nobody@example.com",
+	}, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.Empty(t, s.emails("nobody@example.com"))
+}
+
+func TestMagicLinkConfirmPage(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	token := s.magicLink(user.Email)
+
+	// a mail scanner opening the link gets the page and doesn't use it up
+	for i := 0; i < 2; i++ {
+		w := s.request(http.MethodGet, "/v1/auth/magic-link/consume?token="+url.QueryEscape(token), nil, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		require.Contains(t, w.Body.String(), `method="post"`)
+		require.Contains(t, w.Body.String(), token)
+	}
+
+	// the form of the page posts the token
+	form := url.Values{"token": {token}}
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/magic-link/consume", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp models.AuthResponse
+	decode(t, s.send(req), http.StatusCreated, &resp)
+	require.Equal(t, user.Email, resp.Email)
+
+	w := s.request(http.MethodGet, "/v1/auth/magic-link/consume", nil, "")
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
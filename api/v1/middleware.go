@@ -3,7 +3,11 @@ package v1
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/rbac"
 	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -13,7 +17,34 @@ const (
 	authorizationPayloadKey = "authorization_payload"
 )
 
-func (h *handlerV1) AuthMiddleware(c *gin.Context) {
+// AuthMiddleware authenticates access tokens and the personal access tokens
+// having the scope of the route. Routes without a scope use
+// SessionAuthMiddleware, which refuses personal access tokens
+func (h *handlerV1) AuthMiddleware(scope rbac.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isAPIToken(c.GetHeader(authorizationHeaderKey)) {
+			h.apiTokenAuth(c, scope)
+			return
+		}
+
+		h.authenticate(c, utils.TokenTypeAccess)
+	}
+}
+
+// SessionAuthMiddleware only accepts the access tokens of a login. It
+// guards the account security routes from personal access tokens
+func (h *handlerV1) SessionAuthMiddleware(c *gin.Context) {
+	h.authenticate(c, utils.TokenTypeAccess)
+}
+
+// PasswordResetAuthMiddleware also accepts the password reset tokens
+// issued by the forgot password flow
+func (h *handlerV1) PasswordResetAuthMiddleware(c *gin.Context) {
+	h.authenticate(c, utils.TokenTypeAccess, utils.TokenTypePasswordReset)
+}
+
+// authenticate lets through the requests with a valid token of one of the types
+func (h *handlerV1) authenticate(c *gin.Context, tokenTypes ...string) {
 	accessToken := c.GetHeader(authorizationHeaderKey)
 
 	if len(accessToken) == 0 {
@@ -22,16 +53,86 @@ func (h *handlerV1) AuthMiddleware(c *gin.Context) {
 		return
 	}
 
-	payload, err := utils.VerifyToken(h.cfg, accessToken)
+	payload, err := utils.VerifyToken(h.keys, accessToken)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 		return
 	}
 
+	if !hasTokenType(payload, tokenTypes) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+		return
+	}
+
+	revoked, err := h.isTokenRevoked(payload)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(ErrTokenRevoked))
+		return
+	}
+
+	if payload.TokenType == utils.TokenTypeAccess {
+		err = h.touchSession(c, payload.FamilyID)
+		if errors.Is(err, ErrTokenRevoked) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
 	c.Set(authorizationPayloadKey, payload)
 	c.Next()
 }
 
+func hasTokenType(payload *utils.Payload, tokenTypes []string) bool {
+	for _, t := range tokenTypes {
+		if payload.TokenType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// OptionalAuthMiddleware authenticates requests with an authorization
+// header like AuthMiddleware and lets anonymous requests through
+func (h *handlerV1) OptionalAuthMiddleware(scope rbac.Scope) gin.HandlerFunc {
+	auth := h.AuthMiddleware(scope)
+	return func(c *gin.Context) {
+		if len(c.GetHeader(authorizationHeaderKey)) == 0 {
+			c.Next()
+			return
+		}
+
+		auth(c)
+	}
+}
+
+// RequirePermission lets through the requests of the roles having the
+// permission. It has to run after AuthMiddleware
+func (h *handlerV1) RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload, err := h.GetAuthPayload(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+
+		if !rbac.Can(payload.UserType, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse(ErrForbidden))
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func (m *handlerV1) GetAuthPayload(ctx *gin.Context) (*utils.Payload, error) {
 	i, exists := ctx.Get(authorizationPayloadKey)
 	if !exists {
@@ -44,3 +145,100 @@ func (m *handlerV1) GetAuthPayload(ctx *gin.Context) (*utils.Payload, error) {
 	}
 	return payload, nil
 }
+
+// viewer returns the payload of an authenticated request or nil
+func (h *handlerV1) viewer(c *gin.Context) *utils.Payload {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil
+	}
+	return payload
+}
+
+func viewerID(viewer *utils.Payload) int64 {
+	if viewer == nil {
+		return 0
+	}
+	return viewer.UserID
+}
+
+// RateLimitMiddleware throttles the requests of each user, or of each client
+// IP for anonymous requests, to the limit of the route group. The requests
+// with an access token count for its user. The requests with a personal
+// access token count for the client IP first, so floods of made up tokens
+// are refused before they are looked up, and then for the user of the token
+func (h *handlerV1) RateLimitMiddleware(group string, limit config.RateLimit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ipKey := group + "_ip_" + c.ClientIP()
+		token := c.GetHeader(authorizationHeaderKey)
+
+		if isAPIToken(token) {
+			if !h.allow(c, ipKey, limit) {
+				return
+			}
+
+			if userID := h.apiTokenUserID(c); userID != 0 && !h.allow(c, group+"_user_"+strconv.FormatInt(userID, 10), limit) {
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		key := ipKey
+		if userID := h.accessTokenUserID(token); userID != 0 {
+			key = group + "_user_" + strconv.FormatInt(userID, 10)
+		}
+
+		if !h.allow(c, key, limit) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allow counts the request for key and sets the rate limit headers. It
+// responds with 429 and returns false once the limit is exceeded
+func (h *handlerV1) allow(c *gin.Context, key string, limit config.RateLimit) bool {
+	res := h.limiter.Allow(key, limit)
+	if res.Limit == 0 {
+		return true
+	}
+
+	reset := strconv.FormatInt(int64((res.Reset+time.Second-1)/time.Second), 10)
+	c.Header("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+	c.Header("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	c.Header("X-RateLimit-Reset", reset)
+
+	if !res.Allowed {
+		c.Header("Retry-After", reset)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, errorResponse(ErrTooManyRequests))
+		return false
+	}
+
+	return true
+}
+
+// apiTokenUserID returns the user of a valid personal access token of the
+// request or 0
+func (h *handlerV1) apiTokenUserID(c *gin.Context) int64 {
+	apiToken, err := h.lookupAPIToken(c)
+	if err != nil || time.Now().After(apiToken.ExpiresAt) {
+		return 0
+	}
+	return apiToken.UserID
+}
+
+// accessTokenUserID returns the user of a valid access token or 0
+func (h *handlerV1) accessTokenUserID(token string) int64 {
+	if len(token) == 0 {
+		return 0
+	}
+
+	payload, err := utils.VerifyToken(h.keys, token)
+	if err != nil || payload.TokenType != utils.TokenTypeAccess {
+		return 0
+	}
+	return payload.UserID
+}
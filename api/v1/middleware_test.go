@@ -0,0 +1,63 @@
+package v1_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitAPIToken(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimits.Default = config.RateLimit{Requests: 5, Window: time.Minute}
+	})
+	user := s.createUser()
+
+	// the login counts for the client IP and the token creation for the user
+	token := s.createAPIToken(s.login(user.Email, testPassword).AccessToken, "users:read")
+
+	get := func(remoteAddr, token string) int {
+		req := s.newRequest(http.MethodGet, "/v1/users/me", nil, token)
+		req.RemoteAddr = remoteAddr
+		return s.send(req).Code
+	}
+
+	// the requests of the token count for its user from any IP
+	for _, remoteAddr := range []string{"198.51.100.1:1234", "198.51.100.2:1234", "198.51.100.3:1234", "198.51.100.4:1234"} {
+		require.Equal(t, http.StatusOK, get(remoteAddr, token))
+	}
+	require.Equal(t, http.StatusTooManyRequests, get("198.51.100.5:1234", token))
+
+	// the client IPs keep their own limit
+	require.Equal(t, http.StatusUnauthorized, get("198.51.100.5:1234", ""))
+
+	// unknown tokens count for the client IP, which logged in before
+	for i := 0; i < 4; i++ {
+		require.Equal(t, http.StatusUnauthorized, get("192.0.2.1:1234", "blog_pat_unknown"))
+	}
+	require.Equal(t, http.StatusTooManyRequests, get("192.0.2.1:1234", "blog_pat_unknown"))
+}
+
+func TestRateLimitAPITokenPerIPFirst(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimits.Default = config.RateLimit{Requests: 3, Window: time.Minute}
+	})
+	token := s.createAPIToken(s.login(s.createUser().Email, testPassword).AccessToken, "users:read")
+
+	get := func(token string) int {
+		req := s.newRequest(http.MethodGet, "/v1/users/me", nil, token)
+		req.RemoteAddr = "198.51.100.1:1234"
+		return s.send(req).Code
+	}
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusUnauthorized, get("blog_pat_unknown"))
+	}
+	require.Equal(t, http.StatusTooManyRequests, get("blog_pat_unknown"))
+
+	// the client IP is refused before the token is looked up, even though
+	// its user has requests left
+	require.Equal(t, http.StatusTooManyRequests, get(token))
+}
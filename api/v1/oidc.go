@@ -0,0 +1,668 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/oidc"
+	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	OIDCStateKey = "oidc_state_"
+	OIDCLinkKey  = "oidc_link_"
+
+	oidcStateDuration = 10 * time.Minute
+	// oidcStateCookie holds the state in the browser starting the login,
+	// the callback only accepts the state of that browser
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/v1/auth/oidc"
+)
+
+var (
+	ErrUnknownProvider      = errors.New("unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state, start the login again")
+	ErrOIDCEmailNotVerified = errors.New("the email of the identity provider account is not verified")
+	ErrLastIdentity         = errors.New("set a password before unlinking the last identity")
+	ErrIdentityNotLinked    = errors.New("an account with the email of the identity provider exists, log in and link the identity to it")
+	ErrInvalidOIDCLink      = errors.New("invalid or expired identity link, link the identity again")
+	ErrLinkPassword         = errors.New("password is required to link an identity")
+)
+
+// oidcState is kept between the authorization and the callback. A set
+// UserID links the identity to that user instead of logging in
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	UserID       int64  `json:"user_id,omitempty"`
+}
+
+// oidcLink is a provider account waiting for the user to confirm the link
+type oidcLink struct {
+	UserID   int64  `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Email    string `json:"email"`
+}
+
+// @Router /auth/oidc/providers [get]
+// @Summary Get identity providers
+// @Description Get the names of the OpenID Connect providers users can log in with
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.OIDCProvidersResponse
+func (h *handlerV1) GetOIDCProviders(c *gin.Context) {
+	providers := make([]string, 0, len(h.oidc))
+	for name := range h.oidc {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+
+	c.JSON(http.StatusOK, models.OIDCProvidersResponse{
+		Providers: providers,
+	})
+}
+
+// @Router /auth/oidc/{provider}/authorize [get]
+// @Summary Start an identity provider login
+// @Description Get the URL to log in at the identity provider. The provider
+// @Description sends the user back to the callback route, which has to be opened
+// @Description by the browser that received the state cookie of this response
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider"
+// @Success 200 {object} models.OIDCAuthorizeResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) AuthorizeOIDC(c *gin.Context) {
+	h.authorizeOIDC(c, 0)
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/identities/{provider} [post]
+// @Summary Link an identity provider account
+// @Description Get the URL to log in at the identity provider. When the provider sends
+// @Description the user back to the callback route, the user confirms the link with the
+// @Description confirm route
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider"
+// @Success 200 {object} models.OIDCAuthorizeResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) LinkUserIdentity(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	h.authorizeOIDC(c, payload.UserID)
+}
+
+func (h *handlerV1) authorizeOIDC(c *gin.Context, userID int64) {
+	provider, ok := h.oidc[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, errorResponse(ErrUnknownProvider))
+		return
+	}
+
+	state := oidcState{
+		Provider: provider.Name(),
+		UserID:   userID,
+	}
+
+	var err error
+	for _, v := range []*string{&state.Nonce, &state.CodeVerifier} {
+		*v, err = oidc.RandomString()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	stateID, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	url, err := provider.AuthCodeURL(c.Request.Context(), stateID, state.Nonce, oidc.CodeChallenge(state.CodeVerifier))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	stateData, err := json.Marshal(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.inMemory.Set(OIDCStateKey+stateID, string(stateData), oidcStateDuration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	setOIDCStateCookie(c, stateID, int(oidcStateDuration/time.Second))
+	c.JSON(http.StatusOK, models.OIDCAuthorizeResponse{
+		AuthorizationURL: url,
+		ExpiresAt:        time.Now().Add(oidcStateDuration),
+	})
+}
+
+// @Router /auth/oidc/{provider}/callback [get]
+// @Summary Complete an identity provider login
+// @Description Complete the login the provider redirected back from, in the browser
+// @Description that started it. The provider account logs in the user it is linked to,
+// @Description or a new user with its verified email. An existing user with the email has
+// @Description to link the account first. A link started by the user responds with the
+// @Description link token to confirm
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} models.OIDCLinkResponse
+// @Success 201 {object} models.AuthResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) OIDCCallback(c *gin.Context) {
+	provider, ok := h.oidc[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, errorResponse(ErrUnknownProvider))
+		return
+	}
+
+	// the state has to come back to the browser that started the login,
+	// or a victim could complete a login or link started by someone else
+	cookie, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidOIDCState))
+		return
+	}
+
+	state, err := h.consumeOIDCState(c.Query("state"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidOIDCState) {
+			c.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if state.Provider != provider.Name() {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidOIDCState))
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, errorResponse(errors.New(providerErr+": "+c.Query("error_description"))))
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	identity, err := h.storage.UserIdentity().Get(provider.Name(), claims.Subject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if state.UserID != 0 {
+		h.pendingLink(c, &oidcLink{
+			UserID:   state.UserID,
+			Provider: provider.Name(),
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		return
+	}
+
+	var user *repo.User
+	if identity != nil {
+		user, err = h.storage.User().Get(identity.UserID)
+	} else {
+		user, err = h.identityUser(provider.Name(), claims)
+	}
+	if err != nil {
+		if errors.Is(err, ErrOIDCEmailNotVerified) {
+			c.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		if errors.Is(err, ErrIdentityNotLinked) {
+			c.JSON(http.StatusConflict, errorResponse(err))
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	h.login(c, user)
+}
+
+// consumeOIDCState returns the state of the callback, it can be used once
+func (h *handlerV1) consumeOIDCState(stateID string) (*oidcState, error) {
+	if stateID == "" {
+		return nil, ErrInvalidOIDCState
+	}
+
+	data, err := h.inMemory.Get(OIDCStateKey + stateID)
+	if err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+
+	existed, err := h.inMemory.Delete(OIDCStateKey + stateID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !existed {
+		return nil, ErrInvalidOIDCState
+	}
+
+	var state oidcState
+	err = json.Unmarshal([]byte(data), &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// setOIDCStateCookie keeps the state in the browser, a negative maxAge
+// deletes it
+func setOIDCStateCookie(c *gin.Context, stateID string, maxAge int) {
+	// the provider redirects back with a top level navigation
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, stateID, maxAge, oidcStateCookiePath, "", true, true)
+}
+
+// pendingLink keeps the provider account of a link until the user
+// confirms it, the token is only returned to the browser of the link
+func (h *handlerV1) pendingLink(c *gin.Context, link *oidcLink) {
+	linkToken, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.inMemory.Set(OIDCLinkKey+linkToken, string(data), oidcStateDuration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OIDCLinkResponse{
+		LinkToken: linkToken,
+		Provider:  link.Provider,
+		Email:     link.Email,
+		ExpiresAt: time.Now().Add(oidcStateDuration),
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/identities/{provider}/confirm [post]
+// @Summary Confirm an identity link
+// @Description Link the identity provider account of the link token returned by the callback
+// @Description route. Users with a password confirm it with their password
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider"
+// @Param data body models.ConfirmUserIdentityRequest true "Data"
+// @Success 200 {object} models.UserIdentity
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ConfirmUserIdentity(c *gin.Context) {
+	provider, ok := h.oidc[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, errorResponse(ErrUnknownProvider))
+		return
+	}
+
+	var req models.ConfirmUserIdentityRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	data, err := h.inMemory.Get(OIDCLinkKey + req.LinkToken)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidOIDCLink))
+		return
+	}
+
+	var link oidcLink
+	err = json.Unmarshal([]byte(data), &link)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if link.UserID != payload.UserID || link.Provider != provider.Name() {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidOIDCLink))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// users who signed up with an identity provider have no password to confirm
+	if user.Password != "" {
+		if req.Password == "" {
+			c.JSON(http.StatusBadRequest, errorResponse(ErrLinkPassword))
+			return
+		}
+
+		keys := newAttemptKeys(c, "link_identity", user.Email)
+		retryAfter, err := h.checkLockout(keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if retryAfter > 0 {
+			tooManyAttempts(c, retryAfter)
+			return
+		}
+
+		err = utils.CheckPassword(req.Password, user.Password)
+		if err != nil {
+			h.failedAttempt(c, keys, ErrWrongPassword)
+			return
+		}
+
+		err = h.resetFailedAttempts(keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	existed, err := h.inMemory.Delete(OIDCLinkKey + req.LinkToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !existed {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrInvalidOIDCLink))
+		return
+	}
+
+	h.linkIdentity(c, &link)
+}
+
+// linkIdentity links the provider account to the user, an account linked
+// to another user already is refused
+func (h *handlerV1) linkIdentity(c *gin.Context, link *oidcLink) {
+	identity, err := h.storage.UserIdentity().Get(link.Provider, link.Subject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if identity != nil {
+		if identity.UserID != link.UserID {
+			c.JSON(http.StatusConflict, errorResponse(repo.ErrIdentityTaken))
+			return
+		}
+
+		c.JSON(http.StatusOK, parseUserIdentityModel(identity))
+		return
+	}
+
+	identity, err = h.storage.UserIdentity().Create(&repo.UserIdentity{
+		UserID:   link.UserID,
+		Provider: link.Provider,
+		Subject:  link.Subject,
+		Email:    link.Email,
+	})
+	if err != nil {
+		if errors.Is(err, repo.ErrIdentityTaken) {
+			c.JSON(http.StatusConflict, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parseUserIdentityModel(identity))
+}
+
+// identityUser returns the user of a provider account logging in for the
+// first time, a new user with its email. Only emails verified by the
+// provider are trusted, and an existing user with the email has to link
+// the account itself
+func (h *handlerV1) identityUser(provider string, claims *oidc.Claims) (*repo.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	_, err := h.storage.User().GetByEmail(claims.Email)
+	if err == nil {
+		return nil, ErrIdentityNotLinked
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	firstName, lastName := identityNames(claims)
+	user, err := h.storage.UserIdentity().CreateUser(&repo.User{
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     claims.Email,
+		Type:      repo.UserTypeAuthor,
+	}, &repo.UserIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if errors.Is(err, repo.ErrEmailTaken) || errors.Is(err, repo.ErrIdentityTaken) {
+		// a concurrent callback of the same account created the user first
+		identity, getErr := h.storage.UserIdentity().Get(provider, claims.Subject)
+		if getErr == nil {
+			return h.storage.User().Get(identity.UserID)
+		}
+		if !errors.Is(getErr, sql.ErrNoRows) {
+			return nil, getErr
+		}
+
+		return nil, ErrIdentityNotLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// identityNames returns the names of a new user from the claims, falling
+// back to the full name and the email
+func identityNames(claims *oidc.Claims) (string, string) {
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	return firstName, strings.TrimSpace(lastName)
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/identities [get]
+// @Summary Get linked identities
+// @Description Get the identity provider accounts linked to the user
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.GetAllUserIdentitiesResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllUserIdentities(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	identities, err := h.storage.UserIdentity().GetAll(payload.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	response := models.GetAllUserIdentitiesResponse{
+		Identities: make([]*models.UserIdentity, 0),
+		Count:      int32(len(identities)),
+	}
+	for _, i := range identities {
+		response.Identities = append(response.Identities, parseUserIdentityModel(i))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/identities/{id} [delete]
+// @Summary Unlink an identity
+// @Description Unlink an identity provider account. Users without a password
+// @Description can't unlink their last identity
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteUserIdentity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.Password == "" {
+		identities, err := h.storage.UserIdentity().GetAll(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if len(identities) == 1 && identities[0].ID == int64(id) {
+			c.JSON(http.StatusBadRequest, errorResponse(ErrLastIdentity))
+			return
+		}
+	}
+
+	err = h.storage.UserIdentity().Delete(user.ID, int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully unlinked",
+	})
+}
+
+func parseUserIdentityModel(i *repo.UserIdentity) *models.UserIdentity {
+	return &models.UserIdentity{
+		ID:        i.ID,
+		Provider:  i.Provider,
+		Subject:   i.Subject,
+		Email:     i.Email,
+		CreatedAt: i.CreatedAt,
+	}
+}
@@ -0,0 +1,182 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+// newOIDCServer returns a test server logging in with a stub provider
+// named "stub"
+func newOIDCServer(t *testing.T) (*testServer, *oidctest.Server) {
+	provider, err := oidctest.NewServer("client", "secret")
+	require.NoError(t, err)
+	t.Cleanup(provider.Close)
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.OIDC = []config.OIDCProvider{{
+			Name:         "stub",
+			Issuer:       provider.URL,
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost/v1/auth/oidc/stub/callback",
+			Scopes:       []string{"openid", "email", "profile"},
+		}}
+	})
+
+	return s, provider
+}
+
+// oidcFlow is a login or link started at the provider, the callback
+// has to be sent with the cookie of the browser that started it
+type oidcFlow struct {
+	callback string
+	cookie   *http.Cookie
+}
+
+// startOIDC starts a login, or a link for the user of accessToken, and
+// logs in at the provider as address
+func (s *testServer) startOIDC(provider *oidctest.Server, accessToken, address string) *oidcFlow {
+	w := s.request(http.MethodGet, "/v1/auth/oidc/stub/authorize", nil, "")
+	if accessToken != "" {
+		w = s.request(http.MethodPost, "/v1/users/me/identities/stub", nil, accessToken)
+	}
+
+	var resp models.OIDCAuthorizeResponse
+	decode(s.t, w, http.StatusOK, &resp)
+
+	cookies := w.Result().Cookies()
+	require.Len(s.t, cookies, 1)
+	require.True(s.t, cookies[0].HttpOnly)
+
+	client := provider.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	authURL, err := url.Parse(resp.AuthorizationURL)
+	require.NoError(s.t, err)
+	query := authURL.Query()
+	query.Set("login_hint", address)
+	authURL.RawQuery = query.Encode()
+
+	redirect, err := client.Get(authURL.String())
+	require.NoError(s.t, err)
+	redirect.Body.Close()
+	require.Equal(s.t, http.StatusFound, redirect.StatusCode)
+
+	location, err := url.Parse(redirect.Header.Get("Location"))
+	require.NoError(s.t, err)
+
+	return &oidcFlow{
+		callback: location.RequestURI(),
+		cookie:   cookies[0],
+	}
+}
+
+// finish sends the callback of the flow, with its cookie unless withCookie
+// is false
+func (s *testServer) finish(flow *oidcFlow, withCookie bool) *httptest.ResponseRecorder {
+	req := s.newRequest(http.MethodGet, flow.callback, nil, "")
+	if withCookie {
+		req.AddCookie(flow.cookie)
+	}
+
+	return s.send(req)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	s, provider := newOIDCServer(t)
+
+	w := s.finish(s.startOIDC(provider, "", "new@example.com"), true)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	user, err := s.storage.User().GetByEmail("new@example.com")
+	require.NoError(t, err)
+	require.Empty(t, user.Password)
+
+	// the state can't be used twice
+	flow := s.startOIDC(provider, "", "new@example.com")
+	require.Equal(t, http.StatusCreated, s.finish(flow, true).Code)
+	require.Equal(t, http.StatusBadRequest, s.finish(flow, true).Code)
+}
+
+func TestOIDCCallbackOtherBrowser(t *testing.T) {
+	s, provider := newOIDCServer(t)
+	attacker := s.createUser()
+	accessToken := s.login(attacker.Email, testPassword).AccessToken
+
+	// a link started by the attacker and completed by the victim
+	flow := s.startOIDC(provider, accessToken, "victim@example.com")
+	require.Equal(t, http.StatusBadRequest, s.finish(flow, false).Code)
+
+	identities, err := s.storage.UserIdentity().GetAll(attacker.ID)
+	require.NoError(t, err)
+	require.Empty(t, identities)
+
+	// a cookie of another flow doesn't match either
+	other := s.startOIDC(provider, "", "victim@example.com")
+	flow.cookie = other.cookie
+	require.Equal(t, http.StatusBadRequest, s.finish(flow, true).Code)
+}
+
+func TestOIDCLinkExistingUser(t *testing.T) {
+	s, provider := newOIDCServer(t)
+	user := s.createUser()
+	accessToken := s.login(user.Email, testPassword).AccessToken
+
+	// a verified email doesn't link the provider account by itself
+	w := s.finish(s.startOIDC(provider, "", user.Email), true)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	var link models.OIDCLinkResponse
+	decode(t, s.finish(s.startOIDC(provider, accessToken, user.Email), true), http.StatusOK, &link)
+	require.Equal(t, user.Email, link.Email)
+
+	// the link isn't made until the user confirms it
+	identities, err := s.storage.UserIdentity().GetAll(user.ID)
+	require.NoError(t, err)
+	require.Empty(t, identities)
+
+	w = s.request(http.MethodPost, "/v1/users/me/identities/stub/confirm", models.ConfirmUserIdentityRequest{
+		LinkToken: link.LinkToken,
+	}, accessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/users/me/identities/stub/confirm", models.ConfirmUserIdentityRequest{
+		LinkToken: link.LinkToken,
+		Password:  "wrong",
+	}, accessToken)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// another user can't confirm the link
+	other := s.createUser()
+	w = s.request(http.MethodPost, "/v1/users/me/identities/stub/confirm", models.ConfirmUserIdentityRequest{
+		LinkToken: link.LinkToken,
+		Password:  testPassword,
+	}, s.login(other.Email, testPassword).AccessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	var identity models.UserIdentity
+	decode(t, s.request(http.MethodPost, "/v1/users/me/identities/stub/confirm", models.ConfirmUserIdentityRequest{
+		LinkToken: link.LinkToken,
+		Password:  testPassword,
+	}, accessToken), http.StatusOK, &identity)
+	require.Equal(t, "stub", identity.Provider)
+
+	w = s.request(http.MethodPost, "/v1/users/me/identities/stub/confirm", models.ConfirmUserIdentityRequest{
+		LinkToken: link.LinkToken,
+		Password:  testPassword,
+	}, accessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// the linked account logs in the user
+	w = s.finish(s.startOIDC(provider, "", user.Email), true)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
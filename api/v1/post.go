@@ -1,10 +1,17 @@
 package v1
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/rbac"
+	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/gin-gonic/gin"
 )
@@ -17,21 +24,26 @@ import (
 // @Produce json
 // @Param id path int true "ID"
 // @Success 200 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetPost(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: err.Error(),
-		})
+	resp, ok := h.getVisiblePost(c)
+	if !ok {
 		return
 	}
 
-	resp, err := h.storage.Post().Get(int64(id))
+	err := h.storage.Post().IncrementViews(resp.ID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	resp.ViewsCount++
+
 	post := parsePostModel(resp)
 
 	likesInfo, err := h.storage.Like().GetLikesDislikesCount(post.ID)
@@ -51,12 +63,14 @@ func (h *handlerV1) GetPost(c *gin.Context) {
 // @Security ApiKeyAuth
 // @Router /posts [post]
 // @Summary Create a post
-// @Description Create a post
+// @Description Create a post. A draft or scheduled post is only visible to its author
+// @Description until it is published, scheduled posts get published at publish_at
 // @Tags post
 // @Accept json
 // @Produce json
 // @Param post body models.CreatePostRequest true "post"
 // @Success 201 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreatePost(c *gin.Context) {
 	var (
@@ -75,14 +89,27 @@ func (h *handlerV1) CreatePost(c *gin.Context) {
 		return
 	}
 
+	status, publishAt, err := postStatus(&req, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
 	resp, err := h.storage.Post().Create(&repo.Post{
 		Title:       req.Title,
 		Description: req.Description,
 		ImageUrl:    req.ImageUrl,
 		UserID:      payload.UserID,
 		CategoryID:  req.CategoryID,
+		Tags:        normalizeTags(req.Tags),
+		Status:      status,
+		PublishAt:   publishAt,
 	})
 	if err != nil {
+		if errors.Is(err, repo.ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
@@ -93,12 +120,15 @@ func (h *handlerV1) CreatePost(c *gin.Context) {
 
 // @Router /posts [get]
 // @Summary Get all posts
-// @Description Get all posts
+// @Description Get all posts. Pass next_cursor or prev_cursor of a response as cursor
+// @Description to paginate by cursor, stable while new posts arrive.
+// @Description Anonymous users get published posts only, authors also get their own drafts
 // @Tags post
 // @Accept json
 // @Produce json
 // @Param filter query models.GetAllPostsParams false "Filter"
 // @Success 200 {object} models.GetAllPostsResponse
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetAllPosts(c *gin.Context) {
 	req, err := validateGetAllPostsParams(c)
@@ -107,20 +137,167 @@ func (h *handlerV1) GetAllPosts(c *gin.Context) {
 		return
 	}
 
+	cursor, err := decodeCursor(req.Cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
 	result, err := h.storage.Post().GetAll(&repo.GetAllPostsParams{
-		Page:       req.Page,
-		Limit:      req.Limit,
-		Search:     req.Search,
-		UserID:     req.UserID,
-		CategoryID: req.CategoryID,
-		SortByData: req.SortByData,
+		Page:         req.Page,
+		Limit:        req.Limit,
+		Search:       req.Search,
+		UserID:       req.UserID,
+		CategoryID:   req.CategoryID,
+		SortByData:   req.SortByData,
+		Tags:         normalizeTags(strings.Split(req.Tags, ",")),
+		TagsMatchAll: req.TagsMatch == "all",
+		Cursor:       cursor,
+		Status:       req.Status,
+		ViewerID:     viewerID(h.viewer(c)),
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, getPostsResponse(result))
+	c.JSON(http.StatusOK, getPostsResponse(result, cursor, req.Page))
+}
+
+// @Security ApiKeyAuth
+// @Router /posts/{id} [put]
+// @Summary Update a post
+// @Description Update a post. Only the author or a superadmin can update it
+// @Tags post
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param post body models.CreatePostRequest true "post"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdatePost(c *gin.Context) {
+	var (
+		req models.CreatePostRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	post, err := h.storage.Post().Get(int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if post.UserID != payload.UserID && !rbac.Can(payload.UserType, rbac.ManagePosts) {
+		c.JSON(http.StatusForbidden, errorResponse(ErrForbidden))
+		return
+	}
+
+	status, publishAt, err := postStatus(&req, post)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	resp, err := h.storage.Post().Update(&repo.Post{
+		ID:          post.ID,
+		Title:       req.Title,
+		Description: req.Description,
+		ImageUrl:    req.ImageUrl,
+		CategoryID:  req.CategoryID,
+		Tags:        normalizeTags(req.Tags),
+		Status:      status,
+		PublishAt:   publishAt,
+	})
+	if err != nil {
+		if errors.Is(err, repo.ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parsePostModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /posts/{id} [delete]
+// @Summary Delete a post
+// @Description Delete a post with its comments and likes. Only the author or a superadmin can delete it
+// @Tags post
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeletePost(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	post, err := h.storage.Post().Get(int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if post.UserID != payload.UserID && !rbac.Can(payload.UserType, rbac.ManagePosts) {
+		c.JSON(http.StatusForbidden, errorResponse(ErrForbidden))
+		return
+	}
+
+	err = h.storage.Post().Delete(post.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
 }
 
 func validateGetAllPostsParams(c *gin.Context) (*models.GetAllPostsParams, error) {
@@ -130,6 +307,7 @@ func validateGetAllPostsParams(c *gin.Context) (*models.GetAllPostsParams, error
 		err                error
 		userID, categoryID int
 		sortByDate         string = "desc"
+		tagsMatch          string = "any"
 	)
 
 	if c.Query("limit") != "" {
@@ -165,6 +343,17 @@ func validateGetAllPostsParams(c *gin.Context) (*models.GetAllPostsParams, error
 		sortByDate = c.Query("sort_by_date")
 	}
 
+	if c.Query("tags_match") == "all" {
+		tagsMatch = "all"
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", repo.PostStatusDraft, repo.PostStatusScheduled, repo.PostStatusPublished, repo.PostStatusArchived:
+	default:
+		return nil, fmt.Errorf("invalid status: %s", status)
+	}
+
 	return &models.GetAllPostsParams{
 		Limit:      int32(limit),
 		Page:       int32(page),
@@ -172,10 +361,14 @@ func validateGetAllPostsParams(c *gin.Context) (*models.GetAllPostsParams, error
 		UserID:     int64(userID),
 		CategoryID: int64(categoryID),
 		SortByData: sortByDate,
+		Tags:       c.Query("tags"),
+		TagsMatch:  tagsMatch,
+		Cursor:     c.Query("cursor"),
+		Status:     status,
 	}, nil
 }
 
-func getPostsResponse(data *repo.GetAllPostsResult) *models.GetAllPostsResponse {
+func getPostsResponse(data *repo.GetAllPostsResult, cursor *repo.Cursor, page int32) *models.GetAllPostsResponse {
 	response := models.GetAllPostsResponse{
 		Posts: make([]*models.Post, 0),
 		Count: data.Count,
@@ -186,6 +379,15 @@ func getPostsResponse(data *repo.GetAllPostsResult) *models.GetAllPostsResponse
 		response.Posts = append(response.Posts, &p)
 	}
 
+	if len(data.Posts) > 0 {
+		first, last := data.Posts[0], data.Posts[len(data.Posts)-1]
+		response.NextCursor, response.PrevCursor = listingCursors(
+			cursor, page, data.HasMore,
+			repo.Cursor{CreatedAt: first.CreatedAt, ID: first.ID},
+			repo.Cursor{CreatedAt: last.CreatedAt, ID: last.ID},
+		)
+	}
+
 	return &response
 }
 
@@ -198,6 +400,86 @@ func parsePostModel(post *repo.Post) models.Post {
 		UserID:      post.UserID,
 		CategoryID:  post.CategoryID,
 		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
 		ViewsCount:  post.ViewsCount,
+		Tags:        post.Tags,
+		Status:      post.Status,
+		PublishAt:   post.PublishAt,
+	}
+}
+
+// postStatus returns the status and publish time of a post created, or
+// updated when current is set, with req. Posts staying published keep
+// their publish time
+func postStatus(req *models.CreatePostRequest, current *repo.Post) (string, *time.Time, error) {
+	status := req.Status
+	if status == "" {
+		if current != nil {
+			return current.Status, current.PublishAt, nil
+		}
+		status = repo.PostStatusPublished
+	}
+
+	switch status {
+	case repo.PostStatusScheduled:
+		if req.PublishAt == nil || !req.PublishAt.After(time.Now()) {
+			return "", nil, ErrInvalidPublishAt
+		}
+		return status, req.PublishAt, nil
+	case repo.PostStatusPublished:
+		if current != nil && current.Status == repo.PostStatusPublished {
+			return status, current.PublishAt, nil
+		}
+
+		now := time.Now()
+		return status, &now, nil
+	case repo.PostStatusArchived:
+		if current != nil {
+			return status, current.PublishAt, nil
+		}
+	}
+
+	return status, nil, nil
+}
+
+// getVisiblePost loads the post of the id path parameter, writing the
+// error response when it does not exist or the viewer cannot see it
+func (h *handlerV1) getVisiblePost(c *gin.Context) (*repo.Post, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return nil, false
+	}
+
+	return h.getVisiblePostByID(c, int64(id))
+}
+
+// getVisiblePostByID loads the post, writing the error response when it
+// does not exist or the viewer cannot see it
+func (h *handlerV1) getVisiblePostByID(c *gin.Context, id int64) (*repo.Post, bool) {
+	post, err := h.storage.Post().Get(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
 	}
+
+	if !canViewPost(h.viewer(c), post) {
+		c.JSON(http.StatusNotFound, errorResponse(sql.ErrNoRows))
+		return nil, false
+	}
+
+	return post, true
+}
+
+// canViewPost reports whether the viewer, nil for anonymous users, can see the post
+func canViewPost(viewer *utils.Payload, post *repo.Post) bool {
+	if post.Status == repo.PostStatusPublished {
+		return true
+	}
+
+	return viewer != nil && (viewer.UserID == post.UserID || rbac.Can(viewer.UserType, rbac.ManagePosts))
 }
@@ -0,0 +1,259 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/diff"
+	"github.com/TemurMannonov/blog/pkg/rbac"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// @Router /posts/{id}/revisions [get]
+// @Summary Get post revisions
+// @Description Get the revisions of a post, newest first. A revision is stored
+// @Description whenever the title, description, image or category of the post changes
+// @Tags post
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param filter query models.GetAllRevisionsParams false "Filter"
+// @Success 200 {object} models.GetAllRevisionsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetPostRevisions(c *gin.Context) {
+	post, ok := h.getVisiblePost(c)
+	if !ok {
+		return
+	}
+
+	req, err := validateGetAllParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	result, err := h.storage.Revision().GetAll(&repo.GetAllRevisionsParams{
+		PostID: post.ID,
+		Limit:  req.Limit,
+		Page:   req.Page,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	response := models.GetAllRevisionsResponse{
+		Revisions: make([]*models.PostRevision, 0),
+		Count:     result.Count,
+	}
+
+	for _, r := range result.Revisions {
+		revision := parseRevisionModel(r)
+		response.Revisions = append(response.Revisions, &revision)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Router /posts/{id}/revisions/diff [get]
+// @Summary Diff post revisions
+// @Description Get the line based changes of each field from one revision of a post to another.
+// @Description Revisions differing in too many lines can't be compared
+// @Tags post
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param filter query models.RevisionDiffParams true "Revisions"
+// @Success 200 {object} models.RevisionDiff
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetPostRevisionsDiff(c *gin.Context) {
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	post, ok := h.getVisiblePost(c)
+	if !ok {
+		return
+	}
+
+	fromRevision, ok := h.getRevision(c, post.ID, int32(from))
+	if !ok {
+		return
+	}
+
+	toRevision, ok := h.getRevision(c, post.ID, int32(to))
+	if !ok {
+		return
+	}
+
+	response := models.RevisionDiff{
+		From: fromRevision.Revision,
+		To:   toRevision.Revision,
+	}
+
+	fields := []struct {
+		result   *[]*models.DiffLine
+		from, to string
+	}{
+		{&response.Title, fromRevision.Title, toRevision.Title},
+		{&response.Description, fromRevision.Description, toRevision.Description},
+		{&response.ImageUrl, stringValue(fromRevision.ImageUrl), stringValue(toRevision.ImageUrl)},
+		{
+			&response.CategoryID,
+			strconv.FormatInt(fromRevision.CategoryID, 10),
+			strconv.FormatInt(toRevision.CategoryID, 10),
+		},
+	}
+
+	for _, field := range fields {
+		*field.result, err = diffLines(field.from, field.to)
+		if err != nil {
+			if errors.Is(err, diff.ErrTooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, errorResponse(err))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /posts/{id}/revisions/{revision}/restore [post]
+// @Summary Restore a post revision
+// @Description Restore the title, description, image and category of a post from a revision,
+// @Description which adds a new revision. Only the author or a superadmin can restore it
+// @Tags post
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param revision path int true "Revision"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RestorePostRevision(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	rev, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	post, err := h.storage.Post().Get(int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if post.UserID != payload.UserID && !rbac.Can(payload.UserType, rbac.ManagePosts) {
+		c.JSON(http.StatusForbidden, errorResponse(ErrForbidden))
+		return
+	}
+
+	revision, ok := h.getRevision(c, post.ID, int32(rev))
+	if !ok {
+		return
+	}
+
+	post.Title = revision.Title
+	post.Description = revision.Description
+	post.ImageUrl = revision.ImageUrl
+	post.CategoryID = revision.CategoryID
+
+	resp, err := h.storage.Post().Update(post)
+	if err != nil {
+		if errors.Is(err, repo.ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parsePostModel(resp))
+}
+
+func (h *handlerV1) getRevision(c *gin.Context, postID int64, revision int32) (*repo.PostRevision, bool) {
+	result, err := h.storage.Revision().Get(postID, revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
+	}
+
+	return result, true
+}
+
+func diffLines(a, b string) ([]*models.DiffLine, error) {
+	lines, err := diff.Lines(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.DiffLine, 0)
+	for _, line := range lines {
+		result = append(result, &models.DiffLine{
+			Op:   line.Op,
+			Text: line.Text,
+		})
+	}
+	return result, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func parseRevisionModel(r *repo.PostRevision) models.PostRevision {
+	return models.PostRevision{
+		Revision:    r.Revision,
+		PostID:      r.PostID,
+		Title:       r.Title,
+		Description: r.Description,
+		ImageUrl:    r.ImageUrl,
+		CategoryID:  r.CategoryID,
+		CreatedAt:   r.CreatedAt,
+	}
+}
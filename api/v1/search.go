@@ -0,0 +1,127 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/rbac"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	searchTypePosts    = "posts"
+	searchTypeComments = "comments"
+	searchTypeUsers    = "users"
+)
+
+// @Router /search [get]
+// @Summary Search posts, comments and users
+// @Description Full-text search over post titles and descriptions and comments,
+// @Description ranked with the matches highlighted in <b></b>. Headlines and snippets are HTML escaped,
+// @Description the <b></b> tags are the only markup. Only published posts and their comments are searched.
+// @Description Users are matched by name or username, and by email or phone for the users allowed to manage users
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param filter query models.SearchParams false "Filter"
+// @Success 200 {object} models.SearchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) Search(c *gin.Context) {
+	params, err := validateGetAllParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, errorResponse(errors.New("search query is required")))
+		return
+	}
+
+	types := map[string]bool{
+		searchTypePosts:    true,
+		searchTypeComments: true,
+		searchTypeUsers:    true,
+	}
+	if c.Query("types") != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(c.Query("types"), ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	searchParams := &repo.SearchParams{
+		Query: query,
+		Limit: params.Limit,
+		Page:  params.Page,
+	}
+
+	response := models.SearchResponse{
+		Posts:    make([]*models.SearchPost, 0),
+		Comments: make([]*models.SearchComment, 0),
+		Users:    make([]*models.User, 0),
+	}
+
+	if types[searchTypePosts] {
+		result, err := h.storage.Post().Search(searchParams)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		for _, p := range result.Posts {
+			post := parsePostModel(&p.Post)
+			response.Posts = append(response.Posts, &models.SearchPost{
+				Post:     &post,
+				Rank:     p.Rank,
+				Headline: p.Headline,
+				Snippet:  p.Snippet,
+			})
+		}
+		response.PostsCount = result.Count
+	}
+
+	if types[searchTypeComments] {
+		result, err := h.storage.Comment().Search(searchParams)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		for _, cm := range result.Comments {
+			comment := parseCommentModel(&cm.Comment)
+			response.Comments = append(response.Comments, &models.SearchComment{
+				Comment: &comment,
+				Rank:    cm.Rank,
+				Snippet: cm.Snippet,
+			})
+		}
+		response.CommentsCount = result.Count
+	}
+
+	if types[searchTypeUsers] {
+		// matching the contacts would tell anyone whether an email or
+		// phone number has an account
+		viewer := h.viewer(c)
+		result, err := h.storage.User().GetAll(&repo.GetAllUsersParams{
+			Search:         query,
+			Limit:          params.Limit,
+			Page:           params.Page,
+			SearchContacts: viewer != nil && rbac.Can(viewer.UserType, rbac.ManageUsers),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		response.Users = getUsersResponse(result).Users
+		response.UsersCount = result.Count
+	}
+
+	c.JSON(http.StatusOK, response)
+}
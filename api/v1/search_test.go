@@ -0,0 +1,35 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchUsersByEmail(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	path := "/v1/search?types=users&q=" + url.QueryEscape(user.Email)
+
+	// anyone could tell which emails have an account otherwise
+	var resp models.SearchResponse
+	decode(t, s.request(http.MethodGet, path, nil, ""), http.StatusOK, &resp)
+	require.Zero(t, resp.UsersCount)
+
+	author := s.login(s.createUser().Email, testPassword).AccessToken
+	decode(t, s.request(http.MethodGet, path, nil, author), http.StatusOK, &resp)
+	require.Zero(t, resp.UsersCount)
+
+	admin := s.login(s.createUserOfType(repo.UserTypeSuperadmin).Email, testPassword).AccessToken
+	decode(t, s.request(http.MethodGet, path, nil, admin), http.StatusOK, &resp)
+	require.Equal(t, int32(1), resp.UsersCount)
+	require.Equal(t, user.ID, resp.Users[0].ID)
+
+	// the names are public
+	decode(t, s.request(http.MethodGet, "/v1/search?types=users&q="+url.QueryEscape(user.LastName), nil, ""), http.StatusOK, &resp)
+	require.NotZero(t, resp.UsersCount)
+}
@@ -0,0 +1,230 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	SessionSeenKey = "session_seen_"
+
+	// sessionSeenInterval limits the last seen updates of a session
+	sessionSeenInterval = time.Minute
+	maxUserAgentLength  = 512
+)
+
+// @Security ApiKeyAuth
+// @Router /users/me/sessions [get]
+// @Summary Get active sessions
+// @Description Get the logins of the user, last seen first
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.GetAllSessionsResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllSessions(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	sessions, err := h.storage.Session().GetAll(payload.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	response := models.GetAllSessionsResponse{
+		Sessions: make([]*models.Session, 0),
+		Count:    int32(len(sessions)),
+	}
+	for _, s := range sessions {
+		session := parseSessionModel(s)
+		session.Current = s.ID == payload.FamilyID
+		response.Sessions = append(response.Sessions, session)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/sessions/{id} [delete]
+// @Summary Revoke a session
+// @Description Log out a session, its access and refresh tokens stop working
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteSession(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	session, err := h.storage.Session().Get(id)
+	if err == nil && session.UserID != payload.UserID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.revokeTokenFamily(session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully revoked",
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/sessions [delete]
+// @Summary Log out everywhere
+// @Description Revoke every session of the user, including the current one unless keep_current is set.
+// @Description Without keep_current the personal access tokens are revoked too
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param keep_current query bool false "Keep the current session"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteAllSessions(c *gin.Context) {
+	keepCurrent := false
+	if c.Query("keep_current") != "" {
+		var err error
+		keepCurrent, err = strconv.ParseBool(c.Query("keep_current"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !keepCurrent {
+		err = h.revokeCredentials(payload.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ResponseOK{
+			Message: "Successfully logged out everywhere",
+		})
+		return
+	}
+
+	sessions, err := h.storage.Session().GetAll(payload.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	for _, s := range sessions {
+		if s.ID == payload.FamilyID {
+			continue
+		}
+
+		err = h.revokeTokenFamily(s.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully logged out the other sessions",
+	})
+}
+
+// newSession starts a login of the user from the client of the request
+// and issues its tokens
+func (h *handlerV1) newSession(c *gin.Context, user *repo.User) (*models.AuthResponse, error) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session, err := h.storage.Session().Create(&repo.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		IP:        c.ClientIP(),
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(h.cfg.RefreshTokenDuration),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.inMemory.Set(SessionSeenKey+session.ID.String(), "1", sessionSeenInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.newAuthResponse(user, session.ID)
+}
+
+// touchSession records the activity of a session at most once per
+// sessionSeenInterval. A deleted session returns ErrTokenRevoked
+func (h *handlerV1) touchSession(c *gin.Context, id uuid.UUID) error {
+	key := SessionSeenKey + id.String()
+	seen, err := h.inMemory.Exists(key)
+	if err != nil || seen {
+		return err
+	}
+
+	err = h.storage.Session().UpdateLastSeen(id, c.ClientIP(), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.inMemory.Set(key, "1", sessionSeenInterval)
+}
+
+func parseSessionModel(s *repo.Session) *models.Session {
+	return &models.Session{
+		ID:         s.ID.String(),
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+}
@@ -0,0 +1,146 @@
+package v1_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	v1 "github.com/TemurMannonov/blog/api/v1"
+	"github.com/TemurMannonov/blog/config"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// sessions returns the sessions of the user of accessToken
+func (s *testServer) sessions(accessToken string) []*models.Session {
+	var resp models.GetAllSessionsResponse
+	decode(s.t, s.request(http.MethodGet, "/v1/users/me/sessions", nil, accessToken), http.StatusOK, &resp)
+	return resp.Sessions
+}
+
+// currentSession returns the session of accessToken
+func (s *testServer) currentSession(accessToken string) *models.Session {
+	for _, session := range s.sessions(accessToken) {
+		if session.Current {
+			return session
+		}
+	}
+
+	s.t.Fatal("no current session")
+	return nil
+}
+
+// loggedIn tells if the tokens of the login still work
+func (s *testServer) loggedIn(tokens *models.AuthResponse) bool {
+	w := s.request(http.MethodGet, "/v1/users/me", nil, tokens.AccessToken)
+	if w.Code != http.StatusOK {
+		return false
+	}
+
+	w = s.request(http.MethodPost, "/v1/auth/refresh", models.RefreshTokenRequest{
+		RefreshToken: tokens.RefreshToken,
+	}, "")
+	if w.Code != http.StatusOK {
+		return false
+	}
+
+	var resp models.AuthResponse
+	decode(s.t, w, http.StatusOK, &resp)
+	*tokens = resp
+	return true
+}
+
+func TestDeleteSession(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	current := s.login(user.Email, testPassword)
+	other := s.login(user.Email, testPassword)
+	require.Len(t, s.sessions(current.AccessToken), 2)
+
+	otherID := s.currentSession(other.AccessToken).ID
+	w := s.request(http.MethodDelete, "/v1/users/me/sessions/"+otherID, nil, current.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.False(t, s.loggedIn(other))
+	require.True(t, s.loggedIn(current))
+	require.Len(t, s.sessions(current.AccessToken), 1)
+
+	w = s.request(http.MethodDelete, "/v1/users/me/sessions/"+otherID, nil, current.AccessToken)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = s.request(http.MethodDelete, "/v1/users/me/sessions/not-a-uuid", nil, current.AccessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// the sessions of other users can't be revoked
+	stranger := s.login(s.createUser().Email, testPassword)
+	w = s.request(http.MethodDelete, "/v1/users/me/sessions/"+s.currentSession(current.AccessToken).ID, nil, stranger.AccessToken)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	require.True(t, s.loggedIn(current))
+}
+
+func TestDeleteAllSessions(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	current := s.login(user.Email, testPassword)
+	others := []*models.AuthResponse{
+		s.login(user.Email, testPassword),
+		s.login(user.Email, testPassword),
+	}
+
+	w := s.request(http.MethodDelete, "/v1/users/me/sessions?keep_current=true", nil, current.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for _, tokens := range others {
+		require.False(t, s.loggedIn(tokens))
+	}
+	require.True(t, s.loggedIn(current))
+	require.Len(t, s.sessions(current.AccessToken), 1)
+
+	w = s.request(http.MethodDelete, "/v1/users/me/sessions?keep_current=maybe", nil, current.AccessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = s.request(http.MethodDelete, "/v1/users/me/sessions", nil, current.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.False(t, s.loggedIn(current))
+}
+
+func TestSessionIP(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		trustedProxies []string
+		ip             string
+	}{
+		{name: "untrusted proxy", ip: "192.0.2.1"},
+		{name: "trusted proxy", trustedProxies: []string{"192.0.2.1"}, ip: "203.0.113.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.TrustedProxies = tt.trustedProxies
+			})
+			user := s.createUser()
+
+			resp := s.loginFrom("192.0.2.1:1234", "203.0.113.1", user.Email, testPassword)
+			require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+			var tokens models.AuthResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+			require.Equal(t, tt.ip, s.currentSession(tokens.AccessToken).IP)
+		})
+	}
+}
+
+func TestRefreshTokenWithoutSession(t *testing.T) {
+	s := newTestServer(t)
+	tokens := s.login(s.createUser().Email, testPassword)
+
+	// a session deleted concurrently with the refresh isn't brought back
+	id := uuid.MustParse(s.currentSession(tokens.AccessToken).ID)
+	require.NoError(t, s.storage.Session().Delete(id))
+
+	w := s.request(http.MethodPost, "/v1/auth/refresh", models.RefreshTokenRequest{
+		RefreshToken: tokens.RefreshToken,
+	}, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), v1.ErrTokenRevoked.Error())
+}
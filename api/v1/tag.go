@@ -0,0 +1,81 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// @Router /tags [get]
+// @Summary Get all tags
+// @Description Get all tags with the number of published posts using them, most used first
+// @Tags tag
+// @Accept json
+// @Produce json
+// @Param filter query models.GetAllParams false "Filter"
+// @Success 200 {object} models.GetAllTagsResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllTags(c *gin.Context) {
+	req, err := validateGetAllParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	result, err := h.storage.Tag().GetAll(&repo.GetAllTagsParams{
+		Page:   req.Page,
+		Limit:  req.Limit,
+		Search: normalizeTag(req.Search),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, getTagsResponse(result))
+}
+
+func getTagsResponse(data *repo.GetAllTagsResult) *models.GetAllTagsResponse {
+	response := models.GetAllTagsResponse{
+		Tags:  make([]*models.Tag, 0),
+		Count: data.Count,
+	}
+
+	for _, t := range data.Tags {
+		response.Tags = append(response.Tags, &models.Tag{
+			ID:         t.ID,
+			Name:       t.Name,
+			PostsCount: t.PostsCount,
+			CreatedAt:  t.CreatedAt,
+		})
+	}
+
+	return &response
+}
+
+// normalizeTag lowercases a tag and collapses its whitespace, so that
+// " Go  Lang" and "go lang" are the same tag
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// normalizeTags normalizes the tags dropping empty and duplicate ones
+func normalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		result = append(result, tag)
+	}
+
+	return result
+}
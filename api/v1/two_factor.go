@@ -0,0 +1,499 @@
+package v1
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/totp"
+	"github.com/TemurMannonov/blog/pkg/utils"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TwoFactorEnrollKey   = "two_factor_enroll_"
+	TwoFactorUsedStepKey = "two_factor_used_step_"
+
+	twoFactorEnrollDuration = 10 * time.Minute
+	// totpSkew is the number of steps a code may be off by clock drift
+	totpSkew = 1
+
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// @Security ApiKeyAuth
+// @Router /auth/2fa/enroll [post]
+// @Summary Start the two-factor enrollment
+// @Description Generate a TOTP secret to add to an authenticator app. Two-factor
+// @Description authentication is enabled once a code of it is confirmed
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.TwoFactorEnrollResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) EnrollTwoFactor(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = h.storage.TwoFactor().Get(payload.UserID)
+	if err == nil {
+		c.JSON(http.StatusBadRequest, errorResponse(ErrTwoFactorEnabled))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	key := TwoFactorEnrollKey + strconv.FormatInt(payload.UserID, 10)
+	err = h.inMemory.Set(key, secret, twoFactorEnrollDuration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = h.inMemory.Delete(CodeAttemptsKey + key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorEnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(h.cfg.TwoFactor.Issuer, payload.Email, secret),
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /auth/2fa/confirm [post]
+// @Summary Confirm the two-factor enrollment
+// @Description Enable two-factor authentication with a code of the enrolled secret.
+// @Description The returned recovery codes are shown only once
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorConfirmRequest true "Data"
+// @Success 201 {object} models.TwoFactorRecoveryCodesResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ConfirmTwoFactor(c *gin.Context) {
+	var (
+		req models.TwoFactorConfirmRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	keys := newAttemptKeys(c, "confirm_2fa", payload.Email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	key := TwoFactorEnrollKey + strconv.FormatInt(payload.UserID, 10)
+	secret, err := h.inMemory.Get(key)
+	if err != nil {
+		c.JSON(http.StatusForbidden, errorResponse(ErrTwoFactorNotEnrolled))
+		return
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now(), totpSkew)
+	if !ok {
+		h.wrongCode(c, keys, key)
+		return
+	}
+
+	err = h.resetFailedAttempts(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.useTOTPStep(payload.UserID, step)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = h.storage.TwoFactor().Enable(payload.UserID, secret, hashes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = h.inMemory.Delete(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.TwoFactorRecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /auth/2fa/disable [post]
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication, it needs the current password or a
+// @Description code of the authenticator app
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorDisableRequest true "Data"
+// @Success 200 {object} models.ResponseOK
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DisableTwoFactor(c *gin.Context) {
+	var (
+		req models.TwoFactorDisableRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	keys := newAttemptKeys(c, "disable_2fa", user.Email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	tf, err := h.storage.TwoFactor().Get(user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(ErrTwoFactorDisabled))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if req.Code != "" {
+		err = h.verifyTOTP(tf, req.Code)
+		if errors.Is(err, ErrIncorrectCode) {
+			h.failedAttempt(c, keys, ErrIncorrectCode)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	} else if utils.CheckPassword(req.Password, user.Password) != nil {
+		h.failedAttempt(c, keys, ErrWrongPassword)
+		return
+	}
+
+	err = h.resetFailedAttempts(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.storage.TwoFactor().Disable(user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(ErrTwoFactorDisabled))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Two-factor authentication has been disabled",
+	})
+}
+
+// @Router /auth/2fa/verify [post]
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token of a login and a code of the authenticator
+// @Description app or a recovery code for the access and refresh tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorVerifyRequest true "Data"
+// @Success 201 {object} models.AuthResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) VerifyTwoFactor(c *gin.Context) {
+	var (
+		req models.TwoFactorVerifyRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := utils.VerifyToken(h.keys, req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if payload.TokenType != utils.TokenTypeTwoFactorChallenge {
+		c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+		return
+	}
+
+	revoked, err := h.isTokenRevoked(payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if revoked {
+		c.JSON(http.StatusUnauthorized, errorResponse(ErrTokenRevoked))
+		return
+	}
+
+	keys := newAttemptKeys(c, "verify_2fa", payload.Email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	tf, err := h.storage.TwoFactor().Get(user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, errorResponse(utils.ErrInvalidToken))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		err = h.storage.TwoFactor().UseRecoveryCode(user.ID, hashRecoveryCode(req.RecoveryCode))
+		if errors.Is(err, sql.ErrNoRows) {
+			h.failedAttempt(c, keys, ErrIncorrectRecoveryCode)
+			return
+		}
+	} else {
+		err = h.verifyTOTP(tf, req.Code)
+		if errors.Is(err, ErrIncorrectCode) {
+			h.failedAttempt(c, keys, ErrIncorrectCode)
+			return
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.resetFailedAttempts(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// a challenge completes a single login
+	err = h.inMemory.Set(RevokedTokenKey+payload.ID.String(), "1", time.Until(payload.ExpiredAt))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	resp, err := h.newSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// login responds with the tokens of the authenticated user, or with a
+// challenge token if the user has to pass two-factor authentication first
+func (h *handlerV1) login(c *gin.Context, user *repo.User) {
+	_, err := h.storage.TwoFactor().Get(user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		resp, err := h.newSession(c, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, resp)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	token, payload, err := utils.CreateToken(h.keys, &utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		UserType:  user.Type,
+		TokenType: utils.TokenTypeTwoFactorChallenge,
+		Duration:  h.cfg.TwoFactor.ChallengeDuration,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         payload.ExpiredAt,
+	})
+}
+
+// verifyTOTP returns ErrIncorrectCode for wrong and already used codes
+func (h *handlerV1) verifyTOTP(tf *repo.TwoFactor, code string) error {
+	step, ok := totp.Validate(tf.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrIncorrectCode
+	}
+
+	used, err := h.inMemory.Exists(totpUsedStepKey(tf.UserID, step))
+	if err != nil {
+		return err
+	}
+
+	if used {
+		return ErrIncorrectCode
+	}
+
+	return h.useTOTPStep(tf.UserID, step)
+}
+
+// useTOTPStep remembers the step of an accepted code, so the code can't be replayed
+func (h *handlerV1) useTOTPStep(userID, step int64) error {
+	return h.inMemory.Set(totpUsedStepKey(userID, step), "1", (2*totpSkew+1)*totp.Period)
+}
+
+func totpUsedStepKey(userID, step int64) string {
+	return TwoFactorUsedStepKey + strconv.FormatInt(userID, 10) + "_" + strconv.FormatInt(step, 10)
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b strings.Builder
+		for j := 0; j < recoveryCodeLength; j++ {
+			if j == recoveryCodeLength/2 {
+				b.WriteByte('-')
+			}
+
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+
+		codes = append(codes, b.String())
+		hashes = append(hashes, hashRecoveryCode(b.String()))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes the code regardless of its case and dashes.
+// The codes are random enough for a plain SHA-256
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,155 @@
+package v1_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/pkg/totp"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+// enableTwoFactor enables two-factor authentication for the user logged in
+// with accessToken and returns its secret and recovery codes
+func (s *testServer) enableTwoFactor(accessToken string) (string, []string) {
+	var enroll models.TwoFactorEnrollResponse
+	decode(s.t, s.request(http.MethodPost, "/v1/auth/2fa/enroll", nil, accessToken), http.StatusOK, &enroll)
+
+	var confirm models.TwoFactorRecoveryCodesResponse
+	decode(s.t, s.request(http.MethodPost, "/v1/auth/2fa/confirm", models.TwoFactorConfirmRequest{
+		Code: totpCode(s.t, enroll.Secret, time.Now()),
+	}, accessToken), http.StatusCreated, &confirm)
+	require.Len(s.t, confirm.RecoveryCodes, 10)
+
+	return enroll.Secret, confirm.RecoveryCodes
+}
+
+// challenge logs in a user with two-factor authentication and returns the challenge token
+func (s *testServer) challenge(address string) string {
+	w := s.request(http.MethodPost, "/v1/auth/login", models.LoginRequest{
+		Email:    address,
+		Password: testPassword,
+	}, "")
+	require.Equal(s.t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var resp models.TwoFactorChallengeResponse
+	require.NoError(s.t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.True(s.t, resp.TwoFactorRequired)
+
+	return resp.ChallengeToken
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, at)
+	require.NoError(t, err)
+	return code
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	secret, recoveryCodes := s.enableTwoFactor(s.login(user.Email, testPassword).AccessToken)
+
+	challenge := s.challenge(user.Email)
+
+	// the challenge token is no access token
+	w := s.request(http.MethodGet, "/v1/users/me", nil, challenge)
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/auth/2fa/verify", models.TwoFactorVerifyRequest{
+		ChallengeToken: challenge,
+		Code:           wrongCode(totpCode(t, secret, time.Now())),
+	}, "")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// the step after the one of the enrollment code
+	code := totpCode(t, secret, time.Now().Add(totp.Period))
+
+	var resp models.AuthResponse
+	decode(t, s.request(http.MethodPost, "/v1/auth/2fa/verify", models.TwoFactorVerifyRequest{
+		ChallengeToken: challenge,
+		Code:           code,
+	}, ""), http.StatusCreated, &resp)
+	require.NotEmpty(t, resp.RefreshToken)
+
+	w = s.request(http.MethodGet, "/v1/users/me", nil, resp.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// a challenge completes a single login
+	w = s.request(http.MethodPost, "/v1/auth/2fa/verify", models.TwoFactorVerifyRequest{
+		ChallengeToken: challenge,
+		RecoveryCode:   recoveryCodes[0],
+	}, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	// a code can't be replayed
+	w = s.request(http.MethodPost, "/v1/auth/2fa/verify", models.TwoFactorVerifyRequest{
+		ChallengeToken: s.challenge(user.Email),
+		Code:           code,
+	}, "")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// a recovery code replaces a code once
+	challenge = s.challenge(user.Email)
+	decode(t, s.request(http.MethodPost, "/v1/auth/2fa/verify", models.TwoFactorVerifyRequest{
+		ChallengeToken: challenge,
+		RecoveryCode:   recoveryCodes[0],
+	}, ""), http.StatusCreated, &resp)
+
+	challenge = s.challenge(user.Email)
+	w = s.request(http.MethodPost, "/v1/auth/2fa/verify", models.TwoFactorVerifyRequest{
+		ChallengeToken: challenge,
+		RecoveryCode:   recoveryCodes[0],
+	}, "")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	tokens := s.login(user.Email, testPassword)
+	s.enableTwoFactor(tokens.AccessToken)
+
+	w := s.request(http.MethodPost, "/v1/auth/2fa/disable", models.TwoFactorDisableRequest{}, tokens.AccessToken)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/auth/2fa/disable", models.TwoFactorDisableRequest{
+		Password: "wrong",
+	}, tokens.AccessToken)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/auth/2fa/disable", models.TwoFactorDisableRequest{
+		Password: testPassword,
+	}, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	s.login(user.Email, testPassword)
+
+	w = s.request(http.MethodPost, "/v1/auth/2fa/disable", models.TwoFactorDisableRequest{
+		Password: testPassword,
+	}, tokens.AccessToken)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
+
+func TestDisableTwoFactorWithoutPassword(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser()
+	tokens := s.login(user.Email, testPassword)
+	secret, _ := s.enableTwoFactor(tokens.AccessToken)
+
+	// like the users signed up with an identity provider
+	require.NoError(t, s.storage.User().UpdatePassword(&repo.UpdatePassword{UserID: user.ID}))
+
+	w := s.request(http.MethodPost, "/v1/auth/2fa/disable", models.TwoFactorDisableRequest{
+		Code: wrongCode(totpCode(t, secret, time.Now())),
+	}, tokens.AccessToken)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/auth/2fa/disable", models.TwoFactorDisableRequest{
+		Code: totpCode(t, secret, time.Now().Add(totp.Period)),
+	}, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
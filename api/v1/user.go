@@ -1,10 +1,14 @@
 package v1
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/TemurMannonov/blog/api/models"
+	emailPkg "github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/gin-gonic/gin"
 )
@@ -59,6 +63,376 @@ func (h *handlerV1) GetUserProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, parseUserModel(resp))
 }
 
+// @Security ApiKeyAuth
+// @Router /users/me [put]
+// @Summary Update profile
+// @Description Update the profile of the current user, omitted optional fields are cleared
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user body models.UpdateUserRequest true "User"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateUserProfile(c *gin.Context) {
+	var (
+		req models.UpdateUserRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	h.updateUser(c, &repo.User{
+		ID:              payload.UserID,
+		FirstName:       req.FirstName,
+		LastName:        req.LastName,
+		PhoneNumber:     req.PhoneNumber,
+		Gender:          req.Gender,
+		Username:        req.Username,
+		ProfileImageUrl: req.ProfileImageUrl,
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me [patch]
+// @Summary Partially update profile
+// @Description Update the given fields of the profile of the current user
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user body models.PatchUserRequest true "User"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) PatchUserProfile(c *gin.Context) {
+	var (
+		req models.PatchUserRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if req.FirstName != nil {
+		user.FirstName = *req.FirstName
+	}
+	if req.LastName != nil {
+		user.LastName = *req.LastName
+	}
+	if req.PhoneNumber != nil {
+		user.PhoneNumber = req.PhoneNumber
+	}
+	if req.Gender != nil {
+		user.Gender = req.Gender
+	}
+	if req.Username != nil {
+		user.Username = req.Username
+	}
+	if req.ProfileImageUrl != nil {
+		user.ProfileImageUrl = req.ProfileImageUrl
+	}
+
+	h.updateUser(c, user)
+}
+
+// updateUser saves the profile fields of the user and responds with it
+func (h *handlerV1) updateUser(c *gin.Context, user *repo.User) {
+	user.PhoneNumber = nilIfEmpty(user.PhoneNumber)
+	user.Username = nilIfEmpty(user.Username)
+	user.ProfileImageUrl = nilIfEmpty(user.ProfileImageUrl)
+
+	resp, err := h.storage.User().Update(user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		if errors.Is(err, repo.ErrUsernameTaken) || errors.Is(err, repo.ErrPhoneNumberTaken) {
+			c.JSON(http.StatusConflict, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parseUserModel(resp))
+}
+
+// nilIfEmpty treats empty optional fields as unset, so they don't
+// collide in the unique columns
+func nilIfEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me [delete]
+// @Summary Delete account
+// @Description Delete the account of the current user and revoke its tokens. Depending on the configured
+// @Description policy its posts, comments and likes are kept anonymized or removed as well
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteUserProfile(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	policy := h.cfg.UserDeletePolicy
+	if policy != repo.UserDeletePolicyRemove {
+		policy = repo.UserDeletePolicyAnonymize
+	}
+
+	err = h.storage.User().Delete(payload.UserID, policy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.revokeUserTokens(payload.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/email [post]
+// @Summary Change email
+// @Description Send a verification code to the new email of the current user
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param data body models.ChangeEmailRequest true "Data"
+// @Success 201 {object} models.ResponseOK
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ChangeEmail(c *gin.Context) {
+	var (
+		req models.ChangeEmailRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = h.storage.User().GetByEmail(req.Email)
+	if err == nil {
+		c.JSON(http.StatusConflict, errorResponse(ErrEmailExists))
+		return
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.inMemory.Set(ChangeEmailKey+strconv.FormatInt(payload.UserID, 10), req.Email, h.codeDuration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.sendVerificationCode(changeEmailCodeKey(payload.UserID, req.Email), emailPkg.ChangeEmailEmail, req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ResponseOK{
+		Message: "Verification code has been sent!",
+	})
+}
+
+// changeEmailCodeKey keys the code by the user as well, so that users
+// changing to the same email don't overwrite each other's codes
+func changeEmailCodeKey(userID int64, email string) string {
+	return ChangeEmailCode + strconv.FormatInt(userID, 10) + "_" + email
+}
+
+// @Security ApiKeyAuth
+// @Router /users/me/email/verify [post]
+// @Summary Verify email change
+// @Description Change the email of the current user to the verified one, notify the old
+// @Description email and revoke all tokens issued for the old one, personal access tokens included
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param data body models.VerifyChangeEmailRequest true "Data"
+// @Success 200 {object} models.AuthResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) VerifyChangeEmail(c *gin.Context) {
+	var (
+		req models.VerifyChangeEmailRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	changeKey := ChangeEmailKey + strconv.FormatInt(payload.UserID, 10)
+	email, err := h.inMemory.Get(changeKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, errorResponse(ErrCodeExpired))
+		return
+	}
+
+	keys := newAttemptKeys(c, "verify_change_email", email)
+	retryAfter, err := h.checkLockout(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	codeKey := changeEmailCodeKey(payload.UserID, email)
+	code, err := h.inMemory.Get(codeKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, errorResponse(ErrCodeExpired))
+		return
+	}
+
+	if req.Code != code {
+		h.wrongCode(c, keys, codeKey)
+		return
+	}
+
+	err = h.resetFailedAttempts(keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := h.storage.User().Get(payload.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = h.storage.User().UpdateEmail(user.ID, email)
+	if err != nil {
+		if errors.Is(err, repo.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	for _, key := range []string{changeKey, codeKey} {
+		_, err = h.inMemory.Delete(key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	err = h.queueEmail(&emailPkg.SendEmailRequest{
+		To: []string{user.Email},
+		Body: map[string]string{
+			"new_email": email,
+		},
+		Type: emailPkg.EmailChangedEmail,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the tokens issued so far carry the old email, the personal access
+	// tokens are revoked with them
+	err = h.revokeCredentials(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user.Email = email
+	resp, err := h.newSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // @Security ApiKeyAuth
 // @Router /users [post]
 // @Summary Create a user
@@ -80,6 +454,18 @@ func (h *handlerV1) CreateUser(c *gin.Context) {
 		return
 	}
 
+	err = h.password.Validate(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
 	resp, err := h.storage.User().Create(&repo.User{
 		FirstName:       req.FirstName,
 		LastName:        req.LastName,
@@ -89,7 +475,7 @@ func (h *handlerV1) CreateUser(c *gin.Context) {
 		Username:        req.Username,
 		ProfileImageUrl: req.ProfileImageUrl,
 		Type:            req.Type,
-		Password:        req.Password,
+		Password:        hashedPassword,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
@@ -99,6 +485,61 @@ func (h *handlerV1) CreateUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, parseUserModel(resp))
 }
 
+// @Security ApiKeyAuth
+// @Router /users/{id}/role [put]
+// @Summary Update the role of a user
+// @Description Update the role of a user. The user is logged out everywhere to get tokens of the new role
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param role body models.UpdateUserRoleRequest true "Role"
+// @Success 200 {object} models.User
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateUserRole(c *gin.Context) {
+	var (
+		req models.UpdateUserRoleRequest
+	)
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	err = h.storage.User().UpdateType(int64(id), req.Type)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the tokens carry the former role, so a demoted user has to log in again
+	err = h.revokeUserTokens(int64(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	resp, err := h.storage.User().Get(int64(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, parseUserModel(resp))
+}
+
 // @Router /users [get]
 // @Summary Get all users
 // @Description Get all users
@@ -116,9 +557,10 @@ func (h *handlerV1) GetAllUsers(c *gin.Context) {
 	}
 
 	result, err := h.storage.User().GetAll(&repo.GetAllUsersParams{
-		Page:   req.Page,
-		Limit:  req.Limit,
-		Search: req.Search,
+		Page:           req.Page,
+		Limit:          req.Limit,
+		Search:         req.Search,
+		SearchContacts: true,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errorResponse(err))
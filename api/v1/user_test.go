@@ -0,0 +1,65 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/TemurMannonov/blog/api/models"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/bxcodec/faker/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUserRoleRevokesTokens(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login(s.createUserOfType(repo.UserTypeSuperadmin).Email, testPassword)
+	user := s.createUserOfType(repo.UserTypeEditor)
+	tokens := s.login(user.Email, testPassword)
+
+	w := s.request(http.MethodPut, fmt.Sprintf("/v1/users/%d/role", user.ID), models.UpdateUserRoleRequest{
+		Type: repo.UserTypeReader,
+	}, admin.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// the tokens of the former role are revoked
+	w = s.request(http.MethodGet, "/v1/users/me", nil, tokens.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	w = s.request(http.MethodPost, "/v1/auth/refresh", models.RefreshTokenRequest{
+		RefreshToken: tokens.RefreshToken,
+	}, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	var profile models.User
+	decode(t, s.request(http.MethodGet, "/v1/users/me", nil, s.login(user.Email, testPassword).AccessToken), http.StatusOK, &profile)
+	require.Equal(t, repo.UserTypeReader, profile.Type)
+}
+
+func TestChangeEmailToSameAddress(t *testing.T) {
+	s := newTestServer(t)
+	first := s.login(s.createUser().Email, testPassword)
+	second := s.login(s.createUser().Email, testPassword)
+	address := faker.Email()
+
+	codes := make([]string, 0, 2)
+	for _, tokens := range []*models.AuthResponse{first, second} {
+		w := s.request(http.MethodPost, "/v1/users/me/email", models.ChangeEmailRequest{
+			Email: address,
+		}, tokens.AccessToken)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		codes = append(codes, s.code(address))
+	}
+
+	// the second request doesn't overwrite the code of the first user
+	var resp models.AuthResponse
+	decode(t, s.request(http.MethodPost, "/v1/users/me/email/verify", models.VerifyChangeEmailRequest{
+		Code: codes[0],
+	}, first.AccessToken), http.StatusOK, &resp)
+	require.Equal(t, address, resp.Email)
+
+	w := s.request(http.MethodPost, "/v1/users/me/email/verify", models.VerifyChangeEmailRequest{
+		Code: codes[1],
+	}, second.AccessToken)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/go-redis/redis/v9"
 	"github.com/jmoiron/sqlx"
@@ -10,6 +12,8 @@ import (
 
 	"github.com/TemurMannonov/blog/api"
 	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/pkg/utils"
 	"github.com/TemurMannonov/blog/storage"
 )
 
@@ -29,18 +33,55 @@ func main() {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr: cfg.Redis.Addr,
-	})
-
 	strg := storage.NewStoragePg(psqlConn)
-	inMemory := storage.NewInMemoryStorage(rdb)
 
-	apiServer := api.New(&api.RouterOptions{
-		Cfg:      &cfg,
-		Storage:  strg,
-		InMemory: inMemory,
+	var inMemory storage.InMemoryStorageI
+	if cfg.Redis.Addr != "" {
+		rdb := redis.NewClient(&redis.Options{
+			Addr: cfg.Redis.Addr,
+		})
+		inMemory = storage.NewInMemoryStorage(rdb)
+	} else {
+		log.Print("REDIS_ADDR is not set, keeping the in-memory storage in process")
+		inMemory = storage.NewInMemoryStorageLocal()
+	}
+
+	go runPostScheduler(strg, cfg.PostSchedulerInterval)
+
+	emailSender, err := email.NewSender(cfg.Smtp)
+	if err != nil {
+		log.Fatalf("failed to create email sender: %v", err)
+	}
+
+	outboxWorker := email.NewOutboxWorker(
+		storage.NewEmailOutbox(strg.EmailOutbox()),
+		storage.NewEmailSecrets(inMemory),
+		emailSender,
+		email.NewOutboxOptions(cfg.EmailOutbox),
+	)
+	go outboxWorker.Run(context.Background())
+
+	passwordPolicy, err := utils.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		log.Fatalf("failed to load password policy: %v", err)
+	}
+
+	keyRing, err := utils.NewKeyRing(cfg.JWT, cfg.AuthSecretKey)
+	if err != nil {
+		log.Fatalf("failed to load token keys: %v", err)
+	}
+
+	apiServer, err := api.New(&api.RouterOptions{
+		Cfg:            &cfg,
+		Storage:        strg,
+		InMemory:       inMemory,
+		EmailSender:    emailSender,
+		PasswordPolicy: passwordPolicy,
+		KeyRing:        keyRing,
 	})
+	if err != nil {
+		log.Fatalf("failed to create router: %v", err)
+	}
 
 	err = apiServer.Run(cfg.HttpPort)
 	if err != nil {
@@ -49,3 +90,26 @@ func main() {
 
 	log.Print("Server stopped")
 }
+
+// runPostScheduler publishes the scheduled posts once they are due
+func runPostScheduler(strg storage.StorageI, interval time.Duration) {
+	if interval <= 0 {
+		log.Print("post scheduler is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := strg.Post().PublishScheduled(time.Now())
+		if err != nil {
+			log.Printf("failed to publish scheduled posts: %v", err)
+			continue
+		}
+
+		if count > 0 {
+			log.Printf("published %d scheduled posts", count)
+		}
+	}
+}
@@ -1,16 +1,45 @@
 package config
 
 import (
+	"strings"
+	"time"
+
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	HttpPort      string
-	Postgres      PostgresConfig
-	Smtp          Smtp
-	Redis         Redis
+	HttpPort    string
+	Postgres    PostgresConfig
+	Smtp        Smtp
+	Redis       Redis
+	EmailOutbox EmailOutbox
+	BruteForce  BruteForce
+	RateLimits  RateLimits
+	Password    PasswordPolicy
+	TwoFactor   TwoFactor
+	MagicLink   MagicLink
+	OIDC        []OIDCProvider
+	JWT         JWT
+	// AuthSecretKey signs the tokens with HS256 when JWT has no signing
+	// key. While set, it keeps verifying the HS256 tokens after switching
+	// to a JWT key, until JWT.SecretVerifyUntil
 	AuthSecretKey string
+
+	// TrustedProxies are the IPs and CIDRs of the proxies whose
+	// X-Forwarded-For headers are trusted for the client IP. No proxy is
+	// trusted by default, the client IP is then the peer address
+	TrustedProxies []string
+
+	AccessTokenDuration  time.Duration
+	RefreshTokenDuration time.Duration
+
+	// PostSchedulerInterval is how often the due scheduled posts get published
+	PostSchedulerInterval time.Duration
+
+	// UserDeletePolicy is "anonymize" to keep the posts and comments of
+	// deleted users or "remove" to delete them as well
+	UserDeletePolicy string
 }
 
 type PostgresConfig struct {
@@ -22,8 +51,128 @@ type PostgresConfig struct {
 }
 
 type Smtp struct {
+	Host     string
+	Port     string
 	Sender   string
+	Username string
 	Password string
+	// TLS is "starttls", "tls" for implicit TLS or "none"
+	TLS string
+	// Backend is "smtp" to send the emails or "file" to write them to Dir
+	Backend string
+	Dir     string
+}
+
+type EmailOutbox struct {
+	Interval    time.Duration
+	MaxAttempts int32
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// BruteForce limits the failed login and verification code attempts
+type BruteForce struct {
+	// MaxAttempts is the number of failures per email and client IP
+	// within Window before that pair is locked out. Other IPs can keep
+	// trying the email up to MaxAttemptsPerEmail
+	MaxAttempts int64
+	// MaxAttemptsPerIP is the same limit per client IP
+	MaxAttemptsPerIP int64
+	// MaxAttemptsPerEmail is the limit per email from any IP, against
+	// attackers spread over many IPs. It is kept well above MaxAttempts,
+	// since reaching it locks the owner out too
+	MaxAttemptsPerEmail int64
+	Window              time.Duration
+	// Lockout is the first cooldown, it doubles with every following
+	// lockout up to MaxLockout
+	Lockout    time.Duration
+	MaxLockout time.Duration
+	// CodeMaxAttempts is the number of wrong guesses invalidating a
+	// verification code
+	CodeMaxAttempts int64
+}
+
+// PasswordPolicy holds the rules new passwords have to follow
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is the maximum length in bytes, up to the 72 bytes bcrypt hashes
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BreachedFile is a file of known breached passwords, one per line.
+	// They are rejected regardless of the other rules
+	BreachedFile string
+}
+
+// TwoFactor configures the TOTP two-factor authentication
+type TwoFactor struct {
+	// Issuer is the account issuer shown by authenticator apps
+	Issuer string
+	// ChallengeDuration is how long the second step of a login can be completed
+	ChallengeDuration time.Duration
+}
+
+// MagicLink configures the passwordless login links
+type MagicLink struct {
+	// URL is the page the emailed links open, the token is added as the
+	// token query parameter. The page has to post the token to the consume
+	// route, so mail scanners opening the link don't use it up
+	URL      string
+	Duration time.Duration
+}
+
+// OIDCProvider is an OpenID Connect identity provider users can log in with
+type OIDCProvider struct {
+	// Name is the provider name used in the routes, e.g. "google"
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back to, it ends
+	// at the /v1/auth/oidc/{provider}/callback route
+	RedirectURL string
+	Scopes      []string
+}
+
+// JWT holds the keys signing the tokens. To rotate keys, add the new key
+// and publish it before making it the signing key, then remove the old
+// key once the tokens it signed have expired
+type JWT struct {
+	// SigningKeyID is the kid of the key signing new tokens
+	SigningKeyID string
+	// Keys verify the tokens. Keys rotated out keep verifying the tokens
+	// they signed, they can be given as public keys only
+	Keys []JWTKey
+	// SecretVerifyUntil is the RFC 3339 time the HS256 tokens of
+	// AuthSecretKey stop verifying after switching to a signing key, set
+	// it to when the last of them expires. Empty keeps verifying them
+	SecretVerifyUntil string
+}
+
+// JWTKey is a PEM encoded RSA, P-256 EC or Ed25519 key, given inline or
+// as a file
+type JWTKey struct {
+	ID   string
+	PEM  string
+	File string
+}
+
+// RateLimit allows Requests per Window. Zero Requests disables the limit
+type RateLimit struct {
+	Requests int64
+	Window   time.Duration
+}
+
+// RateLimits holds the limits of the route groups
+type RateLimits struct {
+	// Default applies to every /v1 route
+	Default RateLimit
+	// Auth additionally applies to the /v1/auth routes
+	Auth RateLimit
+	// Upload additionally applies to the file upload
+	Upload RateLimit
 }
 
 type Redis struct {
@@ -36,6 +185,43 @@ func Load(path string) Config {
 	conf := viper.New()
 	conf.AutomaticEnv()
 
+	conf.SetDefault("ACCESS_TOKEN_DURATION", "15m")
+	conf.SetDefault("REFRESH_TOKEN_DURATION", "720h")
+	conf.SetDefault("POST_SCHEDULER_INTERVAL", "1m")
+	conf.SetDefault("USER_DELETE_POLICY", "anonymize")
+	conf.SetDefault("SMTP_BACKEND", "smtp")
+	conf.SetDefault("SMTP_HOST", "smtp.gmail.com")
+	conf.SetDefault("SMTP_PORT", "587")
+	conf.SetDefault("SMTP_TLS", "starttls")
+	conf.SetDefault("SMTP_DIR", "./mails")
+	conf.SetDefault("EMAIL_OUTBOX_INTERVAL", "5s")
+	conf.SetDefault("EMAIL_MAX_ATTEMPTS", 5)
+	conf.SetDefault("EMAIL_RETRY_BACKOFF", "30s")
+	conf.SetDefault("EMAIL_MAX_RETRY_BACKOFF", "1h")
+	conf.SetDefault("LOGIN_MAX_ATTEMPTS", 5)
+	conf.SetDefault("LOGIN_MAX_ATTEMPTS_PER_IP", 20)
+	conf.SetDefault("LOGIN_MAX_ATTEMPTS_PER_EMAIL", 50)
+	conf.SetDefault("LOGIN_ATTEMPTS_WINDOW", "15m")
+	conf.SetDefault("LOGIN_LOCKOUT", "1m")
+	conf.SetDefault("LOGIN_MAX_LOCKOUT", "1h")
+	conf.SetDefault("CODE_MAX_ATTEMPTS", 5)
+	conf.SetDefault("PASSWORD_MIN_LENGTH", 8)
+	conf.SetDefault("PASSWORD_MAX_LENGTH", 72)
+	conf.SetDefault("PASSWORD_REQUIRE_LOWER", true)
+	conf.SetDefault("PASSWORD_REQUIRE_UPPER", true)
+	conf.SetDefault("PASSWORD_REQUIRE_DIGIT", true)
+	conf.SetDefault("PASSWORD_REQUIRE_SYMBOL", false)
+	conf.SetDefault("TOTP_ISSUER", "Blog")
+	conf.SetDefault("TWO_FACTOR_CHALLENGE_DURATION", "5m")
+	conf.SetDefault("MAGIC_LINK_URL", "http://localhost:8000/v1/auth/magic-link/consume")
+	conf.SetDefault("MAGIC_LINK_DURATION", "15m")
+	conf.SetDefault("RATE_LIMIT_DEFAULT", 300)
+	conf.SetDefault("RATE_LIMIT_DEFAULT_WINDOW", "1m")
+	conf.SetDefault("RATE_LIMIT_AUTH", 10)
+	conf.SetDefault("RATE_LIMIT_AUTH_WINDOW", "1m")
+	conf.SetDefault("RATE_LIMIT_UPLOAD", 20)
+	conf.SetDefault("RATE_LIMIT_UPLOAD_WINDOW", "1h")
+
 	cfg := Config{
 		HttpPort: conf.GetString("HTTP_PORT"),
 		Postgres: PostgresConfig{
@@ -46,14 +232,146 @@ func Load(path string) Config {
 			Database: conf.GetString("POSTGRES_DATABASE"),
 		},
 		Smtp: Smtp{
+			Backend:  conf.GetString("SMTP_BACKEND"),
+			Host:     conf.GetString("SMTP_HOST"),
+			Port:     conf.GetString("SMTP_PORT"),
+			TLS:      conf.GetString("SMTP_TLS"),
 			Sender:   conf.GetString("SMTP_SENDER"),
+			Username: conf.GetString("SMTP_USERNAME"),
 			Password: conf.GetString("SMTP_PASSWORD"),
+			Dir:      conf.GetString("SMTP_DIR"),
 		},
 		Redis: Redis{
 			Addr: conf.GetString("REDIS_ADDR"),
 		},
+		EmailOutbox: EmailOutbox{
+			Interval:    conf.GetDuration("EMAIL_OUTBOX_INTERVAL"),
+			MaxAttempts: conf.GetInt32("EMAIL_MAX_ATTEMPTS"),
+			Backoff:     conf.GetDuration("EMAIL_RETRY_BACKOFF"),
+			MaxBackoff:  conf.GetDuration("EMAIL_MAX_RETRY_BACKOFF"),
+		},
+		BruteForce: BruteForce{
+			MaxAttempts:         conf.GetInt64("LOGIN_MAX_ATTEMPTS"),
+			MaxAttemptsPerIP:    conf.GetInt64("LOGIN_MAX_ATTEMPTS_PER_IP"),
+			MaxAttemptsPerEmail: conf.GetInt64("LOGIN_MAX_ATTEMPTS_PER_EMAIL"),
+			Window:              conf.GetDuration("LOGIN_ATTEMPTS_WINDOW"),
+			Lockout:             conf.GetDuration("LOGIN_LOCKOUT"),
+			MaxLockout:          conf.GetDuration("LOGIN_MAX_LOCKOUT"),
+			CodeMaxAttempts:     conf.GetInt64("CODE_MAX_ATTEMPTS"),
+		},
+		Password: PasswordPolicy{
+			MinLength:     conf.GetInt("PASSWORD_MIN_LENGTH"),
+			MaxLength:     conf.GetInt("PASSWORD_MAX_LENGTH"),
+			RequireLower:  conf.GetBool("PASSWORD_REQUIRE_LOWER"),
+			RequireUpper:  conf.GetBool("PASSWORD_REQUIRE_UPPER"),
+			RequireDigit:  conf.GetBool("PASSWORD_REQUIRE_DIGIT"),
+			RequireSymbol: conf.GetBool("PASSWORD_REQUIRE_SYMBOL"),
+			BreachedFile:  conf.GetString("PASSWORD_BREACHED_FILE"),
+		},
+		TwoFactor: TwoFactor{
+			Issuer:            conf.GetString("TOTP_ISSUER"),
+			ChallengeDuration: conf.GetDuration("TWO_FACTOR_CHALLENGE_DURATION"),
+		},
+		MagicLink: MagicLink{
+			URL:      conf.GetString("MAGIC_LINK_URL"),
+			Duration: conf.GetDuration("MAGIC_LINK_DURATION"),
+		},
+		RateLimits: RateLimits{
+			Default: RateLimit{
+				Requests: conf.GetInt64("RATE_LIMIT_DEFAULT"),
+				Window:   conf.GetDuration("RATE_LIMIT_DEFAULT_WINDOW"),
+			},
+			Auth: RateLimit{
+				Requests: conf.GetInt64("RATE_LIMIT_AUTH"),
+				Window:   conf.GetDuration("RATE_LIMIT_AUTH_WINDOW"),
+			},
+			Upload: RateLimit{
+				Requests: conf.GetInt64("RATE_LIMIT_UPLOAD"),
+				Window:   conf.GetDuration("RATE_LIMIT_UPLOAD_WINDOW"),
+			},
+		},
 		AuthSecretKey: conf.GetString("AUTH_SECRET_KEY"),
+
+		AccessTokenDuration:  conf.GetDuration("ACCESS_TOKEN_DURATION"),
+		RefreshTokenDuration: conf.GetDuration("REFRESH_TOKEN_DURATION"),
+
+		PostSchedulerInterval: conf.GetDuration("POST_SCHEDULER_INTERVAL"),
+
+		UserDeletePolicy: conf.GetString("USER_DELETE_POLICY"),
 	}
 
+	cfg.TrustedProxies = splitList(conf.GetString("TRUSTED_PROXIES"))
+	cfg.OIDC = loadOIDCProviders(conf)
+	cfg.JWT = loadJWT(conf)
+
 	return cfg
 }
+
+// splitList splits a comma separated list, nil when it is empty
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// loadOIDCProviders loads the providers listed in OIDC_PROVIDERS, each
+// one configured by OIDC_<NAME>_* variables
+func loadOIDCProviders(conf *viper.Viper) []OIDCProvider {
+	providers := make([]OIDCProvider, 0)
+
+	for _, name := range strings.Split(conf.GetString("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		scopes := strings.Fields(conf.GetString(prefix + "SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		providers = append(providers, OIDCProvider{
+			Name:         name,
+			Issuer:       conf.GetString(prefix + "ISSUER"),
+			ClientID:     conf.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: conf.GetString(prefix + "CLIENT_SECRET"),
+			RedirectURL:  conf.GetString(prefix + "REDIRECT_URL"),
+			Scopes:       scopes,
+		})
+	}
+
+	return providers
+}
+
+// loadJWT loads the keys listed in JWT_KEYS, each one given by
+// JWT_KEY_<ID>_PEM or JWT_KEY_<ID>_FILE
+func loadJWT(conf *viper.Viper) JWT {
+	jwt := JWT{
+		SigningKeyID:      strings.TrimSpace(conf.GetString("JWT_SIGNING_KEY_ID")),
+		Keys:              make([]JWTKey, 0),
+		SecretVerifyUntil: strings.TrimSpace(conf.GetString("AUTH_SECRET_KEY_VERIFY_UNTIL")),
+	}
+
+	envName := strings.NewReplacer("-", "_", ".", "_")
+	for _, id := range strings.Split(conf.GetString("JWT_KEYS"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		prefix := "JWT_KEY_" + strings.ToUpper(envName.Replace(id)) + "_"
+		jwt.Keys = append(jwt.Keys, JWTKey{
+			ID: id,
+			// single line values may escape the newlines of the PEM
+			PEM:  strings.ReplaceAll(conf.GetString(prefix+"PEM"), `\n`, "\n"),
+			File: conf.GetString(prefix + "FILE"),
+		})
+	}
+
+	return jwt
+}
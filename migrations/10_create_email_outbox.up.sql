@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS "email_outbox"(
+    "id" SERIAL PRIMARY KEY,
+    "recipients" VARCHAR[] NOT NULL,
+    "subject" VARCHAR NOT NULL,
+    "type" VARCHAR NOT NULL,
+    "body" JSONB NOT NULL DEFAULT '{}',
+    "secrets" JSONB NOT NULL DEFAULT '{}',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK ("status" IN ('pending', 'sent', 'failed')),
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "last_error" TEXT,
+    "next_attempt_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "sent_at" TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS email_outbox_status_next_attempt_at_idx ON email_outbox(status, next_attempt_at);
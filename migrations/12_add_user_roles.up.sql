@@ -0,0 +1,4 @@
+ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "users_type_check";
+UPDATE "users" SET "type"='author' WHERE "type"='user';
+ALTER TABLE "users" ADD CONSTRAINT "users_type_check"
+    CHECK ("type" IN ('superadmin', 'editor', 'moderator', 'author', 'reader'));
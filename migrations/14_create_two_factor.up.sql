@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS "user_two_factor"(
+    "user_id" INTEGER PRIMARY KEY REFERENCES users(id),
+    "secret" VARCHAR NOT NULL,
+    "enabled_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS "user_recovery_codes"(
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id),
+    "code_hash" VARCHAR NOT NULL,
+    "used_at" TIMESTAMP WITH TIME ZONE,
+    UNIQUE("user_id", "code_hash")
+);
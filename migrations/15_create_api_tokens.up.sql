@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "api_tokens"(
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id),
+    "name" VARCHAR NOT NULL,
+    "prefix" VARCHAR NOT NULL,
+    "token_hash" VARCHAR NOT NULL UNIQUE,
+    "scopes" VARCHAR[] NOT NULL,
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "last_used_at" TIMESTAMP WITH TIME ZONE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens(user_id);
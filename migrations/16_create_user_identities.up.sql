@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS "user_identities"(
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id),
+    "provider" VARCHAR NOT NULL,
+    "subject" VARCHAR NOT NULL,
+    "email" VARCHAR NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE("provider", "subject")
+);
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities(user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS "sessions"(
+    "id" UUID PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id),
+    "ip" VARCHAR NOT NULL,
+    "user_agent" VARCHAR NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "last_seen_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE "comments" ADD COLUMN IF NOT EXISTS "parent_id" INTEGER REFERENCES comments(id);
+ALTER TABLE "comments" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments(parent_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "tags"(
+    "id" SERIAL PRIMARY KEY,
+    "name" VARCHAR(50) NOT NULL UNIQUE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS "post_tags"(
+    "post_id" INTEGER NOT NULL REFERENCES posts(id),
+    "tag_id" INTEGER NOT NULL REFERENCES tags(id),
+    PRIMARY KEY(post_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS post_tags_tag_id_idx ON post_tags(tag_id);
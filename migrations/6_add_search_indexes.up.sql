@@ -0,0 +1,8 @@
+ALTER TABLE "posts" ADD COLUMN IF NOT EXISTS "search_vector" TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce("title", '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce("description", '')), 'B')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS posts_search_vector_idx ON posts USING GIN(search_vector);
+
+CREATE INDEX IF NOT EXISTS comments_description_search_idx ON comments USING GIN(to_tsvector('simple', description));
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS posts_created_at_id_idx ON posts(created_at, id);
+CREATE INDEX IF NOT EXISTS comments_created_at_id_idx ON comments(created_at, id);
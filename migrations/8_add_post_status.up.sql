@@ -0,0 +1,7 @@
+ALTER TABLE "posts" ADD COLUMN IF NOT EXISTS "status" VARCHAR(20) NOT NULL DEFAULT 'published'
+    CHECK ("status" IN ('draft', 'scheduled', 'published', 'archived'));
+ALTER TABLE "posts" ADD COLUMN IF NOT EXISTS "publish_at" TIMESTAMP WITH TIME ZONE;
+
+UPDATE "posts" SET "publish_at"="created_at" WHERE "publish_at" IS NULL;
+
+CREATE INDEX IF NOT EXISTS posts_status_publish_at_idx ON posts(status, publish_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS "post_revisions"(
+    "id" SERIAL PRIMARY KEY,
+    "post_id" INTEGER NOT NULL REFERENCES posts(id),
+    "revision" INTEGER NOT NULL,
+    "title" VARCHAR NOT NULL,
+    "description" TEXT NOT NULL,
+    "image_url" VARCHAR,
+    "category_id" INTEGER NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(post_id, revision)
+);
+
+INSERT INTO "post_revisions"(post_id, revision, title, description, image_url, category_id, created_at)
+SELECT id, 1, title, description, image_url, category_id, COALESCE(updated_at, created_at) FROM posts
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,118 @@
+// Package diff computes line based differences between texts
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// MaxCells limits the lines compared, the changed lines of a times the
+// changed lines of b. Lines keeps a table of that many cells
+const MaxCells = 1 << 20
+
+// ErrTooLarge is returned when the texts differ in too many lines to compare
+var ErrTooLarge = errors.New("texts are too large to compare")
+
+// Line is a line of b kept from a, a line inserted into b or a line deleted from a
+type Line struct {
+	Op   string
+	Text string
+}
+
+// Lines returns the shortest edit script turning a into b line by line.
+// Deleted lines come before the lines inserted in their place
+func Lines(a, b string) ([]Line, error) {
+	x, y := split(a), split(b)
+
+	// the common prefix and suffix are kept as they are
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(x)+len(y)-prefix-suffix)
+	for _, text := range x[:prefix] {
+		lines = append(lines, Line{Op: OpEqual, Text: text})
+	}
+
+	changed, err := lcsLines(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, changed...)
+
+	for _, text := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Op: OpEqual, Text: text})
+	}
+
+	return lines, nil
+}
+
+// lcsLines diffs x and y by their longest common subsequence
+func lcsLines(x, y []string) ([]Line, error) {
+	if (len(x)+1)*(len(y)+1) > MaxCells {
+		return nil, ErrTooLarge
+	}
+
+	// lcs[i*w+j] is the length of the longest common subsequence of x[i:] and y[j:]
+	w := len(y) + 1
+	lcs := make([]int32, (len(x)+1)*w)
+
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else if lcs[(i+1)*w+j] >= lcs[i*w+j+1] {
+				lcs[i*w+j] = lcs[(i+1)*w+j]
+			} else {
+				lcs[i*w+j] = lcs[i*w+j+1]
+			}
+		}
+	}
+
+	lines := make([]Line, 0, len(x)+len(y))
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Op: OpEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+			lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+			j++
+		}
+	}
+
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+	}
+
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+	}
+
+	return lines, nil
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,65 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLines(t *testing.T) {
+	lines, err := Lines("a\nb\nc\nd", "a\nc\nx\nd\ne")
+	require.NoError(t, err)
+	require.Equal(t, []Line{
+		{Op: OpEqual, Text: "a"},
+		{Op: OpDelete, Text: "b"},
+		{Op: OpEqual, Text: "c"},
+		{Op: OpInsert, Text: "x"},
+		{Op: OpEqual, Text: "d"},
+		{Op: OpInsert, Text: "e"},
+	}, lines)
+}
+
+func TestLinesReplace(t *testing.T) {
+	lines, err := Lines("old title", "new title")
+	require.NoError(t, err)
+	require.Equal(t, []Line{
+		{Op: OpDelete, Text: "old title"},
+		{Op: OpInsert, Text: "new title"},
+	}, lines)
+}
+
+func TestLinesEmpty(t *testing.T) {
+	lines := func(a, b string) []Line {
+		result, err := Lines(a, b)
+		require.NoError(t, err)
+		return result
+	}
+
+	require.Empty(t, lines("", ""))
+	require.Equal(t, []Line{{Op: OpInsert, Text: "a"}}, lines("", "a"))
+	require.Equal(t, []Line{{Op: OpDelete, Text: "a"}}, lines("a", ""))
+	require.Equal(t, []Line{{Op: OpEqual, Text: "a"}, {Op: OpEqual, Text: "b"}}, lines("a\r\nb", "a\nb"))
+}
+
+func TestLinesTooLarge(t *testing.T) {
+	text := func(prefix string, n int) string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = prefix + strconv.Itoa(i)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	_, err := Lines(text("a", 2000), text("b", 2000))
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// only the changed lines count towards the limit
+	same := text("a", 5000)
+	lines, err := Lines(same+"\nold\n"+same, same+"\nnew\n"+same)
+	require.NoError(t, err)
+	require.Len(t, lines, 10002)
+	require.Equal(t, Line{Op: OpDelete, Text: "old"}, lines[5000])
+	require.Equal(t, Line{Op: OpInsert, Text: "new"}, lines[5001])
+}
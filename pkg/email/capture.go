@@ -0,0 +1,40 @@
+package email
+
+import "sync"
+
+// CaptureSender keeps the emails in memory so tests can assert them
+type CaptureSender struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func NewCaptureSender() *CaptureSender {
+	return &CaptureSender{}
+}
+
+func (s *CaptureSender) Send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := *msg
+	m.To = append([]string(nil), msg.To...)
+	s.messages = append(s.messages, &m)
+
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (s *CaptureSender) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Message(nil), s.messages...)
+}
+
+// Reset forgets the emails sent so far
+func (s *CaptureSender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+}
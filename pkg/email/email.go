@@ -2,61 +2,118 @@ package email
 
 import (
 	"bytes"
+	"embed"
+	"errors"
 	"fmt"
-	"html/template"
-	"net/smtp"
-
-	"github.com/TemurMannonov/blog/config"
+	htmlTemplate "html/template"
+	textTemplate "text/template"
 )
 
+//go:embed templates
+var templates embed.FS
+
+// ErrSecretExpired is returned when a secret of an email is gone from the
+// secret store, e.g. its verification code has expired
+var ErrSecretExpired = errors.New("secret of the email has expired")
+
 type SendEmailRequest struct {
-	To      []string
-	Type    string
-	Body    map[string]string
-	Subject string
+	To   []string
+	Type string
+	Body map[string]string
+	// Secrets maps template fields to the keys of their values in the
+	// SecretStore. They are looked up at send time, so that codes and
+	// login links are never stored along with the queued email
+	Secrets map[string]string
+}
+
+// SecretStore looks up the secrets of the emails. It returns
+// ErrSecretExpired for missing keys
+type SecretStore interface {
+	Secret(key string) (string, error)
 }
 
 const (
 	VerificationEmail   = "verification_email"
 	ForgotPasswordEmail = "forgot_password_email"
+	ChangeEmailEmail    = "change_email_email"
+	EmailChangedEmail   = "email_changed_email"
+	MagicLinkEmail      = "magic_link_email"
 )
 
-func SendEmail(cfg *config.Config, req *SendEmailRequest) error {
-	from := cfg.Smtp.Sender
-	to := req.To
+// subjects holds the subject of each email type. The type is also the name
+// of its templates/<type>.html and templates/<type>.txt templates
+var subjects = map[string]string{
+	VerificationEmail:   "Verification email",
+	ForgotPasswordEmail: "Reset your password",
+	ChangeEmailEmail:    "Confirm your new email",
+	EmailChangedEmail:   "Your email has been changed",
+	MagicLinkEmail:      "Your login link",
+}
 
-	password := cfg.Smtp.Password
+// Subject returns the subject of the email type
+func Subject(emailType string) (string, error) {
+	subject, ok := subjects[emailType]
+	if !ok {
+		return "", fmt.Errorf("unknown email type: %s", emailType)
+	}
+	return subject, nil
+}
 
-	var body bytes.Buffer
+// RenderWithSecrets looks up the secrets of the request and renders it
+func RenderWithSecrets(req *SendEmailRequest, secrets SecretStore) (*Message, error) {
+	body := make(map[string]string, len(req.Body)+len(req.Secrets))
+	for field, value := range req.Body {
+		body[field] = value
+	}
 
-	templatePath := getTemplatePath(req.Type)
-	t, err := template.ParseFiles(templatePath)
+	for field, key := range req.Secrets {
+		value, err := secrets.Secret(key)
+		if err != nil {
+			return nil, err
+		}
+		body[field] = value
+	}
+
+	return Render(&SendEmailRequest{
+		To:   req.To,
+		Type: req.Type,
+		Body: body,
+	})
+}
+
+// Render renders the HTML and plain-text templates of the request type into a message
+func Render(req *SendEmailRequest) (*Message, error) {
+	subject, err := Subject(req.Type)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	t.Execute(&body, req.Body)
+	var html, text bytes.Buffer
 
-	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
-	subject := fmt.Sprintf("Subject: %s\n", req.Subject)
-	msg := []byte(subject + mime + body.String())
+	ht, err := htmlTemplate.ParseFS(templates, "templates/"+req.Type+".html")
+	if err != nil {
+		return nil, err
+	}
 
-	auth := smtp.PlainAuth("", from, password, "smtp.gmail.com")
-	err = smtp.SendMail("smtp.gmail.com:587", auth, from, to, msg)
+	err = ht.Execute(&html, req.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
+	tt, err := textTemplate.ParseFS(templates, "templates/"+req.Type+".txt")
+	if err != nil {
+		return nil, err
+	}
 
-func getTemplatePath(emailType string) string {
-	switch emailType {
-	case VerificationEmail:
-		return "./templates/verification_email.html"
-	case ForgotPasswordEmail:
-		return "./templates/forgot_password_email.html"
+	err = tt.Execute(&text, req.Body)
+	if err != nil {
+		return nil, err
 	}
 
-	return ""
+	return &Message{
+		To:      req.To,
+		Subject: subject,
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
 }
@@ -0,0 +1,207 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessage() *Message {
+	return &Message{
+		To:      []string{"user@example.com"},
+		Subject: "Verification email",
+		HTML:    "<p>Verification Code: <b>123456</b></p>",
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	msg := testMessage()
+	msg.From = "blog@example.com"
+	msg.Subject = "Hi\r\nBcc: victim@example.com"
+
+	data := string(msg.Bytes())
+	require.Contains(t, data, "From: blog@example.com\r\n")
+	require.Contains(t, data, "To: user@example.com\r\n")
+	require.NotContains(t, data, "\r\nBcc:")
+	require.True(t, strings.HasSuffix(data, "\r\n\r\n"+msg.HTML))
+}
+
+func TestMessageBytesMultipart(t *testing.T) {
+	msg := testMessage()
+	msg.Text = "Verification Code: 123456"
+
+	m, err := mail.ReadMessage(bytes.NewReader(msg.Bytes()))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		part, err := r.NextPart()
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(part.Header.Get("Content-Type"), want.contentType))
+
+		// the reader decodes quoted-printable parts
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		require.Equal(t, want.body, string(body))
+	}
+
+	_, err = r.NextPart()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestRender(t *testing.T) {
+	for _, emailType := range []string{VerificationEmail, ForgotPasswordEmail, ChangeEmailEmail} {
+		msg, err := Render(&SendEmailRequest{
+			To:   []string{"user@example.com"},
+			Type: emailType,
+			Body: map[string]string{"code": "123456"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, subjects[emailType], msg.Subject)
+		require.Contains(t, msg.HTML, "<b>123456</b>")
+		require.Contains(t, msg.Text, "123456")
+		require.NotContains(t, msg.Text, "<")
+	}
+
+	msg, err := Render(&SendEmailRequest{
+		Type: EmailChangedEmail,
+		Body: map[string]string{"new_email": "new@example.com"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, msg.HTML, "new@example.com")
+	require.Contains(t, msg.Text, "new@example.com")
+
+	link := "http://localhost:8000/v1/auth/magic-link/consume?token=a.b.c"
+	msg, err = Render(&SendEmailRequest{
+		Type: MagicLinkEmail,
+		Body: map[string]string{"link": link, "expires_in": "15 minutes"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, msg.HTML, `href="`+link+`"`)
+	require.Contains(t, msg.Text, link)
+	require.Contains(t, msg.Text, "15 minutes")
+
+	_, err = Render(&SendEmailRequest{Type: "unknown"})
+	require.Error(t, err)
+}
+
+func TestCaptureSender(t *testing.T) {
+	sender := NewCaptureSender()
+
+	require.NoError(t, sender.Send(testMessage()))
+	require.Len(t, sender.Messages(), 1)
+	require.Equal(t, "Verification email", sender.Messages()[0].Subject)
+
+	sender.Reset()
+	require.Empty(t, sender.Messages())
+}
+
+func TestFileSender(t *testing.T) {
+	dir := t.TempDir()
+
+	sender, err := NewSender(config.Smtp{Backend: BackendFile, Dir: dir, Sender: "blog@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, sender.Send(testMessage()))
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "From: blog@example.com\r\n")
+	require.Contains(t, string(data), "123456")
+}
+
+func TestNewSenderUnknownBackend(t *testing.T) {
+	_, err := NewSender(config.Smtp{Backend: "pigeon"})
+	require.Error(t, err)
+}
+
+func TestSMTPSender(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go serveSMTP(listener, received)
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	sender := NewSMTPSender(config.Smtp{
+		Host:   host,
+		Port:   port,
+		TLS:    TLSModeNone,
+		Sender: "blog@example.com",
+	})
+	require.NoError(t, sender.Send(testMessage()))
+
+	lines := <-received
+	require.Contains(t, lines, "MAIL FROM:<blog@example.com> BODY=8BITMIME")
+	require.Contains(t, lines, "RCPT TO:<user@example.com>")
+	require.Contains(t, lines, "<p>Verification Code: <b>123456</b></p>")
+}
+
+// serveSMTP accepts a single SMTP session and reports the lines it received
+func serveSMTP(listener net.Listener, received chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	lines := make([]string, 0)
+	defer func() { received <- lines }()
+
+	reply("220 localhost ESMTP")
+
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		switch {
+		case data && line == ".":
+			data = false
+			reply("250 OK")
+		case data:
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case line == "DATA":
+			data = true
+			reply("354 Go ahead")
+		case line == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
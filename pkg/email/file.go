@@ -0,0 +1,45 @@
+package email
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileSender writes every email as an .eml file into a maildir like
+// directory: the file is written to dir/tmp and moved to dir/new
+type FileSender struct {
+	dir  string
+	from string
+	seq  uint64
+}
+
+func NewFileSender(dir, from string) *FileSender {
+	return &FileSender{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (s *FileSender) Send(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+
+	for _, sub := range []string{"tmp", "new"} {
+		if err := os.MkdirAll(filepath.Join(s.dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	name := fmt.Sprintf("%d.%d.%d.eml", time.Now().UnixNano(), os.Getpid(), atomic.AddUint64(&s.seq, 1))
+
+	tmp := filepath.Join(s.dir, "tmp", name)
+	if err := os.WriteFile(tmp, msg.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(s.dir, "new", name))
+}
@@ -0,0 +1,179 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+)
+
+// QueuedEmail is an email of the outbox. Its secrets are looked up and it is
+// rendered right before it is sent
+type QueuedEmail struct {
+	ID       int64
+	Attempts int32
+	Request  *SendEmailRequest
+}
+
+// Outbox is the queue the worker sends the emails from
+type Outbox interface {
+	// ClaimDue returns up to limit pending emails due by now and postpones
+	// them by lease, so other workers skip them while they are being sent
+	ClaimDue(now time.Time, lease time.Duration, limit int32) ([]*QueuedEmail, error)
+	MarkSent(id int64, sentAt time.Time) error
+	// MarkFailed records a failed attempt. The email is retried at
+	// nextAttemptAt or dead-lettered as failed when nextAttemptAt is nil
+	MarkFailed(id int64, lastError string, nextAttemptAt *time.Time) error
+}
+
+type OutboxOptions struct {
+	// Interval is how often the outbox is polled for due emails
+	Interval  time.Duration
+	BatchSize int32
+	// MaxAttempts is how many times an email is tried before it is dead-lettered
+	MaxAttempts int32
+	// Backoff is the delay before the first retry, doubled on every next one
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a claimed email is hidden from other workers
+	Lease time.Duration
+}
+
+func NewOutboxOptions(cfg config.EmailOutbox) OutboxOptions {
+	return OutboxOptions{
+		Interval:    cfg.Interval,
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     cfg.Backoff,
+		MaxBackoff:  cfg.MaxBackoff,
+	}
+}
+
+// OutboxWorker sends the queued emails, retrying failures with exponential backoff
+type OutboxWorker struct {
+	outbox  Outbox
+	secrets SecretStore
+	sender  Sender
+	opts    OutboxOptions
+}
+
+func NewOutboxWorker(outbox Outbox, secrets SecretStore, sender Sender, opts OutboxOptions) *OutboxWorker {
+	opts = opts.withDefaults()
+
+	return &OutboxWorker{
+		outbox:  outbox,
+		secrets: secrets,
+		sender:  sender,
+		opts:    opts,
+	}
+}
+
+func (opts OutboxOptions) withDefaults() OutboxOptions {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+
+	return opts
+}
+
+// RetryWindow is how long after it is queued an email may still be sent,
+// polling delays included. Secrets of the emails should outlive it
+func (opts OutboxOptions) RetryWindow() time.Duration {
+	opts = opts.withDefaults()
+
+	window := time.Duration(opts.MaxAttempts) * opts.Interval
+	for attempts := int32(1); attempts < opts.MaxAttempts; attempts++ {
+		window += opts.backoff(attempts)
+	}
+	return window
+}
+
+// Run processes the outbox every interval until ctx is done
+func (w *OutboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.ProcessDue(time.Now()); err != nil {
+				log.Printf("failed to process email outbox: %v", err)
+			}
+		}
+	}
+}
+
+// ProcessDue sends a batch of the emails due by now
+func (w *OutboxWorker) ProcessDue(now time.Time) error {
+	emails, err := w.outbox.ClaimDue(now, w.opts.Lease, w.opts.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range emails {
+		msg, err := RenderWithSecrets(e.Request, w.secrets)
+		if errors.Is(err, ErrSecretExpired) {
+			// retrying would not bring the secret back
+			log.Printf("email %d dead-lettered: %v", e.ID, err)
+
+			err = w.outbox.MarkFailed(e.ID, err.Error(), nil)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err == nil {
+			err = w.sender.Send(msg)
+		}
+		if err == nil {
+			err = w.outbox.MarkSent(e.ID, time.Now())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var nextAttemptAt *time.Time
+		if attempts := e.Attempts + 1; attempts < w.opts.MaxAttempts {
+			retryAt := now.Add(w.opts.backoff(attempts))
+			nextAttemptAt = &retryAt
+		} else {
+			log.Printf("email %d dead-lettered after %d attempts: %v", e.ID, attempts, err)
+		}
+
+		err = w.outbox.MarkFailed(e.ID, err.Error(), nextAttemptAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (opts OutboxOptions) backoff(attempts int32) time.Duration {
+	delay := opts.Backoff
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if opts.MaxBackoff > 0 && delay >= opts.MaxBackoff {
+			return opts.MaxBackoff
+		}
+	}
+	return delay
+}
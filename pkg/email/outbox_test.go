@@ -0,0 +1,177 @@
+package email
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingSender struct {
+	calls int
+}
+
+func (s *failingSender) Send(msg *Message) error {
+	s.calls++
+	return errors.New("connection refused")
+}
+
+type testEmail struct {
+	QueuedEmail
+	status        string
+	lastError     string
+	nextAttemptAt time.Time
+}
+
+// testOutbox keeps the queued emails in memory
+type testOutbox struct {
+	emails []*testEmail
+}
+
+func (o *testOutbox) add(req *SendEmailRequest) *testEmail {
+	e := &testEmail{
+		QueuedEmail: QueuedEmail{ID: int64(len(o.emails) + 1), Request: req},
+		status:      "pending",
+	}
+	o.emails = append(o.emails, e)
+	return e
+}
+
+func (o *testOutbox) ClaimDue(now time.Time, lease time.Duration, limit int32) ([]*QueuedEmail, error) {
+	result := make([]*QueuedEmail, 0)
+	for _, e := range o.emails {
+		if e.status == "pending" && !e.nextAttemptAt.After(now) && len(result) < int(limit) {
+			e.nextAttemptAt = now.Add(lease)
+			queued := e.QueuedEmail
+			result = append(result, &queued)
+		}
+	}
+	return result, nil
+}
+
+func (o *testOutbox) MarkSent(id int64, sentAt time.Time) error {
+	e := o.emails[id-1]
+	e.status = "sent"
+	e.Attempts++
+	return nil
+}
+
+func (o *testOutbox) MarkFailed(id int64, lastError string, nextAttemptAt *time.Time) error {
+	e := o.emails[id-1]
+	e.Attempts++
+	e.lastError = lastError
+	if nextAttemptAt == nil {
+		e.status = "failed"
+	} else {
+		e.nextAttemptAt = *nextAttemptAt
+	}
+	return nil
+}
+
+type testSecrets map[string]string
+
+func (s testSecrets) Secret(key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", ErrSecretExpired
+	}
+	return value, nil
+}
+
+func testRequest() *SendEmailRequest {
+	return &SendEmailRequest{
+		To:      []string{"user@example.com"},
+		Type:    VerificationEmail,
+		Secrets: map[string]string{"code": "register_code_user@example.com"},
+	}
+}
+
+func TestOutboxWorkerSends(t *testing.T) {
+	outbox := &testOutbox{}
+	secrets := testSecrets{"register_code_user@example.com": "123456"}
+	sender := NewCaptureSender()
+
+	e := outbox.add(testRequest())
+
+	worker := NewOutboxWorker(outbox, secrets, sender, OutboxOptions{MaxAttempts: 3, Backoff: time.Minute})
+	require.NoError(t, worker.ProcessDue(time.Now().Add(time.Second)))
+
+	require.Len(t, sender.Messages(), 1)
+	msg := sender.Messages()[0]
+	require.Equal(t, e.Request.To, msg.To)
+	require.Equal(t, "Verification email", msg.Subject)
+	require.Contains(t, msg.Text, "123456")
+	require.Equal(t, "sent", e.status)
+
+	require.NoError(t, worker.ProcessDue(time.Now().Add(time.Hour)))
+	require.Len(t, sender.Messages(), 1)
+}
+
+func TestOutboxWorkerRetries(t *testing.T) {
+	outbox := &testOutbox{}
+	secrets := testSecrets{"register_code_user@example.com": "123456"}
+	sender := &failingSender{}
+
+	e := outbox.add(testRequest())
+
+	worker := NewOutboxWorker(outbox, secrets, sender, OutboxOptions{MaxAttempts: 3, Backoff: time.Minute})
+
+	now := time.Now().Add(time.Second)
+	require.NoError(t, worker.ProcessDue(now))
+
+	require.Equal(t, "pending", e.status)
+	require.Equal(t, int32(1), e.Attempts)
+	require.Equal(t, "connection refused", e.lastError)
+	require.True(t, e.nextAttemptAt.Equal(now.Add(time.Minute)))
+
+	// not due yet
+	require.NoError(t, worker.ProcessDue(now.Add(30*time.Second)))
+	require.Equal(t, 1, sender.calls)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, worker.ProcessDue(now))
+
+	require.Equal(t, int32(2), e.Attempts)
+	require.True(t, e.nextAttemptAt.Equal(now.Add(2*time.Minute)))
+
+	require.NoError(t, worker.ProcessDue(now.Add(2*time.Minute)))
+
+	require.Equal(t, "failed", e.status)
+	require.Equal(t, int32(3), e.Attempts)
+
+	require.NoError(t, worker.ProcessDue(now.Add(time.Hour)))
+	require.Equal(t, 3, sender.calls)
+}
+
+func TestOutboxWorkerExpiredSecret(t *testing.T) {
+	outbox := &testOutbox{}
+	sender := NewCaptureSender()
+
+	e := outbox.add(testRequest())
+
+	worker := NewOutboxWorker(outbox, testSecrets{}, sender, OutboxOptions{MaxAttempts: 3, Backoff: time.Minute})
+	require.NoError(t, worker.ProcessDue(time.Now().Add(time.Second)))
+
+	// an expired code is not retried
+	require.Empty(t, sender.Messages())
+	require.Equal(t, "failed", e.status)
+	require.Equal(t, ErrSecretExpired.Error(), e.lastError)
+}
+
+func TestOutboxWorkerBackoff(t *testing.T) {
+	opts := OutboxOptions{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}
+
+	require.Equal(t, time.Minute, opts.backoff(1))
+	require.Equal(t, 2*time.Minute, opts.backoff(2))
+	require.Equal(t, 4*time.Minute, opts.backoff(3))
+	require.Equal(t, 5*time.Minute, opts.backoff(4))
+	require.Equal(t, 5*time.Minute, opts.backoff(30))
+}
+
+func TestOutboxRetryWindow(t *testing.T) {
+	opts := OutboxOptions{Interval: 5 * time.Second, MaxAttempts: 5, Backoff: 30 * time.Second, MaxBackoff: time.Hour}
+
+	// 5 polls and the retries after 30s, 1m, 2m and 4m
+	require.Equal(t, 25*time.Second+450*time.Second, opts.RetryWindow())
+}
@@ -0,0 +1,89 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+)
+
+const (
+	BackendSMTP = "smtp"
+	BackendFile = "file"
+)
+
+// Message is a rendered email
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	HTML    string
+	// Text is the plain-text alternative of HTML, if any
+	Text string
+}
+
+// Sender delivers rendered emails
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// NewSender returns the sender of the configured backend
+func NewSender(cfg config.Smtp) (Sender, error) {
+	switch cfg.Backend {
+	case BackendSMTP, "":
+		return NewSMTPSender(cfg), nil
+	case BackendFile:
+		return NewFileSender(cfg.Dir, cfg.Sender), nil
+	}
+
+	return nil, fmt.Errorf("unknown email backend: %s", cfg.Backend)
+}
+
+// Bytes formats the message as an RFC 5322 email. Messages with a Text part
+// are sent as multipart/alternative with the plain-text part first
+func (m *Message) Bytes() []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.Text == "" {
+		b.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+		b.WriteString("\r\n")
+		b.WriteString(m.HTML)
+
+		return b.Bytes()
+	}
+
+	w := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n", w.Boundary())
+	b.WriteString("\r\n")
+
+	writePart(w, "text/plain", m.Text)
+	writePart(w, "text/html", m.HTML)
+	w.Close()
+
+	return b.Bytes()
+}
+
+// writePart writes a quoted-printable encoded part of the multipart message
+func writePart(w *multipart.Writer, contentType, body string) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType+"; charset=\"UTF-8\"")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	// writes into a bytes.Buffer never fail
+	part, _ := w.CreatePart(header)
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(body))
+	qp.Close()
+}
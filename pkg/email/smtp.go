@@ -0,0 +1,110 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+
+	"github.com/TemurMannonov/blog/config"
+)
+
+const (
+	TLSModeStartTLS = "starttls"
+	TLSModeTLS      = "tls"
+	TLSModeNone     = "none"
+)
+
+// SMTPSender sends emails through an SMTP relay
+type SMTPSender struct {
+	cfg config.Smtp
+}
+
+func NewSMTPSender(cfg config.Smtp) *SMTPSender {
+	if cfg.Username == "" {
+		cfg.Username = cfg.Sender
+	}
+
+	return &SMTPSender{
+		cfg: cfg,
+	}
+}
+
+func (s *SMTPSender) Send(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.cfg.Sender
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.cfg.Password != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(msg.From); err != nil {
+		return err
+	}
+
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the relay securing the connection as configured
+func (s *SMTPSender) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, s.cfg.Port)
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host}
+
+	switch s.cfg.TLS {
+	case TLSModeTLS:
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, s.cfg.Host)
+	case TLSModeStartTLS, "":
+		client, err := smtp.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return client, nil
+	case TLSModeNone:
+		return smtp.Dial(addr)
+	}
+
+	return nil, fmt.Errorf("unknown smtp tls mode: %s", s.cfg.TLS)
+}
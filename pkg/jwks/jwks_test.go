@@ -0,0 +1,83 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaJWK, err := NewKey("rsa", "RS256", &rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	ecJWK, err := NewKey("ec", "ES256", &ecKey.PublicKey)
+	require.NoError(t, err)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	edJWK, err := NewKey("ed", "EdDSA", edPub)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(Set{Keys: []Key{rsaJWK, ecJWK, edJWK}})
+	require.NoError(t, err)
+
+	var set Set
+	require.NoError(t, json.Unmarshal(data, &set))
+
+	key, err := set.Find("rsa")
+	require.NoError(t, err)
+	pub, err := key.PublicKey()
+	require.NoError(t, err)
+	require.True(t, rsaKey.PublicKey.Equal(pub))
+
+	key, err = set.Find("ec")
+	require.NoError(t, err)
+	pub, err = key.PublicKey()
+	require.NoError(t, err)
+	require.True(t, ecKey.PublicKey.Equal(pub))
+
+	key, err = set.Find("ed")
+	require.NoError(t, err)
+	pub, err = key.PublicKey()
+	require.NoError(t, err)
+	require.True(t, edPub.Equal(pub))
+
+	_, err = set.Find("unknown")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = set.Find("")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestUnsupported(t *testing.T) {
+	_, err := (&Key{Kty: "oct"}).PublicKey()
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+
+	_, err = (&Key{Kty: "EC", Crv: "P-384", X: "AQ", Y: "AQ"}).PublicKey()
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+
+	// a point off the curve
+	_, err = (&Key{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}).PublicKey()
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+
+	_, err = (&Key{Kty: "OKP", Crv: "Ed25519", X: "AQ"}).PublicKey()
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewKey("ec", "ES384", &p384.PublicKey)
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+}
@@ -0,0 +1,370 @@
+// Package oidc implements the authorization code flow of OpenID Connect
+// relying parties: discovery, PKCE, the code exchange and the ID token
+// validation against the JWKS of the provider
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/jwks"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// leeway is the clock skew allowed between the provider and us
+	leeway = time.Minute
+	// keysRefreshInterval limits the JWKS refetches of unknown key ids
+	keysRefreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNonceMismatch  = errors.New("id token nonce mismatch")
+)
+
+// signingMethods are the accepted ID token algorithms
+var signingMethods = []string{"RS256", "ES256"}
+
+// Discovery is the part of the provider metadata the flow needs
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      Audience `json:"aud"`
+	AuthorizedTo  string   `json:"azp,omitempty"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	GivenName     string   `json:"given_name,omitempty"`
+	FamilyName    string   `json:"family_name,omitempty"`
+	Picture       string   `json:"picture,omitempty"`
+}
+
+// Valid checks the times of the claims, it is called by the JWT parser
+func (c *Claims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+
+	if c.IssuedAt != 0 && now.Add(leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+
+	return nil
+}
+
+// Audience is the aud claim, a single string or an array of them
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*a = list
+	return nil
+}
+
+func (a Audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider is an OpenID Connect provider. Its metadata and keys are
+// fetched on first use
+type Provider struct {
+	cfg    config.OIDCProvider
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	keys          *jwks.Set
+	keysFetchedAt time.Time
+}
+
+func NewProvider(cfg config.OIDCProvider, client *http.Client) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// NewProviders returns the providers of cfg by name
+func NewProviders(cfg []config.OIDCProvider, client *http.Client) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfg))
+	for _, p := range cfg {
+		providers[p.Name] = NewProvider(p, client)
+	}
+	return providers
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL to send the user to. The state and the
+// nonce are checked on the way back, codeChallenge is the S256 PKCE
+// challenge of the verifier passed to Exchange
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.Discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// tokenResponse is the response of the token endpoint, or its error
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the authorization code and returns the raw ID token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	d, err := p.Discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("oidc token exchange failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	if token.IDToken == "" {
+		return "", fmt.Errorf("%w: missing from the token response", ErrInvalidIDToken)
+	}
+
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, the issuer, the audience, the
+// times and the nonce of the ID token and returns its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	d, err := p.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	parser := jwt.Parser{ValidMethods: signingMethods}
+	_, err = parser.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, d, kid)
+	})
+	if err != nil {
+		var verr *jwt.ValidationError
+		if errors.As(err, &verr) && verr.Inner != nil {
+			return nil, verr.Inner
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Issuer != d.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	}
+
+	if !claims.Audience.contains(p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedTo != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	return &claims, nil
+}
+
+// Discovery returns the provider metadata, fetching it on first use
+func (p *Provider) Discovery(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	var d Discovery
+	err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery issuer %q does not match %q", d.Issuer, p.cfg.Issuer)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery == nil {
+		p.discovery = &d
+	}
+	return p.discovery, nil
+}
+
+// publicKey returns the key of the kid, refetching the JWKS once in a
+// while to pick up rotated keys. The lock isn't held during the fetch, so
+// a slow provider doesn't hold up the logins verified with cached keys
+func (p *Provider) publicKey(ctx context.Context, d *Discovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	if p.keys != nil {
+		key, err := p.keys.Find(kid)
+		if err == nil {
+			p.mu.Unlock()
+			return key.PublicKey()
+		}
+
+		if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+			p.mu.Unlock()
+			return nil, err
+		}
+	}
+	// the refetch is claimed up front, the other unknown kids wait for
+	// the next interval instead of fetching too
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+
+	var keys jwks.Set
+	err := p.getJSON(ctx, d.JWKSURI, &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys = &keys
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+
+	key, err := keys.Find(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.PublicKey()
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s returned %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RandomString returns a random URL safe string for states, nonces and
+// PKCE verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
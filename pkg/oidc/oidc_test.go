@@ -0,0 +1,192 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/oidc"
+	"github.com/TemurMannonov/blog/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	srv, err := oidctest.NewServer("client", "secret")
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	return srv, oidc.NewProvider(config.OIDCProvider{
+		Name:         "stub",
+		Issuer:       srv.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"openid", "email"},
+	}, srv.Client())
+}
+
+// authorize follows the authorization URL and returns the code and state
+// the provider redirects back with
+func authorize(t *testing.T, srv *oidctest.Server, authURL string) (string, string) {
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "localhost", location.Host)
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestFlow(t *testing.T) {
+	ctx := context.Background()
+	srv, p := newProvider(t)
+
+	verifier, err := oidc.RandomString()
+	require.NoError(t, err)
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", oidc.CodeChallenge(verifier))
+	require.NoError(t, err)
+
+	code, state := authorize(t, srv, authURL)
+	require.Equal(t, "state", state)
+
+	// a wrong verifier fails the PKCE check and burns the code
+	_, err = p.Exchange(ctx, code, "wrong")
+	require.Error(t, err)
+
+	code, _ = authorize(t, srv, authURL)
+	idToken, err := p.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+
+	_, err = p.Exchange(ctx, code, verifier)
+	require.Error(t, err)
+
+	claims, err := p.VerifyIDToken(ctx, idToken, "nonce")
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.Subject)
+	require.Equal(t, "user@example.com", claims.Email)
+	require.True(t, claims.EmailVerified)
+
+	_, err = p.VerifyIDToken(ctx, idToken, "other")
+	require.ErrorIs(t, err, oidc.ErrNonceMismatch)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	srv, p := newProvider(t)
+
+	valid := func() *oidc.Claims {
+		return &oidc.Claims{
+			Issuer:    srv.URL,
+			Subject:   "user-1",
+			Audience:  oidc.Audience{"client"},
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Nonce:     "nonce",
+		}
+	}
+
+	token, err := srv.SignIDToken(valid())
+	require.NoError(t, err)
+	_, err = p.VerifyIDToken(ctx, token, "nonce")
+	require.NoError(t, err)
+
+	for name, modify := range map[string]func(c *oidc.Claims){
+		"issuer":   func(c *oidc.Claims) { c.Issuer = "https://evil.example.com" },
+		"audience": func(c *oidc.Claims) { c.Audience = oidc.Audience{"other"} },
+		"azp":      func(c *oidc.Claims) { c.Audience = oidc.Audience{"client", "other"} },
+		"expired":  func(c *oidc.Claims) { c.ExpiresAt = time.Now().Add(-time.Hour).Unix() },
+		"future":   func(c *oidc.Claims) { c.IssuedAt = time.Now().Add(time.Hour).Unix() },
+		"subject":  func(c *oidc.Claims) { c.Subject = "" },
+	} {
+		claims := valid()
+		modify(claims)
+
+		token, err := srv.SignIDToken(claims)
+		require.NoError(t, err)
+
+		_, err = p.VerifyIDToken(ctx, token, "nonce")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken, name)
+	}
+
+	// tokens signed by another key are rejected
+	other, err := oidctest.NewProvider(srv.URL, "client", "secret")
+	require.NoError(t, err)
+
+	token, err = other.SignIDToken(valid())
+	require.NoError(t, err)
+	_, err = p.VerifyIDToken(ctx, token, "nonce")
+	require.Error(t, err)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	srv, err := oidctest.NewServer("client", "secret")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	srv.Provider.Issuer = "https://evil.example.com"
+
+	p := oidc.NewProvider(config.OIDCProvider{Issuer: srv.URL, ClientID: "client"}, srv.Client())
+	_, err = p.Discovery(context.Background())
+	require.Error(t, err)
+}
+
+func TestSlowKeysFetch(t *testing.T) {
+	ctx := context.Background()
+
+	var stub *oidctest.Provider
+	fetching, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			close(fetching)
+			<-release
+		}
+		stub.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	stub, err := oidctest.NewProvider(srv.URL, "client", "secret")
+	require.NoError(t, err)
+
+	p := oidc.NewProvider(config.OIDCProvider{Issuer: srv.URL, ClientID: "client"}, srv.Client())
+	_, err = p.Discovery(ctx)
+	require.NoError(t, err)
+
+	token, err := stub.SignIDToken(&oidc.Claims{
+		Issuer:    srv.URL,
+		Subject:   "user-1",
+		Audience:  oidc.Audience{"client"},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	go p.VerifyIDToken(ctx, token, "")
+	<-fetching
+
+	// the provider stays usable while the keys are fetched
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := p.AuthCodeURL(ctx, "state", "nonce", "challenge")
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the keys fetch holds up the provider")
+	}
+}
@@ -0,0 +1,130 @@
+// Package ratelimit throttles requests with a sliding window counter kept
+// in the in-memory storage
+package ratelimit
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/storage"
+)
+
+const (
+	keyPrefix = "rate_limit_"
+	// errorLogInterval is how often a failing store is logged at most
+	errorLogInterval = time.Minute
+)
+
+// Result is the state of the limit after a request
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// Reset is when the current window ends
+	Reset time.Duration
+}
+
+type Limiter struct {
+	store    storage.InMemoryStorageI
+	fallback storage.InMemoryStorageI
+	now      func() time.Time
+	logf     func(format string, v ...interface{})
+
+	mu       sync.Mutex
+	loggedAt time.Time
+}
+
+// New returns a limiter counting in store. While store fails, e.g. Redis
+// is down, the requests are counted in process instead
+func New(store storage.InMemoryStorageI) *Limiter {
+	return &Limiter{
+		store:    store,
+		fallback: storage.NewInMemoryStorageLocal(),
+		now:      time.Now,
+		logf:     log.Printf,
+	}
+}
+
+// Allow counts a request of key against the limit. The count of the
+// previous window is weighted by how much of it the sliding window still
+// covers
+func (l *Limiter) Allow(key string, limit config.RateLimit) Result {
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return Result{Allowed: true}
+	}
+
+	now := l.now()
+	start := now.Truncate(limit.Window)
+
+	current, previous, err := count(l.store, keyPrefix+key, start, limit.Window)
+	if err != nil {
+		l.logStoreError(now, err)
+
+		current, previous, err = count(l.fallback, keyPrefix+key, start, limit.Window)
+		if err != nil {
+			return Result{Allowed: true}
+		}
+	}
+
+	elapsed := now.Sub(start)
+	weight := float64(limit.Window-elapsed) / float64(limit.Window)
+	used := current + int64(float64(previous)*weight)
+
+	remaining := limit.Requests - used
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Result{
+		Allowed:   used <= limit.Requests,
+		Limit:     limit.Requests,
+		Remaining: remaining,
+		Reset:     limit.Window - elapsed,
+	}
+}
+
+// logStoreError logs the failure of the store once per errorLogInterval,
+// not on every request while it is down
+func (l *Limiter) logStoreError(now time.Time, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.loggedAt.IsZero() && now.Sub(l.loggedAt) < errorLogInterval {
+		return
+	}
+
+	l.loggedAt = now
+	l.logf("rate limit store failed, counting in process: %v", err)
+}
+
+// count increments the counter of the window starting at start and returns
+// it along with the counter of the previous window
+func count(store storage.InMemoryStorageI, key string, start time.Time, window time.Duration) (int64, int64, error) {
+	current, err := store.Incr(windowKey(key, start), 2*window)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	value, err := store.Get(windowKey(key, start.Add(-window)))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return current, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	previous, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return current, previous, nil
+}
+
+func windowKey(key string, start time.Time) string {
+	return key + "_" + strconv.FormatInt(start.UnixMilli(), 10)
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore is a storage that is down
+type failingStore struct {
+	storage.InMemoryStorageI
+}
+
+func (failingStore) Incr(key string, exp time.Duration) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func newTestLimiter(store storage.InMemoryStorageI, now *time.Time) *Limiter {
+	l := New(store)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(storage.NewInMemoryStorageLocal(), &now)
+	limit := config.RateLimit{Requests: 3, Window: time.Minute}
+
+	for i := int64(1); i <= 3; i++ {
+		res := l.Allow("user_1", limit)
+		require.True(t, res.Allowed)
+		require.Equal(t, int64(3), res.Limit)
+		require.Equal(t, 3-i, res.Remaining)
+		require.Equal(t, time.Minute, res.Reset)
+	}
+
+	res := l.Allow("user_1", limit)
+	require.False(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+
+	// the keys are limited separately
+	require.True(t, l.Allow("user_2", limit).Allowed)
+
+	// a quarter into the next window 3/4 of the previous one still counts
+	now = now.Add(time.Minute + 15*time.Second)
+	require.False(t, l.Allow("user_1", limit).Allowed)
+
+	// two thirds into it only 1/3 of the previous one does
+	now = now.Add(25 * time.Second)
+	res = l.Allow("user_1", limit)
+	require.True(t, res.Allowed)
+	require.Equal(t, 20*time.Second, res.Reset)
+
+	// the window after the next one forgets the requests
+	now = now.Add(2 * time.Minute)
+	require.Equal(t, int64(2), l.Allow("user_1", limit).Remaining)
+}
+
+func TestAllowDisabled(t *testing.T) {
+	now := time.Now()
+	l := newTestLimiter(storage.NewInMemoryStorageLocal(), &now)
+
+	for i := 0; i < 10; i++ {
+		require.True(t, l.Allow("user_1", config.RateLimit{}).Allowed)
+	}
+}
+
+func TestAllowFallback(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(failingStore{}, &now)
+	limit := config.RateLimit{Requests: 1, Window: time.Minute}
+
+	require.True(t, l.Allow("user_1", limit).Allowed)
+	require.False(t, l.Allow("user_1", limit).Allowed)
+}
+
+func TestAllowFallbackLogs(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(failingStore{}, &now)
+	limit := config.RateLimit{Requests: 100, Window: time.Minute}
+
+	var logged int
+	l.logf = func(format string, v ...interface{}) { logged++ }
+
+	for i := 0; i < 10; i++ {
+		l.Allow("user_1", limit)
+	}
+	require.Equal(t, 1, logged)
+
+	now = now.Add(time.Minute)
+	l.Allow("user_1", limit)
+	require.Equal(t, 2, logged)
+}
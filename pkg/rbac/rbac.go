@@ -0,0 +1,131 @@
+// Package rbac holds the permissions of the user roles
+package rbac
+
+import "github.com/TemurMannonov/blog/storage/repo"
+
+type Permission string
+
+const (
+	// ManageUsers allows creating users and changing their roles
+	ManageUsers Permission = "users:manage"
+	// ManageCategories allows creating, updating and deleting categories
+	ManageCategories Permission = "categories:manage"
+	// CreatePosts allows writing own posts
+	CreatePosts Permission = "posts:create"
+	// ManagePosts allows viewing, updating and deleting posts of others
+	ManagePosts Permission = "posts:manage"
+	// CreateComments allows commenting on posts
+	CreateComments Permission = "comments:create"
+	// ModerateComments allows updating and removing comments of others
+	ModerateComments Permission = "comments:moderate"
+	// ManageEmails allows viewing and resending the outbox emails
+	ManageEmails Permission = "emails:manage"
+)
+
+// permissions is the permission matrix of the roles
+var permissions = map[string][]Permission{
+	repo.UserTypeSuperadmin: {
+		ManageUsers,
+		ManageCategories,
+		CreatePosts,
+		ManagePosts,
+		CreateComments,
+		ModerateComments,
+		ManageEmails,
+	},
+	repo.UserTypeEditor: {
+		ManageCategories,
+		CreatePosts,
+		ManagePosts,
+		CreateComments,
+		ModerateComments,
+	},
+	repo.UserTypeModerator: {
+		CreateComments,
+		ModerateComments,
+	},
+	repo.UserTypeAuthor: {
+		CreatePosts,
+		CreateComments,
+	},
+	repo.UserTypeReader: {
+		CreateComments,
+	},
+}
+
+// Can reports whether the role has the permission
+func Can(role string, permission Permission) bool {
+	for _, p := range permissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles returns the known roles
+func Roles() []string {
+	return []string{
+		repo.UserTypeSuperadmin,
+		repo.UserTypeEditor,
+		repo.UserTypeModerator,
+		repo.UserTypeAuthor,
+		repo.UserTypeReader,
+	}
+}
+
+// Scope limits what a personal access token may do. The role of the
+// token owner still applies on top of it
+type Scope string
+
+const (
+	ScopeUsersRead       Scope = "users:read"
+	ScopeUsersWrite      Scope = "users:write"
+	ScopeCategoriesWrite Scope = "categories:write"
+	ScopePostsRead       Scope = "posts:read"
+	ScopePostsWrite      Scope = "posts:write"
+	ScopeCommentsRead    Scope = "comments:read"
+	ScopeCommentsWrite   Scope = "comments:write"
+	ScopeLikesRead       Scope = "likes:read"
+	ScopeLikesWrite      Scope = "likes:write"
+	ScopeFilesWrite      Scope = "files:write"
+	// ScopeAdmin allows the user management and the admin routes
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes returns the known scopes
+func Scopes() []Scope {
+	return []Scope{
+		ScopeUsersRead,
+		ScopeUsersWrite,
+		ScopeCategoriesWrite,
+		ScopePostsRead,
+		ScopePostsWrite,
+		ScopeCommentsRead,
+		ScopeCommentsWrite,
+		ScopeLikesRead,
+		ScopeLikesWrite,
+		ScopeFilesWrite,
+		ScopeAdmin,
+	}
+}
+
+// ValidScope reports whether the scope is known
+func ValidScope(scope string) bool {
+	for _, s := range Scopes() {
+		if string(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the granted scopes contain the scope
+func HasScope(granted []string, scope Scope) bool {
+	for _, s := range granted {
+		if s == string(scope) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCan(t *testing.T) {
+	require.True(t, Can(repo.UserTypeEditor, ManageCategories))
+	require.False(t, Can(repo.UserTypeEditor, ManageUsers))
+	require.True(t, Can(repo.UserTypeModerator, ModerateComments))
+	require.False(t, Can(repo.UserTypeModerator, CreatePosts))
+	require.True(t, Can(repo.UserTypeAuthor, CreatePosts))
+	require.False(t, Can(repo.UserTypeAuthor, ManagePosts))
+	require.False(t, Can(repo.UserTypeReader, CreatePosts))
+	require.False(t, Can("unknown", CreateComments))
+
+	// every role may comment and the superadmin may do anything
+	for _, role := range Roles() {
+		require.True(t, Can(role, CreateComments), role)
+	}
+	for _, p := range permissions[repo.UserTypeEditor] {
+		require.True(t, Can(repo.UserTypeSuperadmin, p), p)
+	}
+	for _, p := range permissions[repo.UserTypeModerator] {
+		require.True(t, Can(repo.UserTypeSuperadmin, p), p)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	for _, s := range Scopes() {
+		require.True(t, ValidScope(string(s)), s)
+	}
+	require.False(t, ValidScope("posts:delete"))
+	require.False(t, ValidScope(""))
+
+	require.True(t, HasScope([]string{"posts:read", "posts:write"}, ScopePostsWrite))
+	require.False(t, HasScope([]string{"posts:read"}, ScopePostsWrite))
+	require.False(t, HasScope(nil, ScopePostsRead))
+}
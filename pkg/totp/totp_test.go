@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHOTPVectors(t *testing.T) {
+	for unix, code := range map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	} {
+		require.Equal(t, code, hotp(rfcSecret, uint64(Step(time.Unix(unix, 0))), 8))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString(rfcSecret)
+	now := time.Unix(1111111109, 0)
+
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+	require.Equal(t, "081804", code)
+
+	step, ok := Validate(secret, code, now, 1)
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+
+	_, ok = Validate(secret, code, now.Add(Period), 1)
+	require.True(t, ok)
+
+	_, ok = Validate(secret, code, now.Add(2*Period), 1)
+	require.False(t, ok)
+
+	_, ok = Validate(secret, "000000", now, 1)
+	require.False(t, ok)
+
+	_, ok = Validate("not base32!", code, now, 1)
+	require.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+
+	other, err := GenerateSecret()
+	require.NoError(t, err)
+	require.NotEqual(t, secret, other)
+
+	uri := URI("Blog", "user@example.com", secret)
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Blog:user@example.com?"))
+	require.Contains(t, uri, "secret="+secret)
+	require.Contains(t, uri, "issuer=Blog")
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/TemurMannonov/blog/pkg/jwks"
+	"github.com/golang-jwt/jwt"
+)
+
+// minRSABits is the smallest accepted RSA key
+const minRSABits = 2048
+
+var ErrNoSigningKey = errors.New("no token signing key: set AUTH_SECRET_KEY or JWT_SIGNING_KEY_ID")
+
+// KeyRing holds the keys signing and verifying the tokens. Asymmetric
+// keys are identified by the kid header of the tokens and published as a
+// JWKS, so other services can verify the tokens without a shared secret
+type KeyRing struct {
+	// secret signs and verifies the HS256 tokens, which have no kid
+	secret  []byte
+	signing *signingKey
+	keys    map[string]*signingKey
+	set     jwks.Set
+
+	// secretUntil ends the verification of the HS256 tokens unless it is zero
+	secretUntil time.Time
+}
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private is nil for the keys rotated out that only verify
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// NewKeyRing loads the keys of cfg. Without a signing key the tokens are
+// signed with HS256 and secret, otherwise secret only verifies the HS256
+// tokens until cfg.SecretVerifyUntil
+func NewKeyRing(cfg config.JWT, secret string) (*KeyRing, error) {
+	ring := &KeyRing{
+		secret: []byte(secret),
+		keys:   make(map[string]*signingKey),
+		set: jwks.Set{
+			Keys: make([]jwks.Key, 0),
+		},
+	}
+
+	for _, k := range cfg.Keys {
+		if _, ok := ring.keys[k.ID]; ok {
+			return nil, fmt.Errorf("jwt key %q: duplicate id", k.ID)
+		}
+
+		key, err := loadSigningKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", k.ID, err)
+		}
+
+		jwk, err := jwks.NewKey(key.id, key.method.Alg(), key.public)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", k.ID, err)
+		}
+
+		ring.keys[key.id] = key
+		ring.set.Keys = append(ring.set.Keys, jwk)
+	}
+
+	if cfg.SigningKeyID != "" {
+		key, ok := ring.keys[cfg.SigningKeyID]
+		if !ok {
+			return nil, fmt.Errorf("jwt signing key %q is not in JWT_KEYS", cfg.SigningKeyID)
+		}
+
+		if key.private == nil {
+			return nil, fmt.Errorf("jwt signing key %q has no private key", cfg.SigningKeyID)
+		}
+
+		ring.signing = key
+	} else if secret == "" {
+		return nil, ErrNoSigningKey
+	}
+
+	if cfg.SecretVerifyUntil != "" {
+		if ring.signing == nil {
+			return nil, errors.New("AUTH_SECRET_KEY_VERIFY_UNTIL needs a JWT_SIGNING_KEY_ID to sign the tokens with")
+		}
+
+		until, err := time.Parse(time.RFC3339, cfg.SecretVerifyUntil)
+		if err != nil {
+			return nil, fmt.Errorf("AUTH_SECRET_KEY_VERIFY_UNTIL: %w", err)
+		}
+		ring.secretUntil = until
+	}
+
+	return ring, nil
+}
+
+// JWKS returns the public keys verifying the tokens
+func (r *KeyRing) JWKS() *jwks.Set {
+	return &r.set
+}
+
+func (r *KeyRing) sign(claims jwt.Claims) (string, error) {
+	if r.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.secret)
+	}
+
+	token := jwt.NewWithClaims(r.signing.method, claims)
+	token.Header["kid"] = r.signing.id
+	return token.SignedString(r.signing.private)
+}
+
+// verificationKey returns the key of the token, its algorithm has to be
+// the one of the key
+func (r *KeyRing) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		_, isHMAC := token.Method.(*jwt.SigningMethodHMAC)
+		if !isHMAC || len(r.secret) == 0 {
+			return nil, ErrInvalidToken
+		}
+
+		if !r.secretUntil.IsZero() && time.Now().After(r.secretUntil) {
+			return nil, ErrInvalidToken
+		}
+		return r.secret, nil
+	}
+
+	key, ok := r.keys[kid]
+	if !ok || token.Method.Alg() != key.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+
+	return key.public, nil
+}
+
+func loadSigningKey(cfg config.JWTKey) (*signingKey, error) {
+	data := []byte(cfg.PEM)
+	if cfg.PEM == "" {
+		if cfg.File == "" {
+			return nil, errors.New("no PEM or file given")
+		}
+
+		var err error
+		data, err = os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{
+		id: cfg.ID,
+	}
+
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key.private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key.private != nil {
+		private, ok := key.private.(interface{ Public() crypto.PublicKey })
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key.private)
+		}
+		key.public = private.Public()
+	}
+
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("rsa keys need at least %d bits", minRSABits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ec keys are supported")
+		}
+		key.method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	return key, nil
+}
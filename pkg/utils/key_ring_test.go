@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func privatePEM(t *testing.T, key crypto.PrivateKey) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicPEM(t *testing.T, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func accessToken(t *testing.T, keys *KeyRing) string {
+	token, _, err := CreateToken(keys, &TokenParams{
+		UserID:    1,
+		TokenType: TokenTypeAccess,
+		Duration:  time.Minute,
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestKeyRingAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// the RSA key is a PKCS #1 file, the others are inline PKCS #8
+	rsaFile := filepath.Join(t.TempDir(), "rsa.pem")
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	require.NoError(t, os.WriteFile(rsaFile, rsaPEM, 0600))
+
+	keyConfigs := []config.JWTKey{
+		{ID: "rsa", File: rsaFile},
+		{ID: "ec", PEM: privatePEM(t, ecKey)},
+		{ID: "ed", PEM: privatePEM(t, edKey)},
+	}
+	algs := map[string]string{"rsa": "RS256", "ec": "ES256", "ed": "EdDSA"}
+
+	for _, kid := range []string{"rsa", "ec", "ed"} {
+		keys, err := NewKeyRing(config.JWT{SigningKeyID: kid, Keys: keyConfigs}, "")
+		require.NoError(t, err)
+		require.Len(t, keys.JWKS().Keys, 3)
+
+		token := accessToken(t, keys)
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &Payload{})
+		require.NoError(t, err)
+		require.Equal(t, kid, parsed.Header["kid"])
+		require.Equal(t, algs[kid], parsed.Method.Alg())
+
+		payload, err := VerifyToken(keys, token)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), payload.UserID)
+
+		// other services verify with the published keys only
+		jwk, err := keys.JWKS().Find(kid)
+		require.NoError(t, err)
+		require.Equal(t, algs[kid], jwk.Alg)
+		pub, err := jwk.PublicKey()
+		require.NoError(t, err)
+		_, err = jwt.ParseWithClaims(token, &Payload{}, func(*jwt.Token) (interface{}, error) {
+			return pub, nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	before, err := NewKeyRing(config.JWT{
+		SigningKeyID: "old",
+		Keys:         []config.JWTKey{{ID: "old", PEM: privatePEM(t, oldKey)}},
+	}, "secret")
+	require.NoError(t, err)
+	oldToken := accessToken(t, before)
+	secretToken, _, err := CreateToken(&KeyRing{secret: []byte("secret")}, &TokenParams{Duration: time.Minute})
+	require.NoError(t, err)
+
+	// the old key is kept as a public key only
+	after, err := NewKeyRing(config.JWT{
+		SigningKeyID: "new",
+		Keys: []config.JWTKey{
+			{ID: "new", PEM: privatePEM(t, newKey)},
+			{ID: "old", PEM: publicPEM(t, oldKey.Public())},
+		},
+	}, "secret")
+	require.NoError(t, err)
+
+	_, err = VerifyToken(after, oldToken)
+	require.NoError(t, err)
+	_, err = VerifyToken(after, accessToken(t, after))
+	require.NoError(t, err)
+	_, err = VerifyToken(before, accessToken(t, after))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// the HS256 tokens verify while the secret is set
+	_, err = VerifyToken(after, secretToken)
+	require.NoError(t, err)
+
+	noSecret, err := NewKeyRing(config.JWT{
+		SigningKeyID: "new",
+		Keys:         []config.JWTKey{{ID: "new", PEM: privatePEM(t, newKey)}},
+	}, "")
+	require.NoError(t, err)
+	_, err = VerifyToken(noSecret, secretToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = VerifyToken(noSecret, oldToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestKeyRingSecretVerifyUntil(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	secretToken, _, err := CreateToken(&KeyRing{secret: []byte("secret")}, &TokenParams{Duration: time.Minute})
+	require.NoError(t, err)
+
+	ring := func(until time.Time) *KeyRing {
+		keys, err := NewKeyRing(config.JWT{
+			SigningKeyID:      "ed",
+			Keys:              []config.JWTKey{{ID: "ed", PEM: privatePEM(t, key)}},
+			SecretVerifyUntil: until.Format(time.RFC3339),
+		}, "secret")
+		require.NoError(t, err)
+		return keys
+	}
+
+	_, err = VerifyToken(ring(time.Now().Add(time.Hour)), secretToken)
+	require.NoError(t, err)
+
+	// the secret no longer verifies after the deadline
+	keys := ring(time.Now().Add(-time.Second))
+	_, err = VerifyToken(keys, secretToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = VerifyToken(keys, accessToken(t, keys))
+	require.NoError(t, err)
+
+	// the deadline needs a signing key and a valid time
+	_, err = NewKeyRing(config.JWT{SecretVerifyUntil: time.Now().Format(time.RFC3339)}, "secret")
+	require.Error(t, err)
+
+	_, err = NewKeyRing(config.JWT{
+		SigningKeyID:      "ed",
+		Keys:              []config.JWTKey{{ID: "ed", PEM: privatePEM(t, key)}},
+		SecretVerifyUntil: "tomorrow",
+	}, "secret")
+	require.Error(t, err)
+}
+
+func TestKeyRingAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys, err := NewKeyRing(config.JWT{
+		SigningKeyID: "rsa",
+		Keys:         []config.JWTKey{{ID: "rsa", PEM: privatePEM(t, rsaKey)}},
+	}, "")
+	require.NoError(t, err)
+
+	// an HS256 token keyed with the public key claiming the RSA kid
+	payload, err := NewPayload(&TokenParams{Duration: time.Minute})
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString([]byte(publicPEM(t, &rsaKey.PublicKey)))
+	require.NoError(t, err)
+
+	_, err = VerifyToken(keys, token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestKeyRingConfig(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	_, err = NewKeyRing(config.JWT{}, "")
+	require.ErrorIs(t, err, ErrNoSigningKey)
+
+	tests := map[string]config.JWT{
+		"unknown signing key": {
+			SigningKeyID: "missing",
+			Keys:         []config.JWTKey{{ID: "ed", PEM: privatePEM(t, edKey)}},
+		},
+		"public signing key": {
+			SigningKeyID: "ed",
+			Keys:         []config.JWTKey{{ID: "ed", PEM: publicPEM(t, edKey.Public())}},
+		},
+		"weak rsa key": {
+			Keys: []config.JWTKey{{ID: "rsa", PEM: privatePEM(t, rsaKey)}},
+		},
+		"duplicate id": {
+			Keys: []config.JWTKey{
+				{ID: "ed", PEM: privatePEM(t, edKey)},
+				{ID: "ed", PEM: privatePEM(t, edKey)},
+			},
+		},
+		"no key": {
+			Keys: []config.JWTKey{{ID: "ed"}},
+		},
+		"not a PEM": {
+			Keys: []config.JWTKey{{ID: "ed", PEM: "secret"}},
+		},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewKeyRing(cfg, "secret")
+			require.Error(t, err)
+		})
+	}
+}
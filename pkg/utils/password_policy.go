@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/TemurMannonov/blog/config"
+)
+
+// bcryptMaxBytes is the longest password bcrypt hashes, it ignores the
+// bytes after it
+const bcryptMaxBytes = 72
+
+// PasswordPolicyError lists the rules a password breaks
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+// PasswordPolicy validates new passwords
+type PasswordPolicy struct {
+	cfg      config.PasswordPolicy
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy returns the policy of cfg, loading its breached password file
+func NewPasswordPolicy(cfg config.PasswordPolicy) (*PasswordPolicy, error) {
+	p := PasswordPolicy{
+		cfg:      cfg,
+		breached: make(map[string]struct{}),
+	}
+
+	if cfg.BreachedFile == "" {
+		return &p, nil
+	}
+
+	f, err := os.Open(cfg.BreachedFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			p.breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+
+	return &p, nil
+}
+
+// Validate returns a *PasswordPolicyError if the password breaks any rule
+func (p *PasswordPolicy) Validate(password string) error {
+	var violations []string
+
+	if len([]rune(password)) < p.cfg.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.cfg.MinLength))
+	}
+
+	// the maximum counts bytes, as a multi-byte password within a
+	// character limit could still be truncated by bcrypt
+	maxBytes := p.cfg.MaxLength
+	if maxBytes <= 0 || maxBytes > bcryptMaxBytes {
+		maxBytes = bcryptMaxBytes
+	}
+
+	if len(password) > maxBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", maxBytes))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	for _, rule := range []struct {
+		required bool
+		met      bool
+		text     string
+	}{
+		{p.cfg.RequireLower, lower, "must contain a lowercase letter"},
+		{p.cfg.RequireUpper, upper, "must contain an uppercase letter"},
+		{p.cfg.RequireDigit, digit, "must contain a digit"},
+		{p.cfg.RequireSymbol, symbol, "must contain a symbol"},
+	} {
+		if rule.required && !rule.met {
+			violations = append(violations, rule.text)
+		}
+	}
+
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		violations = append(violations, "is known from data breaches")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
@@ -2,8 +2,12 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/TemurMannonov/blog/config"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,3 +26,47 @@ func TestPassword(t *testing.T) {
 	err = CheckPassword(password, hashedPassword)
 	require.NoError(t, err)
 }
+
+func TestPasswordPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# common passwords\nPassword1\nqwerty\n"), 0o644))
+
+	policy, err := NewPasswordPolicy(config.PasswordPolicy{
+		MinLength:    8,
+		MaxLength:    72,
+		RequireLower: true,
+		RequireUpper: true,
+		RequireDigit: true,
+		BreachedFile: file,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, policy.Validate("Correct1horse"))
+
+	var policyErr *PasswordPolicyError
+	err = policy.Validate("short")
+	require.ErrorAs(t, err, &policyErr)
+	require.Len(t, policyErr.Violations, 3)
+	require.Contains(t, err.Error(), "at least 8 characters")
+
+	require.Error(t, policy.Validate("alllowercase1"))
+	require.Error(t, policy.Validate(strings.Repeat("Aa1", 25)))
+
+	// 40 characters but 77 bytes, bcrypt would ignore the last 5
+	err = policy.Validate("Aa1" + strings.Repeat("é", 37))
+	require.ErrorAs(t, err, &policyErr)
+	require.Equal(t, []string{"must be at most 72 bytes long"}, policyErr.Violations)
+
+	// longer limits are capped to what bcrypt hashes
+	long, err := NewPasswordPolicy(config.PasswordPolicy{MaxLength: 100})
+	require.NoError(t, err)
+	require.Error(t, long.Validate(strings.Repeat("a", 73)))
+	require.NoError(t, long.Validate(strings.Repeat("a", 72)))
+
+	err = policy.Validate("password1")
+	require.ErrorAs(t, err, &policyErr)
+	require.Equal(t, []string{"must contain an uppercase letter", "is known from data breaches"}, policyErr.Violations)
+
+	_, err = NewPasswordPolicy(config.PasswordPolicy{BreachedFile: filepath.Join(t.TempDir(), "missing.txt")})
+	require.Error(t, err)
+}
@@ -13,12 +13,34 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// Types of the issued tokens
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypePasswordReset only allows to set a new password after a
+	// verified forgot password code
+	TokenTypePasswordReset = "password_reset"
+	// TokenTypeTwoFactorChallenge is issued by the first step of a login
+	// of users with two-factor authentication
+	TokenTypeTwoFactorChallenge = "2fa_challenge"
+	// TokenTypeMagicLink is sent in the passwordless login links, it can
+	// be exchanged once for a login
+	TokenTypeMagicLink = "magic_link"
+	// TokenTypePersonalAccess marks the payloads of personal access
+	// tokens, which aren't JWTs but are looked up in the storage
+	TokenTypePersonalAccess = "personal_access"
+)
+
 // Payload contains the payload data of the token
 type Payload struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    int64     `json:"user_id"`
 	Email     string    `json:"email"`
 	UserType  string    `json:"type"`
+	TokenType string    `json:"token_type"`
+	FamilyID  uuid.UUID `json:"family_id"`
+	// Scopes limit personal access tokens, the other tokens aren't limited
+	Scopes    []string  `json:"scopes,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
@@ -35,6 +57,8 @@ func NewPayload(params *TokenParams) (*Payload, error) {
 		UserID:    params.UserID,
 		Email:     params.Email,
 		UserType:  params.UserType,
+		TokenType: params.TokenType,
+		FamilyID:  params.FamilyID,
 		IssuedAt:  time.Now(),
 		ExpiredAt: time.Now().Add(params.Duration),
 	}
@@ -4,41 +4,35 @@ import (
 	"errors"
 	"time"
 
-	"github.com/TemurMannonov/blog/config"
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
 type TokenParams struct {
-	UserID   int64
-	Username string
-	Email    string
-	UserType string
+	UserID    int64
+	Username  string
+	Email     string
+	UserType  string
+	TokenType string
+	// FamilyID groups a login's access token with the refresh tokens rotated from it
+	FamilyID uuid.UUID
 	Duration time.Duration
 }
 
-// CreateToken creates a new token
-func CreateToken(cfg *config.Config, params *TokenParams) (string, *Payload, error) {
+// CreateToken creates a new token signed by the signing key of the ring
+func CreateToken(keys *KeyRing, params *TokenParams) (string, *Payload, error) {
 	payload, err := NewPayload(params)
 	if err != nil {
 		return "", payload, err
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	token, err := jwtToken.SignedString([]byte(cfg.AuthSecretKey))
+	token, err := keys.sign(payload)
 	return token, payload, err
 }
 
 // VerifyToken checks if the token is valid or not
-func VerifyToken(cfg *config.Config, token string) (*Payload, error) {
-	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(cfg.AuthSecretKey), nil
-	}
-
-	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+func VerifyToken(keys *KeyRing, token string) (*Payload, error) {
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keys.verificationKey)
 	if err != nil {
 		verr, ok := err.(*jwt.ValidationError)
 		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/config"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	keys, err := NewKeyRing(config.JWT{}, "secret")
+	require.NoError(t, err)
+	familyID := uuid.New()
+
+	token, payload, err := CreateToken(keys, &TokenParams{
+		UserID:    1,
+		Email:     "user@example.com",
+		UserType:  "author",
+		TokenType: TokenTypeRefresh,
+		FamilyID:  familyID,
+		Duration:  time.Minute,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	verified, err := VerifyToken(keys, token)
+	require.NoError(t, err)
+	require.Equal(t, payload.ID, verified.ID)
+	require.Equal(t, TokenTypeRefresh, verified.TokenType)
+	require.Equal(t, familyID, verified.FamilyID)
+	require.Equal(t, "author", verified.UserType)
+
+	other, err := NewKeyRing(config.JWT{}, "other")
+	require.NoError(t, err)
+	_, err = VerifyToken(other, token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestExpiredToken(t *testing.T) {
+	keys, err := NewKeyRing(config.JWT{}, "secret")
+	require.NoError(t, err)
+
+	token, _, err := CreateToken(keys, &TokenParams{
+		UserID:    1,
+		TokenType: TokenTypeAccess,
+		Duration:  -time.Minute,
+	})
+	require.NoError(t, err)
+
+	_, err = VerifyToken(keys, token)
+	require.ErrorIs(t, err, ErrExpiredToken)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/TemurMannonov/blog/pkg/email"
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type emailOutbox struct {
+	repo.EmailOutboxStorageI
+}
+
+// NewEmailOutbox returns the outbox the email worker sends from
+func NewEmailOutbox(outbox repo.EmailOutboxStorageI) email.Outbox {
+	return &emailOutbox{
+		EmailOutboxStorageI: outbox,
+	}
+}
+
+func (o *emailOutbox) ClaimDue(now time.Time, lease time.Duration, limit int32) ([]*email.QueuedEmail, error) {
+	emails, err := o.EmailOutboxStorageI.ClaimDue(now, lease, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*email.QueuedEmail, 0, len(emails))
+	for _, e := range emails {
+		result = append(result, &email.QueuedEmail{
+			ID:       e.ID,
+			Attempts: e.Attempts,
+			Request:  OutboxEmailRequest(e),
+		})
+	}
+
+	return result, nil
+}
+
+// OutboxEmailRequest returns the request the outbox email is rendered from
+func OutboxEmailRequest(e *repo.OutboxEmail) *email.SendEmailRequest {
+	return &email.SendEmailRequest{
+		To:      e.To,
+		Type:    e.Type,
+		Body:    e.Body,
+		Secrets: e.Secrets,
+	}
+}
+
+type emailSecrets struct {
+	inMemory InMemoryStorageI
+}
+
+// NewEmailSecrets returns the store of the email secrets kept in inMemory
+func NewEmailSecrets(inMemory InMemoryStorageI) email.SecretStore {
+	return &emailSecrets{
+		inMemory: inMemory,
+	}
+}
+
+func (s *emailSecrets) Secret(key string) (string, error) {
+	value, err := s.inMemory.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return "", email.ErrSecretExpired
+	}
+	return value, err
+}
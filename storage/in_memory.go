@@ -2,14 +2,24 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/go-redis/redis/v9"
 )
 
+// ErrKeyNotFound is returned by Get for missing and expired keys
+var ErrKeyNotFound = errors.New("key not found")
+
 type InMemoryStorageI interface {
 	Set(key, value string, exp time.Duration) error
 	Get(key string) (string, error)
+	Exists(key string) (bool, error)
+	// Delete removes the key and reports whether it existed
+	Delete(key string) (bool, error)
+	// Incr increments the counter of the key and returns its new value.
+	// A new counter expires after exp
+	Incr(key string, exp time.Duration) (int64, error)
 }
 
 type storageRedis struct {
@@ -32,8 +42,41 @@ func (r *storageRedis) Set(key, value string, exp time.Duration) error {
 
 func (r *storageRedis) Get(key string) (string, error) {
 	val, err := r.client.Get(context.Background(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrKeyNotFound
+	}
 	if err != nil {
 		return "", err
 	}
 	return val, nil
 }
+
+func (r *storageRedis) Exists(key string) (bool, error) {
+	count, err := r.client.Exists(context.Background(), key).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *storageRedis) Delete(key string) (bool, error) {
+	count, err := r.client.Del(context.Background(), key).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// incrScript increments a counter and sets the expiry of a new one in a
+// single step, so a failure in between can't leave a counter that never expires
+var incrScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (r *storageRedis) Incr(key string, exp time.Duration) (int64, error) {
+	return incrScript.Run(context.Background(), r.client, []string{key}, exp.Milliseconds()).Int64()
+}
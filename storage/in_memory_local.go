@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// localSweepInterval is how often the expired keys get removed
+const localSweepInterval = time.Minute
+
+type localItem struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (i *localItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
+
+type storageLocal struct {
+	mu        sync.Mutex
+	items     map[string]*localItem
+	lastSweep time.Time
+}
+
+// NewInMemoryStorageLocal returns an in-process InMemoryStorageI for running
+// without Redis. Its keys are not shared between instances of the service
+func NewInMemoryStorageLocal() InMemoryStorageI {
+	return &storageLocal{
+		items:     make(map[string]*localItem),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *storageLocal) Set(key, value string, exp time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.set(key, value, exp)
+	return nil
+}
+
+func (l *storageLocal) Get(key string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	item := l.get(key)
+	if item == nil {
+		return "", ErrKeyNotFound
+	}
+	return item.value, nil
+}
+
+func (l *storageLocal) Exists(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.get(key) != nil, nil
+}
+
+func (l *storageLocal) Delete(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	existed := l.get(key) != nil
+	delete(l.items, key)
+	return existed, nil
+}
+
+func (l *storageLocal) Incr(key string, exp time.Duration) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	item := l.get(key)
+	if item == nil {
+		l.set(key, "1", exp)
+		return 1, nil
+	}
+
+	count, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	count++
+	item.value = strconv.FormatInt(count, 10)
+	return count, nil
+}
+
+// get returns the item of the key unless it is missing or expired
+func (l *storageLocal) get(key string) *localItem {
+	item, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+
+	if item.expired(time.Now()) {
+		delete(l.items, key)
+		return nil
+	}
+	return item
+}
+
+func (l *storageLocal) set(key, value string, exp time.Duration) {
+	now := time.Now()
+
+	item := localItem{value: value}
+	if exp > 0 {
+		item.expiresAt = now.Add(exp)
+	}
+	l.items[key] = &item
+
+	if now.Sub(l.lastSweep) >= localSweepInterval {
+		for k, i := range l.items {
+			if i.expired(now) {
+				delete(l.items, k)
+			}
+		}
+		l.lastSweep = now
+	}
+}
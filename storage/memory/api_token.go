@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type apiTokenRepo struct {
+	db *DB
+}
+
+func NewAPIToken(db *DB) repo.APITokenStorageI {
+	return &apiTokenRepo{
+		db: db,
+	}
+}
+
+func (tr *apiTokenRepo) Create(t *repo.APIToken) (*repo.APIToken, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if _, ok := tr.db.users[t.UserID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	for _, other := range tr.db.apiTokens {
+		if other.TokenHash == t.TokenHash {
+			return nil, ErrUniqueViolation
+		}
+	}
+
+	tr.db.apiTokenSeq++
+	token := repo.APIToken{
+		ID:        tr.db.apiTokenSeq,
+		UserID:    t.UserID,
+		Name:      t.Name,
+		Prefix:    t.Prefix,
+		TokenHash: t.TokenHash,
+		Scopes:    append([]string(nil), t.Scopes...),
+		ExpiresAt: t.ExpiresAt.UTC().Truncate(time.Microsecond),
+		CreatedAt: now(),
+	}
+	tr.db.apiTokens[token.ID] = &token
+
+	return copyAPIToken(&token), nil
+}
+
+func (tr *apiTokenRepo) GetByHash(tokenHash string) (*repo.APIToken, error) {
+	tr.db.mu.RLock()
+	defer tr.db.mu.RUnlock()
+
+	for _, t := range tr.db.apiTokens {
+		if t.TokenHash == tokenHash {
+			return copyAPIToken(t), nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (tr *apiTokenRepo) GetAll(userID int64) ([]*repo.APIToken, error) {
+	tr.db.mu.RLock()
+	defer tr.db.mu.RUnlock()
+
+	result := make([]*repo.APIToken, 0)
+	for _, t := range tr.db.apiTokens {
+		if t.UserID == userID {
+			result = append(result, copyAPIToken(t))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return createdAtLess(result[i].CreatedAt, result[j].CreatedAt, result[i].ID, result[j].ID, true)
+	})
+
+	return result, nil
+}
+
+func (tr *apiTokenRepo) Delete(userID, id int64) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	t, ok := tr.db.apiTokens[id]
+	if !ok || t.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	delete(tr.db.apiTokens, id)
+	return nil
+}
+
+func (tr *apiTokenRepo) DeleteAll(userID int64) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	tr.db.deleteAPITokens(userID)
+	return nil
+}
+
+func (tr *apiTokenRepo) UpdateLastUsed(id int64, usedAt time.Time) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if t, ok := tr.db.apiTokens[id]; ok {
+		usedAt = usedAt.UTC().Truncate(time.Microsecond)
+		t.LastUsedAt = &usedAt
+	}
+
+	return nil
+}
+
+// deleteAPITokens revokes every token of the user
+func (db *DB) deleteAPITokens(userID int64) {
+	for id, t := range db.apiTokens {
+		if t.UserID == userID {
+			delete(db.apiTokens, id)
+		}
+	}
+}
+
+func copyAPIToken(t *repo.APIToken) *repo.APIToken {
+	result := *t
+	result.Scopes = append([]string(nil), t.Scopes...)
+	if t.LastUsedAt != nil {
+		usedAt := *t.LastUsedAt
+		result.LastUsedAt = &usedAt
+	}
+	return &result
+}
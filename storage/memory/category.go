@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type categoryRepo struct {
+	db *DB
+}
+
+func NewCategory(db *DB) repo.CategoryStorageI {
+	return &categoryRepo{
+		db: db,
+	}
+}
+
+func (cr *categoryRepo) Create(category *repo.Category) (*repo.Category, error) {
+	cr.db.mu.Lock()
+	defer cr.db.mu.Unlock()
+
+	if cr.titleExists(category.Title, 0) {
+		return nil, ErrUniqueViolation
+	}
+
+	cr.db.categorySeq++
+	category.ID = cr.db.categorySeq
+	category.CreatedAt = now()
+
+	c := *category
+	cr.db.categories[c.ID] = &c
+
+	return category, nil
+}
+
+func (cr *categoryRepo) Get(id int64) (*repo.Category, error) {
+	cr.db.mu.RLock()
+	defer cr.db.mu.RUnlock()
+
+	c, ok := cr.db.categories[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	result := *c
+	return &result, nil
+}
+
+func (cr *categoryRepo) GetAll(params *repo.GetAllCategoriesParams) (*repo.GetAllCategoriesResult, error) {
+	cr.db.mu.RLock()
+	defer cr.db.mu.RUnlock()
+
+	result := repo.GetAllCategoriesResult{
+		Categories: make([]*repo.Category, 0),
+	}
+
+	categories := make([]*repo.Category, 0)
+	for _, c := range cr.db.categories {
+		if params.Search != "" && !iLike(c.Title, params.Search) {
+			continue
+		}
+		categories = append(categories, c)
+	}
+
+	sort.Slice(categories, func(i, j int) bool {
+		return createdAtLess(categories[i].CreatedAt, categories[j].CreatedAt, categories[i].ID, categories[j].ID, true)
+	})
+
+	start, end := paginate(len(categories), params.Page, params.Limit)
+	for _, c := range categories[start:end] {
+		category := *c
+		result.Categories = append(result.Categories, &category)
+	}
+	result.Count = int32(len(categories))
+
+	return &result, nil
+}
+
+func (cr *categoryRepo) Update(category *repo.Category) (*repo.Category, error) {
+	cr.db.mu.Lock()
+	defer cr.db.mu.Unlock()
+
+	c, ok := cr.db.categories[category.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	if cr.titleExists(category.Title, category.ID) {
+		return nil, ErrUniqueViolation
+	}
+
+	c.Title = category.Title
+	category.CreatedAt = c.CreatedAt
+
+	return category, nil
+}
+
+func (cr *categoryRepo) Delete(id int64) error {
+	cr.db.mu.Lock()
+	defer cr.db.mu.Unlock()
+
+	if _, ok := cr.db.categories[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	for _, p := range cr.db.posts {
+		if p.CategoryID == id {
+			return ErrForeignKeyViolation
+		}
+	}
+
+	delete(cr.db.categories, id)
+
+	return nil
+}
+
+func (cr *categoryRepo) titleExists(title string, exceptID int64) bool {
+	for _, c := range cr.db.categories {
+		if c.Title == title && c.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type commentRepo struct {
+	db *DB
+}
+
+func NewComment(db *DB) repo.CommentStorageI {
+	return &commentRepo{
+		db: db,
+	}
+}
+
+func (cr *commentRepo) Create(comment *repo.Comment) (*repo.Comment, error) {
+	cr.db.mu.Lock()
+	defer cr.db.mu.Unlock()
+
+	if _, ok := cr.db.users[comment.UserID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	if _, ok := cr.db.posts[comment.PostID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	if comment.ParentID != nil {
+		if _, ok := cr.db.comments[*comment.ParentID]; !ok {
+			return nil, ErrForeignKeyViolation
+		}
+	}
+
+	cr.db.commentSeq++
+	comment.ID = cr.db.commentSeq
+	comment.CreatedAt = now()
+
+	c := *comment
+	cr.db.comments[c.ID] = &c
+
+	return comment, nil
+}
+
+func (cr *commentRepo) Get(id int64) (*repo.Comment, error) {
+	cr.db.mu.RLock()
+	defer cr.db.mu.RUnlock()
+
+	c, ok := cr.db.comments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	result := cr.withUser(c)
+	result.Post.UserID = cr.db.posts[c.PostID].UserID
+
+	return result, nil
+}
+
+func (cr *commentRepo) GetAll(params *repo.GetAllCommentsParams) (*repo.GetAllCommentsResult, error) {
+	cr.db.mu.RLock()
+	defer cr.db.mu.RUnlock()
+
+	result := repo.GetAllCommentsResult{
+		Comments: make([]*repo.Comment, 0),
+	}
+
+	comments := make([]*repo.Comment, 0)
+	for _, c := range cr.db.comments {
+		if params.UserID != 0 && c.UserID != params.UserID {
+			continue
+		}
+
+		if params.PostID != 0 && c.PostID != params.PostID {
+			continue
+		}
+
+		if params.ParentID != 0 && (c.ParentID == nil || *c.ParentID != params.ParentID) {
+			continue
+		}
+
+		if params.RootOnly && c.ParentID != nil {
+			continue
+		}
+
+		if p := cr.db.posts[c.PostID]; p.Status != repo.PostStatusPublished && p.UserID != params.ViewerID {
+			continue
+		}
+
+		if _, ok := cr.db.users[c.UserID]; !ok {
+			continue
+		}
+
+		comments = append(comments, c)
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		return createdAtLess(comments[i].CreatedAt, comments[j].CreatedAt, comments[i].ID, comments[j].ID, true)
+	})
+
+	page := comments
+	if params.Cursor != nil {
+		page, result.HasMore = keyset(comments, commentKey, params.Cursor, true, params.Limit)
+	} else {
+		start, end := paginate(len(comments), params.Page, params.Limit)
+		page = comments[start:end]
+		result.Count = int32(len(comments))
+		result.HasMore = end < len(comments)
+	}
+
+	for _, c := range page {
+		result.Comments = append(result.Comments, cr.withUser(c))
+	}
+
+	return &result, nil
+}
+
+func (cr *commentRepo) GetReplies(parentIDs []int64, depth int32) ([]*repo.Comment, error) {
+	cr.db.mu.RLock()
+	defer cr.db.mu.RUnlock()
+
+	result := make([]*repo.Comment, 0)
+
+	parents := parentIDs
+	for level := int32(0); level < depth && len(parents) > 0; level++ {
+		children := make([]int64, 0)
+		for _, parentID := range parents {
+			for _, c := range cr.db.comments {
+				if c.ParentID != nil && *c.ParentID == parentID {
+					result = append(result, cr.withUser(c))
+					children = append(children, c.ID)
+				}
+			}
+		}
+		parents = children
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return createdAtLess(result[i].CreatedAt, result[j].CreatedAt, result[i].ID, result[j].ID, false)
+	})
+
+	return result, nil
+}
+
+func (cr *commentRepo) Update(comment *repo.Comment) (*repo.Comment, error) {
+	cr.db.mu.Lock()
+	defer cr.db.mu.Unlock()
+
+	c, ok := cr.db.comments[comment.ID]
+	if !ok || c.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	updatedAt := now()
+	c.Description = comment.Description
+	c.UpdatedAt = &updatedAt
+
+	comment.UserID = c.UserID
+	comment.PostID = c.PostID
+	comment.ParentID = c.ParentID
+	comment.CreatedAt = c.CreatedAt
+	comment.UpdatedAt = c.UpdatedAt
+
+	return comment, nil
+}
+
+func (cr *commentRepo) Delete(id int64) error {
+	cr.db.mu.Lock()
+	defer cr.db.mu.Unlock()
+
+	c, ok := cr.db.comments[id]
+	if !ok || c.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	if cr.repliesCount(id) > 0 {
+		deletedAt := now()
+		c.Description = ""
+		c.DeletedAt = &deletedAt
+		return nil
+	}
+
+	delete(cr.db.comments, id)
+	cr.db.deleteEmptyPlaceholders(c.ParentID)
+
+	return nil
+}
+
+// deleteEmptyPlaceholders removes the deleted ancestors, starting at
+// parentID, which have no replies left
+func (db *DB) deleteEmptyPlaceholders(parentID *int64) {
+	for parentID != nil {
+		parent, ok := db.comments[*parentID]
+		if !ok || parent.DeletedAt == nil || db.hasReplies(parent.ID) {
+			return
+		}
+
+		delete(db.comments, parent.ID)
+		parentID = parent.ParentID
+	}
+}
+
+func (cr *commentRepo) Search(params *repo.SearchParams) (*repo.SearchCommentsResult, error) {
+	cr.db.mu.RLock()
+	defer cr.db.mu.RUnlock()
+
+	result := repo.SearchCommentsResult{
+		Comments: make([]*repo.CommentSearchResult, 0),
+	}
+
+	search := parseSearchQuery(params.Query)
+
+	comments := make([]*repo.CommentSearchResult, 0)
+	for _, c := range cr.db.comments {
+		if c.DeletedAt != nil || cr.db.posts[c.PostID].Status != repo.PostStatusPublished {
+			continue
+		}
+
+		rank := search.rank([]string{c.Description}, []float32{1})
+		if rank == 0 {
+			continue
+		}
+
+		comments = append(comments, &repo.CommentSearchResult{
+			Comment: *cr.withUser(c),
+			Rank:    rank,
+			Snippet: search.headline(c.Description, true),
+		})
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].Rank != comments[j].Rank {
+			return comments[i].Rank > comments[j].Rank
+		}
+		return createdAtLess(comments[i].Comment.CreatedAt, comments[j].Comment.CreatedAt, comments[i].Comment.ID, comments[j].Comment.ID, true)
+	})
+
+	start, end := paginate(len(comments), params.Page, params.Limit)
+	result.Comments = append(result.Comments, comments[start:end]...)
+	result.Count = int32(len(comments))
+
+	return &result, nil
+}
+
+func commentKey(c *repo.Comment) (time.Time, int64) {
+	return c.CreatedAt, c.ID
+}
+
+func (cr *commentRepo) repliesCount(id int64) int32 {
+	var count int32
+	for _, c := range cr.db.comments {
+		if c.ParentID != nil && *c.ParentID == id {
+			count++
+		}
+	}
+	return count
+}
+
+// withUser returns a copy of the comment joined with its author
+func (cr *commentRepo) withUser(c *repo.Comment) *repo.Comment {
+	comment := *c
+	comment.RepliesCount = cr.repliesCount(c.ID)
+
+	u := cr.db.users[c.UserID]
+	comment.User.FirstName = u.FirstName
+	comment.User.LastName = u.LastName
+	comment.User.Email = u.Email
+	comment.User.ProfileImageUrl = u.ProfileImageUrl
+
+	return &comment
+}
@@ -0,0 +1,177 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type emailOutboxRepo struct {
+	db *DB
+}
+
+func NewEmailOutbox(db *DB) repo.EmailOutboxStorageI {
+	return &emailOutboxRepo{
+		db: db,
+	}
+}
+
+func (er *emailOutboxRepo) Create(e *repo.OutboxEmail) (*repo.OutboxEmail, error) {
+	er.db.mu.Lock()
+	defer er.db.mu.Unlock()
+
+	er.db.emailSeq++
+	email := repo.OutboxEmail{
+		ID:            er.db.emailSeq,
+		To:            append([]string(nil), e.To...),
+		Subject:       e.Subject,
+		Type:          e.Type,
+		Body:          copyStringMap(e.Body),
+		Secrets:       copyStringMap(e.Secrets),
+		Status:        repo.EmailStatusPending,
+		NextAttemptAt: now(),
+		CreatedAt:     now(),
+	}
+	er.db.emails[email.ID] = &email
+
+	return er.copy(&email), nil
+}
+
+func (er *emailOutboxRepo) Get(id int64) (*repo.OutboxEmail, error) {
+	er.db.mu.RLock()
+	defer er.db.mu.RUnlock()
+
+	e, ok := er.db.emails[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return er.copy(e), nil
+}
+
+func (er *emailOutboxRepo) GetAll(params *repo.GetAllEmailsParams) (*repo.GetAllEmailsResult, error) {
+	er.db.mu.RLock()
+	defer er.db.mu.RUnlock()
+
+	result := repo.GetAllEmailsResult{
+		Emails: make([]*repo.OutboxEmail, 0),
+	}
+
+	emails := make([]*repo.OutboxEmail, 0)
+	for _, e := range er.db.emails {
+		if params.Status != "" && e.Status != params.Status {
+			continue
+		}
+		emails = append(emails, e)
+	}
+
+	sort.Slice(emails, func(i, j int) bool {
+		return createdAtLess(emails[i].CreatedAt, emails[j].CreatedAt, emails[i].ID, emails[j].ID, true)
+	})
+
+	start, end := paginate(len(emails), params.Page, params.Limit)
+	for _, e := range emails[start:end] {
+		result.Emails = append(result.Emails, er.copy(e))
+	}
+	result.Count = int32(len(emails))
+
+	return &result, nil
+}
+
+func (er *emailOutboxRepo) ClaimDue(now time.Time, lease time.Duration, limit int32) ([]*repo.OutboxEmail, error) {
+	er.db.mu.Lock()
+	defer er.db.mu.Unlock()
+
+	due := make([]*repo.OutboxEmail, 0)
+	for _, e := range er.db.emails {
+		if e.Status == repo.EmailStatusPending && !e.NextAttemptAt.After(now) {
+			due = append(due, e)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return createdAtLess(due[i].NextAttemptAt, due[j].NextAttemptAt, due[i].ID, due[j].ID, false)
+	})
+
+	if len(due) > int(limit) {
+		due = due[:limit]
+	}
+
+	result := make([]*repo.OutboxEmail, 0, len(due))
+	for _, e := range due {
+		e.NextAttemptAt = now.Add(lease)
+		result = append(result, er.copy(e))
+	}
+
+	return result, nil
+}
+
+func (er *emailOutboxRepo) ClaimFailed(id int64, now time.Time, lease time.Duration) (*repo.OutboxEmail, error) {
+	er.db.mu.Lock()
+	defer er.db.mu.Unlock()
+
+	e, ok := er.db.emails[id]
+	if !ok || e.Status != repo.EmailStatusFailed {
+		return nil, sql.ErrNoRows
+	}
+
+	e.Status = repo.EmailStatusPending
+	e.NextAttemptAt = now.Add(lease)
+
+	return er.copy(e), nil
+}
+
+func (er *emailOutboxRepo) MarkSent(id int64, sentAt time.Time) error {
+	er.db.mu.Lock()
+	defer er.db.mu.Unlock()
+
+	e, ok := er.db.emails[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	e.Status = repo.EmailStatusSent
+	e.Attempts++
+	e.SentAt = &sentAt
+
+	return nil
+}
+
+func (er *emailOutboxRepo) MarkFailed(id int64, lastError string, nextAttemptAt *time.Time) error {
+	er.db.mu.Lock()
+	defer er.db.mu.Unlock()
+
+	e, ok := er.db.emails[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	e.Attempts++
+	e.LastError = &lastError
+	if nextAttemptAt == nil {
+		e.Status = repo.EmailStatusFailed
+	} else {
+		e.Status = repo.EmailStatusPending
+		e.NextAttemptAt = *nextAttemptAt
+	}
+
+	return nil
+}
+
+func (er *emailOutboxRepo) copy(e *repo.OutboxEmail) *repo.OutboxEmail {
+	email := *e
+	email.To = append([]string(nil), e.To...)
+	email.Body = copyStringMap(e.Body)
+	email.Secrets = copyStringMap(e.Secrets)
+	return &email
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"database/sql"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type likeRepo struct {
+	db *DB
+}
+
+func NewLike(db *DB) repo.LikeStorageI {
+	return &likeRepo{
+		db: db,
+	}
+}
+
+func (lr *likeRepo) CreateOrUpdate(l *repo.Like) error {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	like := lr.find(l.UserID, l.PostID)
+	if like == nil {
+		if _, ok := lr.db.users[l.UserID]; !ok {
+			return ErrForeignKeyViolation
+		}
+
+		if _, ok := lr.db.posts[l.PostID]; !ok {
+			return ErrForeignKeyViolation
+		}
+
+		lr.db.likeSeq++
+		lr.db.likes[lr.db.likeSeq] = &repo.Like{
+			ID:     lr.db.likeSeq,
+			UserID: l.UserID,
+			PostID: l.PostID,
+			Status: l.Status,
+		}
+	} else if like.Status == l.Status {
+		delete(lr.db.likes, like.ID)
+	} else {
+		like.Status = l.Status
+	}
+
+	return nil
+}
+
+func (lr *likeRepo) Get(userID, postID int64) (*repo.Like, error) {
+	lr.db.mu.RLock()
+	defer lr.db.mu.RUnlock()
+
+	like := lr.find(userID, postID)
+	if like == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	result := *like
+	return &result, nil
+}
+
+func (lr *likeRepo) GetLikesDislikesCount(postID int64) (*repo.LikesDislikesCountsResult, error) {
+	lr.db.mu.RLock()
+	defer lr.db.mu.RUnlock()
+
+	var result repo.LikesDislikesCountsResult
+
+	for _, l := range lr.db.likes {
+		if l.PostID != postID {
+			continue
+		}
+
+		if l.Status {
+			result.LikesCount++
+		} else {
+			result.DislikesCount++
+		}
+	}
+
+	return &result, nil
+}
+
+func (lr *likeRepo) find(userID, postID int64) *repo.Like {
+	for _, l := range lr.db.likes {
+		if l.UserID == userID && l.PostID == postID {
+			return l
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/google/uuid"
+)
+
+// Errors returned where postgres would reject the statement with a constraint violation
+var (
+	ErrUniqueViolation     = errors.New("duplicate key value violates unique constraint")
+	ErrForeignKeyViolation = errors.New("violates foreign key constraint")
+)
+
+// DB holds the tables shared by all in-memory repositories
+type DB struct {
+	mu sync.RWMutex
+
+	users map[int64]*repo.User
+	// deletedUsers holds the anonymized users, they stay in users like
+	// rows still referenced by posts and comments
+	deletedUsers map[int64]bool
+	categories   map[int64]*repo.Category
+	posts        map[int64]*repo.Post
+	comments     map[int64]*repo.Comment
+	likes        map[int64]*repo.Like
+	tags         map[int64]*repo.Tag
+	postTags     map[int64][]int64
+	// revisions holds the revisions of each post, oldest first
+	revisions map[int64][]*repo.PostRevision
+	emails    map[int64]*repo.OutboxEmail
+	// twoFactors and recoveryCodes are keyed by user id
+	twoFactors    map[int64]*repo.TwoFactor
+	recoveryCodes map[int64][]*recoveryCode
+	apiTokens     map[int64]*repo.APIToken
+	identities    map[int64]*repo.UserIdentity
+	sessions      map[uuid.UUID]*repo.Session
+
+	userSeq     int64
+	categorySeq int64
+	postSeq     int64
+	commentSeq  int64
+	likeSeq     int64
+	tagSeq      int64
+	revisionSeq int64
+	emailSeq    int64
+	apiTokenSeq int64
+	identitySeq int64
+}
+
+// NewDB creates an empty in-memory database
+func NewDB() *DB {
+	return &DB{
+		users:         make(map[int64]*repo.User),
+		deletedUsers:  make(map[int64]bool),
+		categories:    make(map[int64]*repo.Category),
+		posts:         make(map[int64]*repo.Post),
+		comments:      make(map[int64]*repo.Comment),
+		likes:         make(map[int64]*repo.Like),
+		tags:          make(map[int64]*repo.Tag),
+		postTags:      make(map[int64][]int64),
+		revisions:     make(map[int64][]*repo.PostRevision),
+		emails:        make(map[int64]*repo.OutboxEmail),
+		twoFactors:    make(map[int64]*repo.TwoFactor),
+		recoveryCodes: make(map[int64][]*recoveryCode),
+		apiTokens:     make(map[int64]*repo.APIToken),
+		identities:    make(map[int64]*repo.UserIdentity),
+		sessions:      make(map[uuid.UUID]*repo.Session),
+	}
+}
+
+// now returns the current time in the microsecond precision of Postgres
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// iLike mimics `value ILIKE '%search%'`
+func iLike(value, search string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(search))
+}
+
+func iLikePtr(value *string, search string) bool {
+	return value != nil && iLike(*value, search)
+}
+
+// paginate returns the bounds of LIMIT/OFFSET applied to n rows
+func paginate(n int, page, limit int32) (int, int) {
+	offset := int((page - 1) * limit)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+
+	end := offset + int(limit)
+	if limit < 0 || end > n {
+		end = n
+	}
+
+	return offset, end
+}
+
+// createdAtLess orders rows by created_at with id as a tie breaker
+func createdAtLess(a, b time.Time, aID, bID int64, desc bool) bool {
+	if !a.Equal(b) {
+		if desc {
+			return a.After(b)
+		}
+		return a.Before(b)
+	}
+
+	if desc {
+		return aID > bID
+	}
+	return aID < bID
+}
+
+// keyset mimics the Postgres keyset pagination on rows sorted by
+// createdAtLess: it returns the limit rows following the cursor, or
+// preceding it for backward cursors, and whether more rows remain
+func keyset[T any](rows []T, key func(T) (time.Time, int64), cursor *repo.Cursor, desc bool, limit int32) ([]T, bool) {
+	page := make([]T, 0)
+	for _, row := range rows {
+		createdAt, id := key(row)
+
+		var ok bool
+		if cursor.Backward {
+			ok = createdAtLess(createdAt, cursor.CreatedAt, id, cursor.ID, desc)
+		} else {
+			ok = createdAtLess(cursor.CreatedAt, createdAt, cursor.ID, id, desc)
+		}
+
+		if ok {
+			page = append(page, row)
+		}
+	}
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	if len(page) <= int(limit) {
+		return page, false
+	}
+
+	if cursor.Backward {
+		return page[len(page)-int(limit):], true
+	}
+	return page[:limit], true
+}
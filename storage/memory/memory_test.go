@@ -0,0 +1,12 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/TemurMannonov/blog/storage"
+	"github.com/TemurMannonov/blog/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, storage.NewStorageMemory())
+}
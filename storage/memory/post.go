@@ -0,0 +1,304 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type postRepo struct {
+	db *DB
+}
+
+func NewPost(db *DB) repo.PostStorageI {
+	return &postRepo{
+		db: db,
+	}
+}
+
+func (pr *postRepo) Create(post *repo.Post) (*repo.Post, error) {
+	pr.db.mu.Lock()
+	defer pr.db.mu.Unlock()
+
+	if _, ok := pr.db.users[post.UserID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	if _, ok := pr.db.categories[post.CategoryID]; !ok {
+		return nil, repo.ErrCategoryNotFound
+	}
+
+	if post.Status == "" {
+		post.Status = repo.PostStatusPublished
+	}
+
+	if post.Status == repo.PostStatusPublished && post.PublishAt == nil {
+		publishAt := now()
+		post.PublishAt = &publishAt
+	}
+
+	pr.db.postSeq++
+	post.ID = pr.db.postSeq
+	post.CreatedAt = now()
+	post.UpdatedAt = nil
+	post.ViewsCount = 0
+
+	p := *post
+	p.Tags = nil
+	pr.db.posts[p.ID] = &p
+	pr.db.setPostTags(p.ID, post.Tags)
+	pr.db.addPostRevision(&p)
+
+	return post, nil
+}
+
+func (pr *postRepo) Get(id int64) (*repo.Post, error) {
+	pr.db.mu.RLock()
+	defer pr.db.mu.RUnlock()
+
+	p, ok := pr.db.posts[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	result := *p
+	result.Tags = pr.db.getPostTags(p.ID)
+
+	return &result, nil
+}
+
+func (pr *postRepo) IncrementViews(id int64) error {
+	pr.db.mu.Lock()
+	defer pr.db.mu.Unlock()
+
+	p, ok := pr.db.posts[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	p.ViewsCount++
+
+	return nil
+}
+
+func (pr *postRepo) GetAll(params *repo.GetAllPostsParams) (*repo.GetAllPostsResult, error) {
+	pr.db.mu.RLock()
+	defer pr.db.mu.RUnlock()
+
+	result := repo.GetAllPostsResult{
+		Posts: make([]*repo.Post, 0),
+	}
+
+	search := parseSearchQuery(params.Search)
+
+	posts := make([]*repo.Post, 0)
+	for _, p := range pr.db.posts {
+		if params.Search != "" && pr.rank(search, p) == 0 {
+			continue
+		}
+
+		if params.UserID != 0 && p.UserID != params.UserID {
+			continue
+		}
+
+		if params.CategoryID != 0 && p.CategoryID != params.CategoryID {
+			continue
+		}
+
+		if len(params.Tags) > 0 && !pr.matchTags(p.ID, params.Tags, params.TagsMatchAll) {
+			continue
+		}
+
+		if p.Status != repo.PostStatusPublished && p.UserID != params.ViewerID {
+			continue
+		}
+
+		if params.Status != "" && p.Status != params.Status {
+			continue
+		}
+
+		posts = append(posts, p)
+	}
+
+	desc := params.SortByData != "asc"
+	sort.Slice(posts, func(i, j int) bool {
+		return createdAtLess(posts[i].CreatedAt, posts[j].CreatedAt, posts[i].ID, posts[j].ID, desc)
+	})
+
+	page := posts
+	if params.Cursor != nil {
+		page, result.HasMore = keyset(posts, postKey, params.Cursor, desc, params.Limit)
+	} else {
+		start, end := paginate(len(posts), params.Page, params.Limit)
+		page = posts[start:end]
+		result.Count = int32(len(posts))
+		result.HasMore = end < len(posts)
+	}
+
+	for _, p := range page {
+		post := *p
+		post.Tags = pr.db.getPostTags(p.ID)
+		result.Posts = append(result.Posts, &post)
+	}
+
+	return &result, nil
+}
+
+func (pr *postRepo) Update(post *repo.Post) (*repo.Post, error) {
+	pr.db.mu.Lock()
+	defer pr.db.mu.Unlock()
+
+	p, ok := pr.db.posts[post.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	if _, ok := pr.db.categories[post.CategoryID]; !ok {
+		return nil, repo.ErrCategoryNotFound
+	}
+
+	updatedAt := now()
+	p.Title = post.Title
+	p.Description = post.Description
+	p.ImageUrl = post.ImageUrl
+	p.CategoryID = post.CategoryID
+	p.UpdatedAt = &updatedAt
+	pr.db.addPostRevision(p)
+	if post.Status != "" {
+		p.Status = post.Status
+		p.PublishAt = post.PublishAt
+	}
+	pr.db.setPostTags(p.ID, post.Tags)
+
+	post.UserID = p.UserID
+	post.CreatedAt = p.CreatedAt
+	post.UpdatedAt = p.UpdatedAt
+	post.ViewsCount = p.ViewsCount
+	post.Status = p.Status
+	post.PublishAt = p.PublishAt
+
+	return post, nil
+}
+
+func (pr *postRepo) Delete(id int64) error {
+	pr.db.mu.Lock()
+	defer pr.db.mu.Unlock()
+
+	if _, ok := pr.db.posts[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	pr.db.deletePost(id)
+
+	return nil
+}
+
+// deletePost removes the post along with its likes, comments, tags and revisions
+func (db *DB) deletePost(id int64) {
+	for likeID, l := range db.likes {
+		if l.PostID == id {
+			delete(db.likes, likeID)
+		}
+	}
+
+	for commentID, c := range db.comments {
+		if c.PostID == id {
+			delete(db.comments, commentID)
+		}
+	}
+
+	delete(db.postTags, id)
+	delete(db.revisions, id)
+	delete(db.posts, id)
+}
+
+func (pr *postRepo) Search(params *repo.SearchParams) (*repo.SearchPostsResult, error) {
+	pr.db.mu.RLock()
+	defer pr.db.mu.RUnlock()
+
+	result := repo.SearchPostsResult{
+		Posts: make([]*repo.PostSearchResult, 0),
+	}
+
+	search := parseSearchQuery(params.Query)
+
+	posts := make([]*repo.PostSearchResult, 0)
+	for _, p := range pr.db.posts {
+		if p.Status != repo.PostStatusPublished {
+			continue
+		}
+
+		rank := pr.rank(search, p)
+		if rank == 0 {
+			continue
+		}
+
+		post := repo.PostSearchResult{
+			Post:     *p,
+			Rank:     rank,
+			Headline: search.headline(p.Title, false),
+			Snippet:  search.headline(p.Description, true),
+		}
+		post.Post.Tags = pr.db.getPostTags(p.ID)
+		posts = append(posts, &post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].Rank != posts[j].Rank {
+			return posts[i].Rank > posts[j].Rank
+		}
+		return createdAtLess(posts[i].Post.CreatedAt, posts[j].Post.CreatedAt, posts[i].Post.ID, posts[j].Post.ID, true)
+	})
+
+	start, end := paginate(len(posts), params.Page, params.Limit)
+	result.Posts = append(result.Posts, posts[start:end]...)
+	result.Count = int32(len(posts))
+
+	return &result, nil
+}
+
+func (pr *postRepo) PublishScheduled(now time.Time) (int64, error) {
+	pr.db.mu.Lock()
+	defer pr.db.mu.Unlock()
+
+	var count int64
+	for _, p := range pr.db.posts {
+		if p.Status == repo.PostStatusScheduled && p.PublishAt != nil && !p.PublishAt.After(now) {
+			p.Status = repo.PostStatusPublished
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func postKey(p *repo.Post) (time.Time, int64) {
+	return p.CreatedAt, p.ID
+}
+
+func (pr *postRepo) rank(search *searchQuery, p *repo.Post) float32 {
+	return search.rank(
+		[]string{p.Title, p.Description},
+		[]float32{titleWeight, descriptionWeight},
+	)
+}
+
+func (pr *postRepo) matchTags(postID int64, tags []string, all bool) bool {
+	postTags := pr.db.getPostTags(postID)
+
+	matches := 0
+	for _, tag := range tags {
+		for _, t := range postTags {
+			if t == tag {
+				matches++
+				break
+			}
+		}
+	}
+
+	if all {
+		return matches == len(tags)
+	}
+	return matches > 0
+}
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type revisionRepo struct {
+	db *DB
+}
+
+func NewRevision(db *DB) repo.RevisionStorageI {
+	return &revisionRepo{
+		db: db,
+	}
+}
+
+func (rr *revisionRepo) Get(postID int64, revision int32) (*repo.PostRevision, error) {
+	rr.db.mu.RLock()
+	defer rr.db.mu.RUnlock()
+
+	for _, r := range rr.db.revisions[postID] {
+		if r.Revision == revision {
+			result := *r
+			return &result, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (rr *revisionRepo) GetAll(params *repo.GetAllRevisionsParams) (*repo.GetAllRevisionsResult, error) {
+	rr.db.mu.RLock()
+	defer rr.db.mu.RUnlock()
+
+	result := repo.GetAllRevisionsResult{
+		Revisions: make([]*repo.PostRevision, 0),
+	}
+
+	revisions := make([]*repo.PostRevision, 0)
+	for postID, postRevisions := range rr.db.revisions {
+		if params.PostID != 0 && postID != params.PostID {
+			continue
+		}
+		revisions = append(revisions, postRevisions...)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision > revisions[j].Revision
+	})
+
+	start, end := paginate(len(revisions), params.Page, params.Limit)
+	for _, r := range revisions[start:end] {
+		revision := *r
+		result.Revisions = append(result.Revisions, &revision)
+	}
+	result.Count = int32(len(revisions))
+
+	return &result, nil
+}
+
+// addPostRevision snapshots the post as its next revision unless its
+// content equals the latest revision
+func (db *DB) addPostRevision(p *repo.Post) {
+	revisions := db.revisions[p.ID]
+
+	revision := int32(1)
+	if len(revisions) > 0 {
+		last := revisions[len(revisions)-1]
+		if last.Title == p.Title &&
+			last.Description == p.Description &&
+			notDistinct(last.ImageUrl, p.ImageUrl) &&
+			last.CategoryID == p.CategoryID {
+			return
+		}
+		revision = last.Revision + 1
+	}
+
+	db.revisionSeq++
+	db.revisions[p.ID] = append(revisions, &repo.PostRevision{
+		ID:          db.revisionSeq,
+		PostID:      p.ID,
+		Revision:    revision,
+		Title:       p.Title,
+		Description: p.Description,
+		ImageUrl:    p.ImageUrl,
+		CategoryID:  p.CategoryID,
+		CreatedAt:   now(),
+	})
+}
+
+// notDistinct mimics `a IS NOT DISTINCT FROM b`
+func notDistinct(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Weights of the title and description matches, as postgres ranks 'A' and 'B' labels
+const (
+	titleWeight       = 1.0
+	descriptionWeight = 0.4
+	snippetMaxWords   = 35
+	snippetMinWords   = 15
+)
+
+// searchQuery approximates websearch_to_tsquery: every word has to be
+// present and words prefixed with "-" must be absent
+type searchQuery struct {
+	include []string
+	exclude []string
+}
+
+func parseSearchQuery(query string) *searchQuery {
+	var q searchQuery
+
+	for _, word := range strings.Fields(query) {
+		exclude := strings.HasPrefix(word, "-")
+		for _, token := range tokenize(word) {
+			if exclude {
+				q.exclude = append(q.exclude, token)
+			} else {
+				q.include = append(q.include, token)
+			}
+		}
+	}
+
+	return &q
+}
+
+// rank returns zero when the texts do not match, otherwise a weighted number of matches
+func (q *searchQuery) rank(texts []string, weights []float32) float32 {
+	if len(q.include) == 0 {
+		return 0
+	}
+
+	found := make(map[string]bool)
+	var rank float32
+
+	for i, text := range texts {
+		for _, token := range tokenize(text) {
+			if containsString(q.exclude, token) {
+				return 0
+			}
+
+			if containsString(q.include, token) {
+				found[token] = true
+				rank += weights[i]
+			}
+		}
+	}
+
+	if len(found) != len(uniqueStrings(q.include)) {
+		return 0
+	}
+
+	return rank
+}
+
+// headline escapes the HTML of text and wraps the matched words in <b></b>.
+// With fragment set only the words around the first match are kept, like
+// ts_headline MaxWords
+func (q *searchQuery) headline(text string, fragment bool) string {
+	words := strings.Fields(text)
+
+	first := -1
+	for i, word := range words {
+		words[i] = html.EscapeString(word)
+		for _, token := range tokenize(word) {
+			if containsString(q.include, token) {
+				words[i] = "<b>" + words[i] + "</b>"
+				if first == -1 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+
+	if fragment && len(words) > snippetMaxWords {
+		start := first - snippetMinWords
+		if start < 0 {
+			start = 0
+		}
+
+		end := start + snippetMaxWords
+		if end > len(words) {
+			end = len(words)
+		}
+		words = words[start:end]
+	}
+
+	return strings.Join(words, " ")
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueStrings(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !containsString(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
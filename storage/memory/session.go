@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/google/uuid"
+)
+
+type sessionRepo struct {
+	db *DB
+}
+
+func NewSession(db *DB) repo.SessionStorageI {
+	return &sessionRepo{
+		db: db,
+	}
+}
+
+func (sr *sessionRepo) Create(s *repo.Session) (*repo.Session, error) {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	if _, ok := sr.db.users[s.UserID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	if _, ok := sr.db.sessions[s.ID]; ok {
+		return nil, ErrUniqueViolation
+	}
+
+	session := *s
+	session.CreatedAt = now()
+	session.LastSeenAt = session.CreatedAt
+	session.ExpiresAt = s.ExpiresAt.UTC().Truncate(time.Microsecond)
+	sr.db.sessions[session.ID] = &session
+
+	result := session
+	return &result, nil
+}
+
+func (sr *sessionRepo) Get(id uuid.UUID) (*repo.Session, error) {
+	sr.db.mu.RLock()
+	defer sr.db.mu.RUnlock()
+
+	s, ok := sr.db.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	result := *s
+	return &result, nil
+}
+
+func (sr *sessionRepo) GetAll(userID int64) ([]*repo.Session, error) {
+	sr.db.mu.RLock()
+	defer sr.db.mu.RUnlock()
+
+	current := now()
+	result := make([]*repo.Session, 0)
+	for _, s := range sr.db.sessions {
+		if s.UserID == userID && s.ExpiresAt.After(current) {
+			session := *s
+			result = append(result, &session)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].LastSeenAt.Equal(result[j].LastSeenAt) {
+			return result[i].LastSeenAt.After(result[j].LastSeenAt)
+		}
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func (sr *sessionRepo) UpdateLastSeen(id uuid.UUID, ip string, seenAt time.Time) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	s, ok := sr.db.sessions[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	s.IP = ip
+	s.LastSeenAt = seenAt.UTC().Truncate(time.Microsecond)
+	return nil
+}
+
+func (sr *sessionRepo) Extend(id uuid.UUID, expiresAt time.Time) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	s, ok := sr.db.sessions[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	s.ExpiresAt = expiresAt.UTC().Truncate(time.Microsecond)
+	return nil
+}
+
+func (sr *sessionRepo) Delete(id uuid.UUID) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	if _, ok := sr.db.sessions[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(sr.db.sessions, id)
+	return nil
+}
+
+func (sr *sessionRepo) DeleteAll(userID int64) (int64, error) {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	return sr.db.deleteSessions(userID), nil
+}
+
+// deleteSessions deletes the sessions of the user and returns their number
+func (db *DB) deleteSessions(userID int64) int64 {
+	var count int64
+	for id, s := range db.sessions {
+		if s.UserID == userID {
+			delete(db.sessions, id)
+			count++
+		}
+	}
+	return count
+}
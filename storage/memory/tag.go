@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"sort"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type tagRepo struct {
+	db *DB
+}
+
+func NewTag(db *DB) repo.TagStorageI {
+	return &tagRepo{
+		db: db,
+	}
+}
+
+func (tr *tagRepo) GetAll(params *repo.GetAllTagsParams) (*repo.GetAllTagsResult, error) {
+	tr.db.mu.RLock()
+	defer tr.db.mu.RUnlock()
+
+	result := repo.GetAllTagsResult{
+		Tags: make([]*repo.Tag, 0),
+	}
+
+	counts := make(map[int64]int32)
+	for postID, tagIDs := range tr.db.postTags {
+		if tr.db.posts[postID].Status != repo.PostStatusPublished {
+			continue
+		}
+
+		for _, id := range tagIDs {
+			counts[id]++
+		}
+	}
+
+	tags := make([]*repo.Tag, 0)
+	for _, t := range tr.db.tags {
+		if params.Search != "" && !iLike(t.Name, params.Search) {
+			continue
+		}
+
+		tag := *t
+		tag.PostsCount = counts[t.ID]
+		tags = append(tags, &tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].PostsCount != tags[j].PostsCount {
+			return tags[i].PostsCount > tags[j].PostsCount
+		}
+		return tags[i].Name < tags[j].Name
+	})
+
+	start, end := paginate(len(tags), params.Page, params.Limit)
+	result.Tags = append(result.Tags, tags[start:end]...)
+	result.Count = int32(len(tags))
+
+	return &result, nil
+}
+
+// setPostTags replaces the tags of a post, creating the missing ones
+func (db *DB) setPostTags(postID int64, names []string) {
+	tagIDs := make([]int64, 0, len(names))
+
+	for _, name := range names {
+		var tag *repo.Tag
+		for _, t := range db.tags {
+			if t.Name == name {
+				tag = t
+				break
+			}
+		}
+
+		if tag == nil {
+			db.tagSeq++
+			tag = &repo.Tag{
+				ID:        db.tagSeq,
+				Name:      name,
+				CreatedAt: now(),
+			}
+			db.tags[tag.ID] = tag
+		}
+
+		if !containsID(tagIDs, tag.ID) {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+	}
+
+	if len(tagIDs) == 0 {
+		delete(db.postTags, postID)
+		return
+	}
+	db.postTags[postID] = tagIDs
+}
+
+// getPostTags returns the tag names of a post sorted by name
+func (db *DB) getPostTags(postID int64) []string {
+	names := make([]string, 0)
+	for _, id := range db.postTags[postID] {
+		names = append(names, db.tags[id].Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"database/sql"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+// recoveryCode is a row of user_recovery_codes
+type recoveryCode struct {
+	hash string
+	used bool
+}
+
+type twoFactorRepo struct {
+	db *DB
+}
+
+func NewTwoFactor(db *DB) repo.TwoFactorStorageI {
+	return &twoFactorRepo{
+		db: db,
+	}
+}
+
+func (tr *twoFactorRepo) Enable(userID int64, secret string, recoveryCodeHashes []string) (*repo.TwoFactor, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if _, ok := tr.db.users[userID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	codes := make([]*recoveryCode, 0, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes = append(codes, &recoveryCode{hash: hash})
+	}
+
+	tr.db.twoFactors[userID] = &repo.TwoFactor{
+		UserID:    userID,
+		Secret:    secret,
+		EnabledAt: now(),
+	}
+	tr.db.recoveryCodes[userID] = codes
+
+	return tr.get(userID), nil
+}
+
+func (tr *twoFactorRepo) Get(userID int64) (*repo.TwoFactor, error) {
+	tr.db.mu.RLock()
+	defer tr.db.mu.RUnlock()
+
+	if _, ok := tr.db.twoFactors[userID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return tr.get(userID), nil
+}
+
+func (tr *twoFactorRepo) get(userID int64) *repo.TwoFactor {
+	result := *tr.db.twoFactors[userID]
+	for _, code := range tr.db.recoveryCodes[userID] {
+		if !code.used {
+			result.RecoveryCodesLeft++
+		}
+	}
+
+	return &result
+}
+
+func (tr *twoFactorRepo) Disable(userID int64) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if _, ok := tr.db.twoFactors[userID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	tr.db.disableTwoFactor(userID)
+	return nil
+}
+
+func (tr *twoFactorRepo) UseRecoveryCode(userID int64, codeHash string) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	for _, code := range tr.db.recoveryCodes[userID] {
+		if code.hash == codeHash && !code.used {
+			code.used = true
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (db *DB) disableTwoFactor(userID int64) {
+	delete(db.twoFactors, userID)
+	delete(db.recoveryCodes, userID)
+}
@@ -0,0 +1,268 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type userRepo struct {
+	db *DB
+}
+
+func NewUser(db *DB) repo.UserStorageI {
+	return &userRepo{
+		db: db,
+	}
+}
+
+func (ur *userRepo) Create(user *repo.User) (*repo.User, error) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	for _, u := range ur.db.users {
+		if u.Email == user.Email ||
+			equalPtr(u.PhoneNumber, user.PhoneNumber) ||
+			equalPtr(u.Username, user.Username) {
+			return nil, ErrUniqueViolation
+		}
+	}
+
+	ur.db.userSeq++
+	user.ID = ur.db.userSeq
+	user.CreatedAt = now()
+
+	u := *user
+	ur.db.users[u.ID] = &u
+
+	return user, nil
+}
+
+func (ur *userRepo) Get(id int64) (*repo.User, error) {
+	ur.db.mu.RLock()
+	defer ur.db.mu.RUnlock()
+
+	u, ok := ur.db.users[id]
+	if !ok || ur.db.deletedUsers[id] {
+		return nil, sql.ErrNoRows
+	}
+
+	result := *u
+	return &result, nil
+}
+
+func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersResult, error) {
+	ur.db.mu.RLock()
+	defer ur.db.mu.RUnlock()
+
+	result := repo.GetAllUsersResult{
+		Users: make([]*repo.User, 0),
+	}
+
+	users := make([]*repo.User, 0)
+	for _, u := range ur.db.users {
+		if ur.db.deletedUsers[u.ID] {
+			continue
+		}
+
+		if params.Search != "" &&
+			!iLike(u.FirstName, params.Search) &&
+			!iLike(u.LastName, params.Search) &&
+			!iLikePtr(u.Username, params.Search) &&
+			(!params.SearchContacts || !iLike(u.Email, params.Search) && !iLikePtr(u.PhoneNumber, params.Search)) {
+			continue
+		}
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return createdAtLess(users[i].CreatedAt, users[j].CreatedAt, users[i].ID, users[j].ID, true)
+	})
+
+	start, end := paginate(len(users), params.Page, params.Limit)
+	for _, u := range users[start:end] {
+		user := *u
+		result.Users = append(result.Users, &user)
+	}
+	result.Count = int32(len(users))
+
+	return &result, nil
+}
+
+func (ur *userRepo) GetByEmail(email string) (*repo.User, error) {
+	ur.db.mu.RLock()
+	defer ur.db.mu.RUnlock()
+
+	for _, u := range ur.db.users {
+		if u.Email == email && !ur.db.deletedUsers[u.ID] {
+			result := *u
+			return &result, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (ur *userRepo) UpdatePassword(req *repo.UpdatePassword) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	if u, ok := ur.db.users[req.UserID]; ok {
+		u.Password = req.Password
+	}
+
+	return nil
+}
+
+func (ur *userRepo) UpdateType(userID int64, userType string) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	u, ok := ur.db.users[userID]
+	if !ok || ur.db.deletedUsers[userID] {
+		return sql.ErrNoRows
+	}
+	u.Type = userType
+
+	return nil
+}
+
+func (ur *userRepo) Update(user *repo.User) (*repo.User, error) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	u, ok := ur.db.users[user.ID]
+	if !ok || ur.db.deletedUsers[user.ID] {
+		return nil, sql.ErrNoRows
+	}
+
+	for _, other := range ur.db.users {
+		if other.ID == user.ID {
+			continue
+		}
+
+		if equalPtr(other.Username, user.Username) {
+			return nil, repo.ErrUsernameTaken
+		}
+
+		if equalPtr(other.PhoneNumber, user.PhoneNumber) {
+			return nil, repo.ErrPhoneNumberTaken
+		}
+	}
+
+	u.FirstName = user.FirstName
+	u.LastName = user.LastName
+	u.PhoneNumber = user.PhoneNumber
+	u.Gender = user.Gender
+	u.Username = user.Username
+	u.ProfileImageUrl = user.ProfileImageUrl
+
+	result := *u
+	return &result, nil
+}
+
+func (ur *userRepo) UpdateEmail(userID int64, email string) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	u, ok := ur.db.users[userID]
+	if !ok || ur.db.deletedUsers[userID] {
+		return sql.ErrNoRows
+	}
+
+	for _, other := range ur.db.users {
+		if other.ID != userID && other.Email == email {
+			return repo.ErrEmailTaken
+		}
+	}
+	u.Email = email
+
+	return nil
+}
+
+func (ur *userRepo) Delete(id int64, policy string) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	u, ok := ur.db.users[id]
+	if !ok || ur.db.deletedUsers[id] {
+		return sql.ErrNoRows
+	}
+
+	if policy == repo.UserDeletePolicyRemove {
+		ur.db.removeUserContent(id)
+	}
+	ur.db.disableTwoFactor(id)
+	ur.db.deleteAPITokens(id)
+	ur.db.deleteIdentities(id)
+	ur.db.deleteSessions(id)
+
+	*u = repo.User{
+		ID:        u.ID,
+		FirstName: repo.DeletedUserFirstName,
+		LastName:  repo.DeletedUserLastName,
+		Email:     fmt.Sprintf("deleted_%d@deleted.invalid", id),
+		Type:      u.Type,
+		CreatedAt: u.CreatedAt,
+	}
+	ur.db.deletedUsers[id] = true
+
+	return nil
+}
+
+// removeUserContent removes the posts, comments and likes of the user.
+// Comments replied to by others are kept as deleted comments
+func (db *DB) removeUserContent(userID int64) {
+	for likeID, l := range db.likes {
+		if l.UserID == userID {
+			delete(db.likes, likeID)
+		}
+	}
+
+	for postID, p := range db.posts {
+		if p.UserID == userID {
+			db.deletePost(postID)
+		}
+	}
+
+	deletedAt := now()
+	for _, c := range db.comments {
+		if c.UserID == userID && c.DeletedAt == nil {
+			c.Description = ""
+			c.DeletedAt = &deletedAt
+		}
+	}
+
+	// removing a reply can turn its parent into a leaf
+	parents := make([]*int64, 0)
+	for removed := true; removed; {
+		removed = false
+		for id, c := range db.comments {
+			if c.UserID == userID && !db.hasReplies(id) {
+				delete(db.comments, id)
+				parents = append(parents, c.ParentID)
+				removed = true
+			}
+		}
+	}
+
+	// the placeholders of others only replied to by the user are empty now
+	for _, parentID := range parents {
+		db.deleteEmptyPlaceholders(parentID)
+	}
+}
+
+func (db *DB) hasReplies(commentID int64) bool {
+	for _, c := range db.comments {
+		if c.ParentID != nil && *c.ParentID == commentID {
+			return true
+		}
+	}
+	return false
+}
+
+func equalPtr(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+type userIdentityRepo struct {
+	db *DB
+}
+
+func NewUserIdentity(db *DB) repo.UserIdentityStorageI {
+	return &userIdentityRepo{
+		db: db,
+	}
+}
+
+func (ir *userIdentityRepo) Create(i *repo.UserIdentity) (*repo.UserIdentity, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	if _, ok := ir.db.users[i.UserID]; !ok {
+		return nil, ErrForeignKeyViolation
+	}
+
+	for _, other := range ir.db.identities {
+		if other.Provider == i.Provider && other.Subject == i.Subject {
+			return nil, repo.ErrIdentityTaken
+		}
+	}
+
+	ir.db.identitySeq++
+	identity := *i
+	identity.ID = ir.db.identitySeq
+	identity.CreatedAt = now()
+	ir.db.identities[identity.ID] = &identity
+
+	result := identity
+	return &result, nil
+}
+
+func (ir *userIdentityRepo) CreateUser(user *repo.User, i *repo.UserIdentity) (*repo.User, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	for _, u := range ir.db.users {
+		if u.Email == user.Email {
+			return nil, repo.ErrEmailTaken
+		}
+		if equalPtr(u.PhoneNumber, user.PhoneNumber) || equalPtr(u.Username, user.Username) {
+			return nil, ErrUniqueViolation
+		}
+	}
+
+	for _, other := range ir.db.identities {
+		if other.Provider == i.Provider && other.Subject == i.Subject {
+			return nil, repo.ErrIdentityTaken
+		}
+	}
+
+	ir.db.userSeq++
+	user.ID = ir.db.userSeq
+	user.CreatedAt = now()
+
+	u := *user
+	ir.db.users[u.ID] = &u
+
+	ir.db.identitySeq++
+	identity := *i
+	identity.ID = ir.db.identitySeq
+	identity.UserID = user.ID
+	identity.CreatedAt = now()
+	ir.db.identities[identity.ID] = &identity
+
+	return user, nil
+}
+
+func (ir *userIdentityRepo) Get(provider, subject string) (*repo.UserIdentity, error) {
+	ir.db.mu.RLock()
+	defer ir.db.mu.RUnlock()
+
+	for _, i := range ir.db.identities {
+		if i.Provider == provider && i.Subject == subject {
+			result := *i
+			return &result, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (ir *userIdentityRepo) GetAll(userID int64) ([]*repo.UserIdentity, error) {
+	ir.db.mu.RLock()
+	defer ir.db.mu.RUnlock()
+
+	result := make([]*repo.UserIdentity, 0)
+	for _, i := range ir.db.identities {
+		if i.UserID == userID {
+			identity := *i
+			result = append(result, &identity)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return createdAtLess(result[i].CreatedAt, result[j].CreatedAt, result[i].ID, result[j].ID, false)
+	})
+
+	return result, nil
+}
+
+func (ir *userIdentityRepo) Delete(userID, id int64) error {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	i, ok := ir.db.identities[id]
+	if !ok || i.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	delete(ir.db.identities, id)
+	return nil
+}
+
+// deleteIdentities unlinks every identity of the user
+func (db *DB) deleteIdentities(userID int64) {
+	for id, i := range db.identities {
+		if i.UserID == userID {
+			delete(db.identities, id)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type apiTokenRepo struct {
+	db *sqlx.DB
+}
+
+func NewAPIToken(db *sqlx.DB) repo.APITokenStorageI {
+	return &apiTokenRepo{
+		db: db,
+	}
+}
+
+const apiTokenColumns = `
+	id,
+	user_id,
+	name,
+	prefix,
+	token_hash,
+	scopes,
+	expires_at,
+	last_used_at,
+	created_at
+`
+
+func scanAPIToken(row scanner) (*repo.APIToken, error) {
+	var t repo.APIToken
+
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		&t.Prefix,
+		&t.TokenHash,
+		pq.Array(&t.Scopes),
+		&t.ExpiresAt,
+		&t.LastUsedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (tr *apiTokenRepo) Create(t *repo.APIToken) (*repo.APIToken, error) {
+	query := `
+		INSERT INTO api_tokens(
+			user_id,
+			name,
+			prefix,
+			token_hash,
+			scopes,
+			expires_at
+		) VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING ` + apiTokenColumns
+
+	return scanAPIToken(tr.db.QueryRow(
+		query,
+		t.UserID,
+		t.Name,
+		t.Prefix,
+		t.TokenHash,
+		pq.Array(t.Scopes),
+		t.ExpiresAt,
+	))
+}
+
+func (tr *apiTokenRepo) GetByHash(tokenHash string) (*repo.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash=$1`
+
+	return scanAPIToken(tr.db.QueryRow(query, tokenHash))
+}
+
+func (tr *apiTokenRepo) GetAll(userID int64) ([]*repo.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id=$1 ORDER BY created_at DESC, id DESC`
+
+	rows, err := tr.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*repo.APIToken, 0)
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, t)
+	}
+
+	return result, rows.Err()
+}
+
+func (tr *apiTokenRepo) Delete(userID, id int64) error {
+	result, err := tr.db.Exec(`DELETE FROM api_tokens WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (tr *apiTokenRepo) DeleteAll(userID int64) error {
+	_, err := tr.db.Exec(`DELETE FROM api_tokens WHERE user_id=$1`, userID)
+	return err
+}
+
+func (tr *apiTokenRepo) UpdateLastUsed(id int64, usedAt time.Time) error {
+	_, err := tr.db.Exec(`UPDATE api_tokens SET last_used_at=$1 WHERE id=$2`, usedAt, id)
+	return err
+}
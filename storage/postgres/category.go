@@ -2,7 +2,6 @@ package postgres
 
 import (
 	"database/sql"
-	"fmt"
 
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/jmoiron/sqlx"
@@ -70,26 +69,20 @@ func (cr *categoryRepo) GetAll(params *repo.GetAllCategoriesParams) (*repo.GetAl
 		Categories: make([]*repo.Category, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
+	qb := newQueryBuilder().
+		Search(params.Search, "title").
+		OrderBy("created_at", "desc").
+		Paginate(params.Page, params.Limit)
 
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
-	filter := ""
-	if params.Search != "" {
-		filter += " WHERE title ilike '%" + params.Search + "%' "
-	}
-
-	query := `
+	query, args := qb.Query(`
 		SELECT
 			id, 
 			title, 
 			created_at
 		FROM categories
-		` + filter + `
-		ORDER BY created_at desc
-		` + limit
+	`)
 
-	rows, err := cr.db.Query(query)
+	rows, err := cr.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -111,8 +104,8 @@ func (cr *categoryRepo) GetAll(params *repo.GetAllCategoriesParams) (*repo.GetAl
 		result.Categories = append(result.Categories, &c)
 	}
 
-	queryCount := `SELECT count(1) FROM categories ` + filter
-	err = cr.db.QueryRow(queryCount).Scan(&result.Count)
+	queryCount, args := qb.CountQuery(`SELECT count(1) FROM categories`)
+	err = cr.db.QueryRow(queryCount, args...).Scan(&result.Count)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,12 @@
 package postgres
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
 
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type commentRepo struct {
@@ -22,8 +24,9 @@ func (pr *commentRepo) Create(comment *repo.Comment) (*repo.Comment, error) {
 		INSERT INTO comments(
 			user_id,
 			post_id,
+			parent_id,
 			description
-		) VALUES($1, $2, $3)
+		) VALUES($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
 
@@ -31,6 +34,7 @@ func (pr *commentRepo) Create(comment *repo.Comment) (*repo.Comment, error) {
 		query,
 		comment.UserID,
 		comment.PostID,
+		comment.ParentID,
 		comment.Description,
 	)
 
@@ -45,42 +49,323 @@ func (pr *commentRepo) Create(comment *repo.Comment) (*repo.Comment, error) {
 	return comment, nil
 }
 
+func (pr *commentRepo) Get(id int64) (*repo.Comment, error) {
+	var result repo.Comment
+
+	query := `
+		SELECT
+			c.id,
+			c.user_id,
+			c.post_id,
+			c.parent_id,
+			c.description,
+			c.created_at,
+			c.updated_at,
+			c.deleted_at,
+			(SELECT count(1) FROM comments r WHERE r.parent_id=c.id) AS replies_count,
+			u.first_name,
+			u.last_name,
+			u.email,
+			u.profile_image_url,
+			p.user_id
+		FROM comments c
+		INNER JOIN users u ON u.id=c.user_id
+		INNER JOIN posts p ON p.id=c.post_id
+		WHERE c.id=$1
+	`
+
+	row := pr.db.QueryRow(query, id)
+	err := row.Scan(
+		&result.ID,
+		&result.UserID,
+		&result.PostID,
+		&result.ParentID,
+		&result.Description,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+		&result.DeletedAt,
+		&result.RepliesCount,
+		&result.User.FirstName,
+		&result.User.LastName,
+		&result.User.Email,
+		&result.User.ProfileImageUrl,
+		&result.Post.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 func (pr *commentRepo) GetAll(params *repo.GetAllCommentsParams) (*repo.GetAllCommentsResult, error) {
 	result := repo.GetAllCommentsResult{
 		Comments: make([]*repo.Comment, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
+	qb := newQueryBuilder().
+		Equal("c.user_id", params.UserID).
+		Equal("c.post_id", params.PostID).
+		Equal("c.parent_id", params.ParentID).
+		Where("(p.status=? OR p.user_id=?)", repo.PostStatusPublished, params.ViewerID)
+
+	if params.RootOnly {
+		qb.Where("c.parent_id IS NULL")
+	}
+
+	if params.Cursor != nil {
+		qb.Keyset("c.created_at", "c.id", params.Cursor, "desc", params.Limit)
+	} else {
+		qb.OrderBy("c.created_at", "desc").
+			OrderBy("c.id", "desc").
+			Paginate(params.Page, params.Limit)
+	}
+
+	query := `
+		SELECT
+			c.id,
+			c.user_id,
+			c.post_id,
+			c.parent_id,
+			c.description,
+			c.created_at,
+			c.updated_at,
+			c.deleted_at,
+			(SELECT count(1) FROM comments r WHERE r.parent_id=c.id) AS replies_count,
+			u.first_name,
+			u.last_name,
+			u.email,
+			u.profile_image_url
+		FROM comments c
+		INNER JOIN users u ON u.id=c.user_id
+		INNER JOIN posts p ON p.id=c.post_id`
+	query, args := qb.Query(query)
+
+	rows, err := pr.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
 
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
+		result.Comments = append(result.Comments, c)
+	}
 
-	filter := " WHERE true "
-	if params.UserID != 0 {
-		filter += fmt.Sprintf(" AND c.user_id=%d ", params.UserID)
+	if params.Cursor != nil {
+		result.Comments, result.HasMore = keysetPage(result.Comments, params.Cursor, params.Limit)
+		return &result, nil
 	}
 
-	if params.PostID != 0 {
-		filter += fmt.Sprintf(" AND c.post_id=%d ", params.PostID)
+	queryCount, args := qb.CountQuery(`
+		SELECT count(1) FROM comments c
+		INNER JOIN users u ON u.id=c.user_id
+		INNER JOIN posts p ON p.id=c.post_id`)
+	err = pr.db.QueryRow(queryCount, args...).Scan(&result.Count)
+	if err != nil {
+		return nil, err
 	}
+	result.HasMore = qb.hasMorePages(len(result.Comments), result.Count)
+
+	return &result, nil
+}
+
+func (pr *commentRepo) GetReplies(parentIDs []int64, depth int32) ([]*repo.Comment, error) {
+	result := make([]*repo.Comment, 0)
 
 	query := `
+		WITH RECURSIVE tree AS (
+			SELECT id, 1 AS depth FROM comments WHERE parent_id = ANY($1)
+			UNION ALL
+			SELECT c.id, t.depth + 1 FROM comments c
+			INNER JOIN tree t ON c.parent_id=t.id
+			WHERE t.depth < $2
+		)
 		SELECT
 			c.id,
 			c.user_id,
 			c.post_id,
+			c.parent_id,
 			c.description,
 			c.created_at,
 			c.updated_at,
+			c.deleted_at,
+			(SELECT count(1) FROM comments r WHERE r.parent_id=c.id) AS replies_count,
 			u.first_name,
 			u.last_name,
 			u.email,
 			u.profile_image_url
+		FROM tree t
+		INNER JOIN comments c ON c.id=t.id
+		INNER JOIN users u ON u.id=c.user_id
+		ORDER BY c.created_at
+	`
+
+	rows, err := pr.db.Query(query, pq.Array(parentIDs), depth)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
+
+func (pr *commentRepo) Update(comment *repo.Comment) (*repo.Comment, error) {
+	query := `
+		UPDATE comments SET
+			description=$1,
+			updated_at=CURRENT_TIMESTAMP
+		WHERE id=$2 AND deleted_at IS NULL
+		RETURNING user_id, post_id, parent_id, created_at, updated_at
+	`
+
+	err := pr.db.QueryRow(query, comment.Description, comment.ID).Scan(
+		&comment.UserID,
+		&comment.PostID,
+		&comment.ParentID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (pr *commentRepo) Delete(id int64) error {
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the parent, so removing the last replies of a placeholder
+	// concurrently can't leave it behind
+	_, err = tx.Exec(`
+		SELECT 1 FROM comments
+		WHERE id=(SELECT parent_id FROM comments WHERE id=$1)
+		FOR UPDATE
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE comments SET
+			description='',
+			deleted_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id=comments.id)
+	`
+
+	result, err := tx.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected > 0 {
+		return tx.Commit()
+	}
+
+	query = `
+		DELETE FROM comments WHERE id=$1 AND deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id=comments.id)
+		RETURNING parent_id
+	`
+
+	var parentID *int64
+	err = tx.QueryRow(query, id).Scan(&parentID)
+	if err != nil {
+		return err
+	}
+
+	err = deleteEmptyPlaceholders(tx, parentID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteEmptyPlaceholders removes the deleted ancestors, starting at
+// parentID, which have no replies left
+func deleteEmptyPlaceholders(tx *sql.Tx, parentID *int64) error {
+	query := `
+		DELETE FROM comments WHERE id=$1 AND deleted_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id=comments.id)
+		RETURNING parent_id
+	`
+
+	for parentID != nil {
+		var next *int64
+		err := tx.QueryRow(query, *parentID).Scan(&next)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		parentID = next
+	}
+
+	return nil
+}
+
+func (pr *commentRepo) Search(params *repo.SearchParams) (*repo.SearchCommentsResult, error) {
+	result := repo.SearchCommentsResult{
+		Comments: make([]*repo.CommentSearchResult, 0),
+	}
+
+	offset := (params.Page - 1) * params.Limit
+
+	query := `
+		SELECT
+			c.id,
+			c.user_id,
+			c.post_id,
+			c.parent_id,
+			c.description,
+			c.created_at,
+			c.updated_at,
+			u.first_name,
+			u.last_name,
+			u.email,
+			u.profile_image_url,
+			ts_rank(to_tsvector('simple', c.description), q) AS rank,
+			ts_headline('simple', c.description, q, ` + highlightOptions + ` || ', MaxWords=35, MinWords=15')
 		FROM comments c
 		INNER JOIN users u ON u.id=c.user_id
-		` + filter + `
-		ORDER BY c.created_at desc` + limit
+		INNER JOIN posts p ON p.id=c.post_id,
+		websearch_to_tsquery('simple', $1) q
+		WHERE to_tsvector('simple', c.description) @@ q AND c.deleted_at IS NULL
+			AND p.status='published'
+		ORDER BY rank desc, c.created_at desc
+		LIMIT $2 OFFSET $3
+	`
 
-	rows, err := pr.db.Query(query)
+	rows, err := pr.db.Query(query, params.Query, params.Limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -88,34 +373,67 @@ func (pr *commentRepo) GetAll(params *repo.GetAllCommentsParams) (*repo.GetAllCo
 	defer rows.Close()
 
 	for rows.Next() {
-		var c repo.Comment
+		var c repo.CommentSearchResult
 
 		err := rows.Scan(
-			&c.ID,
-			&c.UserID,
-			&c.PostID,
-			&c.Description,
-			&c.CreatedAt,
-			&c.UpdatedAt,
-			&c.User.FirstName,
-			&c.User.LastName,
-			&c.User.Email,
-			&c.User.ProfileImageUrl,
+			&c.Comment.ID,
+			&c.Comment.UserID,
+			&c.Comment.PostID,
+			&c.Comment.ParentID,
+			&c.Comment.Description,
+			&c.Comment.CreatedAt,
+			&c.Comment.UpdatedAt,
+			&c.Comment.User.FirstName,
+			&c.Comment.User.LastName,
+			&c.Comment.User.Email,
+			&c.Comment.User.ProfileImageUrl,
+			&c.Rank,
+			&c.Snippet,
 		)
 		if err != nil {
 			return nil, err
 		}
+		c.Snippet = highlight(c.Snippet)
 
 		result.Comments = append(result.Comments, &c)
 	}
 
 	queryCount := `
 		SELECT count(1) FROM comments c
-		INNER JOIN users u ON u.id=c.user_id ` + filter
-	err = pr.db.QueryRow(queryCount).Scan(&result.Count)
+		INNER JOIN users u ON u.id=c.user_id
+		INNER JOIN posts p ON p.id=c.post_id
+		WHERE to_tsvector('simple', c.description) @@ websearch_to_tsquery('simple', $1)
+			AND c.deleted_at IS NULL AND p.status='published'
+	`
+	err = pr.db.QueryRow(queryCount, params.Query).Scan(&result.Count)
 	if err != nil {
 		return nil, err
 	}
 
 	return &result, nil
 }
+
+func scanComment(rows *sql.Rows) (*repo.Comment, error) {
+	var c repo.Comment
+
+	err := rows.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Description,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.DeletedAt,
+		&c.RepliesCount,
+		&c.User.FirstName,
+		&c.User.LastName,
+		&c.User.Email,
+		&c.User.ProfileImageUrl,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,11 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/TemurMannonov/blog/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, strg)
+}
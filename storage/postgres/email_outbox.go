@@ -0,0 +1,252 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type emailOutboxRepo struct {
+	db *sqlx.DB
+}
+
+func NewEmailOutbox(db *sqlx.DB) repo.EmailOutboxStorageI {
+	return &emailOutboxRepo{
+		db: db,
+	}
+}
+
+const emailOutboxColumns = `
+	id,
+	recipients,
+	subject,
+	type,
+	body,
+	secrets,
+	status,
+	attempts,
+	last_error,
+	next_attempt_at,
+	created_at,
+	sent_at
+`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOutboxEmail(row scanner) (*repo.OutboxEmail, error) {
+	var (
+		e             repo.OutboxEmail
+		body, secrets []byte
+	)
+
+	err := row.Scan(
+		&e.ID,
+		pq.Array(&e.To),
+		&e.Subject,
+		&e.Type,
+		&body,
+		&secrets,
+		&e.Status,
+		&e.Attempts,
+		&e.LastError,
+		&e.NextAttemptAt,
+		&e.CreatedAt,
+		&e.SentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, &e.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(secrets, &e.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (er *emailOutboxRepo) Create(e *repo.OutboxEmail) (*repo.OutboxEmail, error) {
+	body, err := jsonStringMap(e.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := jsonStringMap(e.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO email_outbox(
+			recipients,
+			subject,
+			type,
+			body,
+			secrets
+		) VALUES($1, $2, $3, $4, $5)
+		RETURNING ` + emailOutboxColumns
+
+	return scanOutboxEmail(er.db.QueryRow(query, pq.Array(e.To), e.Subject, e.Type, body, secrets))
+}
+
+// jsonStringMap encodes m as a JSON object, nil as an empty one
+func jsonStringMap(m map[string]string) ([]byte, error) {
+	if m == nil {
+		m = map[string]string{}
+	}
+	return json.Marshal(m)
+}
+
+func (er *emailOutboxRepo) Get(id int64) (*repo.OutboxEmail, error) {
+	query := `SELECT ` + emailOutboxColumns + ` FROM email_outbox WHERE id=$1`
+
+	return scanOutboxEmail(er.db.QueryRow(query, id))
+}
+
+func (er *emailOutboxRepo) GetAll(params *repo.GetAllEmailsParams) (*repo.GetAllEmailsResult, error) {
+	result := repo.GetAllEmailsResult{
+		Emails: make([]*repo.OutboxEmail, 0),
+	}
+
+	qb := newQueryBuilder()
+	if params.Status != "" {
+		qb.Where("status=?", params.Status)
+	}
+
+	qb.OrderBy("created_at", "desc").
+		OrderBy("id", "desc").
+		Paginate(params.Page, params.Limit)
+
+	query, args := qb.Query(`SELECT ` + emailOutboxColumns + ` FROM email_outbox`)
+
+	rows, err := er.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Emails = append(result.Emails, e)
+	}
+
+	queryCount, args := qb.CountQuery(`SELECT count(1) FROM email_outbox`)
+	err = er.db.QueryRow(queryCount, args...).Scan(&result.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (er *emailOutboxRepo) ClaimDue(now time.Time, lease time.Duration, limit int32) ([]*repo.OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox SET next_attempt_at=$1
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status=$2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + emailOutboxColumns
+
+	rows, err := er.db.Query(query, now.Add(lease), repo.EmailStatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make([]*repo.OutboxEmail, 0)
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
+
+func (er *emailOutboxRepo) ClaimFailed(id int64, now time.Time, lease time.Duration) (*repo.OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox SET
+			status=$1,
+			next_attempt_at=$2
+		WHERE id=$3 AND status=$4
+		RETURNING ` + emailOutboxColumns
+
+	return scanOutboxEmail(er.db.QueryRow(query, repo.EmailStatusPending, now.Add(lease), id, repo.EmailStatusFailed))
+}
+
+func (er *emailOutboxRepo) MarkSent(id int64, sentAt time.Time) error {
+	query := `
+		UPDATE email_outbox SET
+			status=$1,
+			attempts=attempts+1,
+			sent_at=$2
+		WHERE id=$3
+	`
+
+	result, err := er.db.Exec(query, repo.EmailStatusSent, sentAt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (er *emailOutboxRepo) MarkFailed(id int64, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE email_outbox SET
+			status=CASE WHEN $1::timestamptz IS NULL THEN $2 ELSE $3 END,
+			attempts=attempts+1,
+			last_error=$4,
+			next_attempt_at=COALESCE($1, next_attempt_at)
+		WHERE id=$5
+	`
+
+	result, err := er.db.Exec(query, nextAttemptAt, repo.EmailStatusFailed, repo.EmailStatusPending, lastError, id)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package postgres
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type postRepo struct {
@@ -18,30 +21,57 @@ func NewPost(db *sqlx.DB) repo.PostStorageI {
 }
 
 func (pr *postRepo) Create(post *repo.Post) (*repo.Post, error) {
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	setPostStatusDefaults(post)
+
 	query := `
 		INSERT INTO posts(
 			title,
 			description,
 			image_url,
 			user_id,
-			category_id
-		) VALUES($1, $2, $3, $4, $5)
+			category_id,
+			status,
+			publish_at
+		) VALUES($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at
 	`
 
-	row := pr.db.QueryRow(
+	row := tx.QueryRow(
 		query,
 		post.Title,
 		post.Description,
 		post.ImageUrl,
 		post.UserID,
 		post.CategoryID,
+		post.Status,
+		post.PublishAt,
 	)
 
-	err := row.Scan(
+	err = row.Scan(
 		&post.ID,
 		&post.CreatedAt,
 	)
+	if err != nil {
+		return nil, postError(err)
+	}
+
+	err = setPostTags(tx, post.ID, post.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addPostRevision(tx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
@@ -52,11 +82,6 @@ func (pr *postRepo) Create(post *repo.Post) (*repo.Post, error) {
 func (pr *postRepo) Get(id int64) (*repo.Post, error) {
 	var result repo.Post
 
-	_, err := pr.db.Exec("UPDATE posts SET views_count=views_count+1 WHERE id=$1", id)
-	if err != nil {
-		return nil, err
-	}
-
 	query := `
 		SELECT
 			id,
@@ -67,13 +92,16 @@ func (pr *postRepo) Get(id int64) (*repo.Post, error) {
 			category_id,
 			created_at,
 			updated_at,
-			views_count
+			views_count,
+			status,
+			publish_at,
+			` + postTagsColumn + `
 		FROM posts
 		WHERE id=$1
 	`
 
 	row := pr.db.QueryRow(query, id)
-	err = row.Scan(
+	err := row.Scan(
 		&result.ID,
 		&result.Title,
 		&result.Description,
@@ -83,6 +111,9 @@ func (pr *postRepo) Get(id int64) (*repo.Post, error) {
 		&result.CreatedAt,
 		&result.UpdatedAt,
 		&result.ViewsCount,
+		&result.Status,
+		&result.PublishAt,
+		pq.Array(&result.Tags),
 	)
 	if err != nil {
 		return nil, err
@@ -91,31 +122,62 @@ func (pr *postRepo) Get(id int64) (*repo.Post, error) {
 	return &result, nil
 }
 
+func (pr *postRepo) IncrementViews(id int64) error {
+	result, err := pr.db.Exec("UPDATE posts SET views_count=views_count+1 WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (pr *postRepo) GetAll(params *repo.GetAllPostsParams) (*repo.GetAllPostsResult, error) {
 	result := repo.GetAllPostsResult{
 		Posts: make([]*repo.Post, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
-
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
-	filter := "WHERE true"
+	qb := newQueryBuilder()
 	if params.Search != "" {
-		filter += " AND title ilike '%" + params.Search + "%' "
+		qb.Where("search_vector @@ websearch_to_tsquery('simple', ?)", params.Search)
 	}
 
-	if params.UserID != 0 {
-		filter += fmt.Sprintf(" AND user_id=%d ", params.UserID)
+	qb.Equal("user_id", params.UserID).
+		Equal("category_id", params.CategoryID).
+		Where("(status=? OR user_id=?)", repo.PostStatusPublished, params.ViewerID)
+
+	if params.Status != "" {
+		qb.Where("status=?", params.Status)
 	}
 
-	if params.CategoryID != 0 {
-		filter += fmt.Sprintf(" AND category_id=%d ", params.CategoryID)
+	if len(params.Tags) > 0 {
+		tags := qb.Arg(pq.Array(params.Tags)) + "::varchar[]"
+
+		matches := `
+			(SELECT count(1) FROM post_tags pt
+			INNER JOIN tags t ON t.id=pt.tag_id
+			WHERE pt.post_id=posts.id AND t.name = ANY(` + tags + `))`
+		if params.TagsMatchAll {
+			qb.Where(matches + " = cardinality(" + tags + ")")
+		} else {
+			qb.Where(matches + " > 0")
+		}
 	}
 
-	orderBy := " ORDER BY created_at desc "
-	if params.SortByData != "" {
-		orderBy = fmt.Sprintf(" ORDER BY created_at %s ", params.SortByData)
+	if params.Cursor != nil {
+		qb.Keyset("created_at", "id", params.Cursor, params.SortByData, params.Limit)
+	} else {
+		qb.OrderBy("created_at", params.SortByData).
+			OrderBy("id", params.SortByData).
+			Paginate(params.Page, params.Limit)
 	}
 
 	query := `
@@ -128,11 +190,14 @@ func (pr *postRepo) GetAll(params *repo.GetAllPostsParams) (*repo.GetAllPostsRes
 			category_id,
 			created_at,
 			updated_at,
-			views_count
-		FROM posts
-		` + filter + orderBy + limit
+			views_count,
+			status,
+			publish_at,
+			` + postTagsColumn + `
+		FROM posts`
+	query, args := qb.Query(query)
 
-	rows, err := pr.db.Query(query)
+	rows, err := pr.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -152,6 +217,9 @@ func (pr *postRepo) GetAll(params *repo.GetAllPostsParams) (*repo.GetAllPostsRes
 			&p.CreatedAt,
 			&p.UpdatedAt,
 			&p.ViewsCount,
+			&p.Status,
+			&p.PublishAt,
+			pq.Array(&p.Tags),
 		)
 		if err != nil {
 			return nil, err
@@ -160,11 +228,302 @@ func (pr *postRepo) GetAll(params *repo.GetAllPostsParams) (*repo.GetAllPostsRes
 		result.Posts = append(result.Posts, &p)
 	}
 
-	queryCount := `SELECT count(1) FROM posts ` + filter
-	err = pr.db.QueryRow(queryCount).Scan(&result.Count)
+	if params.Cursor != nil {
+		result.Posts, result.HasMore = keysetPage(result.Posts, params.Cursor, params.Limit)
+		return &result, nil
+	}
+
+	queryCount, args := qb.CountQuery(`SELECT count(1) FROM posts`)
+	err = pr.db.QueryRow(queryCount, args...).Scan(&result.Count)
 	if err != nil {
 		return nil, err
 	}
+	result.HasMore = qb.hasMorePages(len(result.Posts), result.Count)
 
 	return &result, nil
 }
+
+func (pr *postRepo) Update(post *repo.Post) (*repo.Post, error) {
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE posts SET
+			title=$1,
+			description=$2,
+			image_url=$3,
+			category_id=$4,
+			status=COALESCE(NULLIF($5, ''), status),
+			publish_at=CASE WHEN $5='' THEN publish_at ELSE $6 END,
+			updated_at=CURRENT_TIMESTAMP
+		WHERE id=$7
+		RETURNING user_id, created_at, updated_at, views_count, status, publish_at
+	`
+
+	row := tx.QueryRow(
+		query,
+		post.Title,
+		post.Description,
+		post.ImageUrl,
+		post.CategoryID,
+		post.Status,
+		post.PublishAt,
+		post.ID,
+	)
+
+	err = row.Scan(
+		&post.UserID,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.ViewsCount,
+		&post.Status,
+		&post.PublishAt,
+	)
+	if err != nil {
+		return nil, postError(err)
+	}
+
+	err = setPostTags(tx, post.ID, post.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addPostRevision(tx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (pr *postRepo) Delete(id int64) error {
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM likes WHERE post_id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM comments WHERE post_id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM post_tags WHERE post_id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM post_revisions WHERE post_id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM posts WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (pr *postRepo) Search(params *repo.SearchParams) (*repo.SearchPostsResult, error) {
+	result := repo.SearchPostsResult{
+		Posts: make([]*repo.PostSearchResult, 0),
+	}
+
+	offset := (params.Page - 1) * params.Limit
+
+	query := `
+		SELECT
+			id,
+			title,
+			description,
+			image_url,
+			user_id,
+			category_id,
+			created_at,
+			updated_at,
+			views_count,
+			status,
+			publish_at,
+			` + postTagsColumn + `,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('simple', title, q, ` + highlightOptions + ` || ', HighlightAll=true'),
+			ts_headline('simple', description, q, ` + highlightOptions + ` || ', MaxWords=35, MinWords=15')
+		FROM posts, websearch_to_tsquery('simple', $1) q
+		WHERE search_vector @@ q AND status='published'
+		ORDER BY rank desc, created_at desc
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := pr.db.Query(query, params.Query, params.Limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p repo.PostSearchResult
+
+		err := rows.Scan(
+			&p.Post.ID,
+			&p.Post.Title,
+			&p.Post.Description,
+			&p.Post.ImageUrl,
+			&p.Post.UserID,
+			&p.Post.CategoryID,
+			&p.Post.CreatedAt,
+			&p.Post.UpdatedAt,
+			&p.Post.ViewsCount,
+			&p.Post.Status,
+			&p.Post.PublishAt,
+			pq.Array(&p.Post.Tags),
+			&p.Rank,
+			&p.Headline,
+			&p.Snippet,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.Headline = highlight(p.Headline)
+		p.Snippet = highlight(p.Snippet)
+
+		result.Posts = append(result.Posts, &p)
+	}
+
+	queryCount := `
+		SELECT count(1) FROM posts
+		WHERE search_vector @@ websearch_to_tsquery('simple', $1) AND status='published'
+	`
+	err = pr.db.QueryRow(queryCount, params.Query).Scan(&result.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// postTagsColumn selects the tag names of the post as an array
+const postTagsColumn = `
+	ARRAY(
+		SELECT t.name FROM post_tags pt
+		INNER JOIN tags t ON t.id=pt.tag_id
+		WHERE pt.post_id=posts.id
+		ORDER BY t.name
+	) AS tags`
+
+// setPostTags replaces the tags of a post, creating the missing ones
+func setPostTags(tx *sql.Tx, postID int64, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM post_tags WHERE post_id=$1`, postID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO tags(name) SELECT unnest($1::varchar[])
+		ON CONFLICT (name) DO NOTHING
+	`, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO post_tags(post_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY($2::varchar[])
+	`, postID, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addPostRevision snapshots the post as its next revision unless its
+// content equals the latest revision
+func addPostRevision(tx *sql.Tx, postID int64) error {
+	// lock the post, so concurrent edits number their revisions one after another
+	_, err := tx.Exec(`SELECT 1 FROM posts WHERE id=$1 FOR UPDATE`, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO post_revisions(post_id, revision, title, description, image_url, category_id)
+		SELECT p.id, COALESCE(r.revision, 0)+1, p.title, p.description, p.image_url, p.category_id
+		FROM posts p
+		LEFT JOIN LATERAL (
+			SELECT * FROM post_revisions WHERE post_id=p.id
+			ORDER BY revision desc LIMIT 1
+		) r ON true
+		WHERE p.id=$1 AND (
+			r.id IS NULL OR
+			r.title <> p.title OR
+			r.description <> p.description OR
+			r.image_url IS DISTINCT FROM p.image_url OR
+			r.category_id <> p.category_id
+		)
+	`, postID)
+	return err
+}
+
+// postError maps the foreign key violation of an unknown category
+func postError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation && pqErr.Constraint == "posts_category_id_fkey" {
+		return repo.ErrCategoryNotFound
+	}
+	return err
+}
+
+// setPostStatusDefaults publishes posts created without a status right away
+func setPostStatusDefaults(post *repo.Post) {
+	if post.Status == "" {
+		post.Status = repo.PostStatusPublished
+	}
+
+	if post.Status == repo.PostStatusPublished && post.PublishAt == nil {
+		publishAt := time.Now()
+		post.PublishAt = &publishAt
+	}
+}
+
+func (pr *postRepo) PublishScheduled(now time.Time) (int64, error) {
+	query := `
+		UPDATE posts SET status=$1
+		WHERE status=$2 AND publish_at <= $3
+	`
+
+	result, err := pr.db.Exec(query, repo.PostStatusPublished, repo.PostStatusScheduled, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+)
+
+// queryBuilder collects the filters, sorting and pagination of a GetAll query.
+// Column names and SQL fragments come from the code, every value is bound
+// as a placeholder argument so user input never becomes part of the SQL.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+	groupBy    string
+	orderBy    []string
+	limit      int32
+	offset     int32
+	paginate   bool
+}
+
+func newQueryBuilder() *queryBuilder {
+	return &queryBuilder{}
+}
+
+// Arg binds a value and returns its placeholder
+func (qb *queryBuilder) Arg(value interface{}) string {
+	qb.args = append(qb.args, value)
+	return fmt.Sprintf("$%d", len(qb.args))
+}
+
+// Where adds a condition. Every "?" in it is replaced with a placeholder
+// of the next argument
+func (qb *queryBuilder) Where(condition string, args ...interface{}) *queryBuilder {
+	for _, arg := range args {
+		condition = strings.Replace(condition, "?", qb.Arg(arg), 1)
+	}
+
+	qb.conditions = append(qb.conditions, condition)
+	return qb
+}
+
+// Equal adds column=value unless value is the zero value
+func (qb *queryBuilder) Equal(column string, value int64) *queryBuilder {
+	if value == 0 {
+		return qb
+	}
+	return qb.Where(column+"=?", value)
+}
+
+// Search matches search as a literal substring of any of the columns
+func (qb *queryBuilder) Search(search string, columns ...string) *queryBuilder {
+	if search == "" || len(columns) == 0 {
+		return qb
+	}
+
+	placeholder := qb.Arg("%" + escapeLike(search) + "%")
+
+	matches := make([]string, 0, len(columns))
+	for _, column := range columns {
+		matches = append(matches, column+" ILIKE "+placeholder)
+	}
+
+	qb.conditions = append(qb.conditions, "("+strings.Join(matches, " OR ")+")")
+	return qb
+}
+
+// GroupBy groups the rows by the columns
+func (qb *queryBuilder) GroupBy(columns ...string) *queryBuilder {
+	qb.groupBy = " GROUP BY " + strings.Join(columns, ", ") + " "
+	return qb
+}
+
+// OrderBy adds a sort key. Anything but "asc" sorts descending
+func (qb *queryBuilder) OrderBy(column, direction string) *queryBuilder {
+	if strings.ToLower(direction) == "asc" {
+		direction = "ASC"
+	} else {
+		direction = "DESC"
+	}
+
+	qb.orderBy = append(qb.orderBy, column+" "+direction)
+	return qb
+}
+
+// Paginate limits the query to the given page
+func (qb *queryBuilder) Paginate(page, limit int32) *queryBuilder {
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	qb.paginate = true
+	qb.limit = limit
+	qb.offset = (page - 1) * limit
+	return qb
+}
+
+// Keyset sorts by (createdAt, id) and limits the query to the limit+1 rows
+// following the cursor, the extra row tells whether more rows remain.
+// Backward cursors flip the sorting, so their rows come out reversed
+func (qb *queryBuilder) Keyset(createdAt, id string, cursor *repo.Cursor, direction string, limit int32) *queryBuilder {
+	desc := strings.ToLower(direction) != "asc"
+	if cursor.Backward {
+		desc = !desc
+	}
+
+	operator, direction := ">", "asc"
+	if desc {
+		operator, direction = "<", "desc"
+	}
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	qb.Where("("+createdAt+", "+id+") "+operator+" (?, ?)", cursor.CreatedAt, cursor.ID).
+		OrderBy(createdAt, direction).
+		OrderBy(id, direction)
+
+	qb.paginate = true
+	qb.limit = limit + 1
+	qb.offset = 0
+	return qb
+}
+
+// keysetPage cuts the extra row fetched by Keyset off rows and restores
+// the listing order of backward pages. It reports whether more rows remain
+func keysetPage[T any](rows []T, cursor *repo.Cursor, limit int32) ([]T, bool) {
+	hasMore := len(rows) > int(limit)
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	if cursor.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	return rows, hasMore
+}
+
+// hasMorePages reports whether rows remain after the current page
+func (qb *queryBuilder) hasMorePages(rows int, count int32) bool {
+	return qb.offset+int32(rows) < count
+}
+
+// Filter returns the WHERE clause of the conditions
+func (qb *queryBuilder) Filter() string {
+	if len(qb.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(qb.conditions, " AND ") + " "
+}
+
+// Query appends the filter, sorting and pagination to query
+func (qb *queryBuilder) Query(query string) (string, []interface{}) {
+	args := make([]interface{}, len(qb.args), len(qb.args)+2)
+	copy(args, qb.args)
+
+	query += qb.Filter() + qb.groupBy
+	if len(qb.orderBy) > 0 {
+		query += " ORDER BY " + strings.Join(qb.orderBy, ", ") + " "
+	}
+
+	if qb.paginate {
+		args = append(args, qb.limit, qb.offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d ", len(args)-1, len(args))
+	}
+
+	return query, args
+}
+
+// CountQuery appends only the filter to query
+func (qb *queryBuilder) CountQuery(query string) (string, []interface{}) {
+	return query + qb.Filter(), qb.args
+}
+
+// Markers ts_headline puts around the matches, see highlightOptions
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// highlightOptions are the ts_headline options marking the matches with
+// highlightStart and highlightStop
+const highlightOptions = `'StartSel=' || chr(2) || ', StopSel=' || chr(3)`
+
+// highlight escapes the HTML of a ts_headline result, then wraps its
+// marked matches in <b></b>
+func highlight(headline string) string {
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(html.EscapeString(headline))
+}
+
+// escapeLike escapes the LIKE wildcards so they match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	qb := newQueryBuilder().
+		Equal("user_id", 5).
+		Equal("category_id", 0).
+		Search("john", "first_name", "last_name").
+		OrderBy("created_at", "asc").
+		Paginate(3, 10)
+
+	query, args := qb.Query("SELECT id FROM users")
+	require.Equal(t,
+		"SELECT id FROM users WHERE user_id=$1 AND (first_name ILIKE $2 OR last_name ILIKE $2)  ORDER BY created_at ASC  LIMIT $3 OFFSET $4 ",
+		query,
+	)
+	require.Equal(t, []interface{}{int64(5), "%john%", int32(10), int32(20)}, args)
+
+	count, args := qb.CountQuery("SELECT count(1) FROM users")
+	require.Equal(t, "SELECT count(1) FROM users WHERE user_id=$1 AND (first_name ILIKE $2 OR last_name ILIKE $2) ", count)
+	require.Equal(t, []interface{}{int64(5), "%john%"}, args)
+}
+
+func TestQueryBuilderEmpty(t *testing.T) {
+	query, args := newQueryBuilder().Query("SELECT id FROM tags")
+	require.Equal(t, "SELECT id FROM tags", query)
+	require.Empty(t, args)
+}
+
+func TestQueryBuilderInjection(t *testing.T) {
+	payloads := []string{
+		"' OR '1'='1",
+		"%'; DROP TABLE users; --",
+		"$1",
+		"?",
+	}
+
+	for _, payload := range payloads {
+		qb := newQueryBuilder().
+			Where("search_vector @@ websearch_to_tsquery('simple', ?)", payload).
+			Search(payload, "title").
+			OrderBy("created_at", payload).
+			Paginate(1, 10)
+
+		query, args := qb.Query("SELECT id FROM posts")
+		require.Equal(t,
+			"SELECT id FROM posts WHERE search_vector @@ websearch_to_tsquery('simple', $1) AND (title ILIKE $2)  ORDER BY created_at DESC  LIMIT $3 OFFSET $4 ",
+			query,
+		)
+		require.Equal(t, payload, args[0])
+		require.Equal(t, "%"+escapeLike(payload)+"%", args[1])
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	require.Equal(t, `100\%`, escapeLike("100%"))
+	require.Equal(t, `a\_b`, escapeLike("a_b"))
+	require.Equal(t, `c:\\dir`, escapeLike(`c:\dir`))
+	require.Equal(t, "plain", escapeLike("plain"))
+}
+
+func TestHighlight(t *testing.T) {
+	require.Equal(t, "a <b>match</b>", highlight("a "+highlightStart+"match"+highlightStop))
+	require.Equal(t,
+		"&lt;img src=x onerror=alert(1)&gt; <b>&lt;script&gt;</b>",
+		highlight("<img src=x onerror=alert(1)> "+highlightStart+"<script>"+highlightStop),
+	)
+}
+
+func TestQueryBuilderKeyset(t *testing.T) {
+	createdAt := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	query, args := newQueryBuilder().
+		Equal("user_id", 5).
+		Keyset("created_at", "id", &repo.Cursor{CreatedAt: createdAt, ID: 7}, "desc", 10).
+		Query("SELECT id FROM posts")
+	require.Equal(t,
+		"SELECT id FROM posts WHERE user_id=$1 AND (created_at, id) < ($2, $3)  ORDER BY created_at DESC, id DESC  LIMIT $4 OFFSET $5 ",
+		query,
+	)
+	require.Equal(t, []interface{}{int64(5), createdAt, int64(7), int32(11), int32(0)}, args)
+
+	query, _ = newQueryBuilder().
+		Keyset("created_at", "id", &repo.Cursor{CreatedAt: createdAt, ID: 7, Backward: true}, "desc", 10).
+		Query("SELECT id FROM posts")
+	require.Equal(t,
+		"SELECT id FROM posts WHERE (created_at, id) > ($1, $2)  ORDER BY created_at ASC, id ASC  LIMIT $3 OFFSET $4 ",
+		query,
+	)
+}
+
+func TestKeysetPage(t *testing.T) {
+	rows, hasMore := keysetPage([]int{1, 2, 3}, &repo.Cursor{}, 2)
+	require.True(t, hasMore)
+	require.Equal(t, []int{1, 2}, rows)
+
+	rows, hasMore = keysetPage([]int{3, 2}, &repo.Cursor{Backward: true}, 2)
+	require.False(t, hasMore)
+	require.Equal(t, []int{2, 3}, rows)
+}
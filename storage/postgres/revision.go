@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type revisionRepo struct {
+	db *sqlx.DB
+}
+
+func NewRevision(db *sqlx.DB) repo.RevisionStorageI {
+	return &revisionRepo{
+		db: db,
+	}
+}
+
+func (rr *revisionRepo) Get(postID int64, revision int32) (*repo.PostRevision, error) {
+	var result repo.PostRevision
+
+	query := `
+		SELECT
+			id,
+			post_id,
+			revision,
+			title,
+			description,
+			image_url,
+			category_id,
+			created_at
+		FROM post_revisions
+		WHERE post_id=$1 AND revision=$2
+	`
+
+	err := rr.db.QueryRow(query, postID, revision).Scan(
+		&result.ID,
+		&result.PostID,
+		&result.Revision,
+		&result.Title,
+		&result.Description,
+		&result.ImageUrl,
+		&result.CategoryID,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (rr *revisionRepo) GetAll(params *repo.GetAllRevisionsParams) (*repo.GetAllRevisionsResult, error) {
+	result := repo.GetAllRevisionsResult{
+		Revisions: make([]*repo.PostRevision, 0),
+	}
+
+	qb := newQueryBuilder().
+		Equal("post_id", params.PostID).
+		OrderBy("revision", "desc").
+		Paginate(params.Page, params.Limit)
+
+	query, args := qb.Query(`
+		SELECT
+			id,
+			post_id,
+			revision,
+			title,
+			description,
+			image_url,
+			category_id,
+			created_at
+		FROM post_revisions
+	`)
+
+	rows, err := rr.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r repo.PostRevision
+
+		err := rows.Scan(
+			&r.ID,
+			&r.PostID,
+			&r.Revision,
+			&r.Title,
+			&r.Description,
+			&r.ImageUrl,
+			&r.CategoryID,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Revisions = append(result.Revisions, &r)
+	}
+
+	queryCount, args := qb.CountQuery(`SELECT count(1) FROM post_revisions`)
+	err = rr.db.QueryRow(queryCount, args...).Scan(&result.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
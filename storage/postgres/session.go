@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type sessionRepo struct {
+	db *sqlx.DB
+}
+
+func NewSession(db *sqlx.DB) repo.SessionStorageI {
+	return &sessionRepo{
+		db: db,
+	}
+}
+
+const sessionColumns = `
+	id,
+	user_id,
+	ip,
+	user_agent,
+	created_at,
+	last_seen_at,
+	expires_at
+`
+
+func scanSession(row scanner) (*repo.Session, error) {
+	var s repo.Session
+
+	err := row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.IP,
+		&s.UserAgent,
+		&s.CreatedAt,
+		&s.LastSeenAt,
+		&s.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (sr *sessionRepo) Create(s *repo.Session) (*repo.Session, error) {
+	query := `
+		INSERT INTO sessions(
+			id,
+			user_id,
+			ip,
+			user_agent,
+			expires_at
+		) VALUES($1, $2, $3, $4, $5)
+		RETURNING ` + sessionColumns
+
+	return scanSession(sr.db.QueryRow(query, s.ID, s.UserID, s.IP, s.UserAgent, s.ExpiresAt))
+}
+
+func (sr *sessionRepo) Get(id uuid.UUID) (*repo.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id=$1`
+
+	return scanSession(sr.db.QueryRow(query, id))
+}
+
+func (sr *sessionRepo) GetAll(userID int64) ([]*repo.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id=$1 AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC, created_at DESC`
+
+	rows, err := sr.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Session, 0)
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, s)
+	}
+
+	return result, rows.Err()
+}
+
+func (sr *sessionRepo) UpdateLastSeen(id uuid.UUID, ip string, seenAt time.Time) error {
+	return sr.update(`UPDATE sessions SET ip=$2, last_seen_at=$3 WHERE id=$1`, id, ip, seenAt)
+}
+
+func (sr *sessionRepo) Extend(id uuid.UUID, expiresAt time.Time) error {
+	return sr.update(`UPDATE sessions SET expires_at=$2 WHERE id=$1`, id, expiresAt)
+}
+
+func (sr *sessionRepo) Delete(id uuid.UUID) error {
+	return sr.update(`DELETE FROM sessions WHERE id=$1`, id)
+}
+
+// update runs a statement on a session, sql.ErrNoRows is returned if there is none
+func (sr *sessionRepo) update(query string, args ...interface{}) error {
+	result, err := sr.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (sr *sessionRepo) DeleteAll(userID int64) (int64, error) {
+	result, err := sr.db.Exec(`DELETE FROM sessions WHERE user_id=$1`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
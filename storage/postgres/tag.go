@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type tagRepo struct {
+	db *sqlx.DB
+}
+
+func NewTag(db *sqlx.DB) repo.TagStorageI {
+	return &tagRepo{
+		db: db,
+	}
+}
+
+func (tr *tagRepo) GetAll(params *repo.GetAllTagsParams) (*repo.GetAllTagsResult, error) {
+	result := repo.GetAllTagsResult{
+		Tags: make([]*repo.Tag, 0),
+	}
+
+	qb := newQueryBuilder().
+		Search(params.Search, "t.name").
+		GroupBy("t.id").
+		OrderBy("posts_count", "desc").
+		OrderBy("t.name", "asc").
+		Paginate(params.Page, params.Limit)
+
+	query, args := qb.Query(`
+		SELECT
+			t.id,
+			t.name,
+			t.created_at,
+			count(p.id) AS posts_count
+		FROM tags t
+		LEFT JOIN post_tags pt ON pt.tag_id=t.id
+		LEFT JOIN posts p ON p.id=pt.post_id AND p.status='` + repo.PostStatusPublished + `'
+	`)
+
+	rows, err := tr.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var t repo.Tag
+
+		err := rows.Scan(
+			&t.ID,
+			&t.Name,
+			&t.CreatedAt,
+			&t.PostsCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Tags = append(result.Tags, &t)
+	}
+
+	queryCount, args := qb.CountQuery(`SELECT count(1) FROM tags t`)
+	err = tr.db.QueryRow(queryCount, args...).Scan(&result.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
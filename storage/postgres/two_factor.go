@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type twoFactorRepo struct {
+	db *sqlx.DB
+}
+
+func NewTwoFactor(db *sqlx.DB) repo.TwoFactorStorageI {
+	return &twoFactorRepo{
+		db: db,
+	}
+}
+
+func (tr *twoFactorRepo) Enable(userID int64, secret string, recoveryCodeHashes []string) (*repo.TwoFactor, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = disableTwoFactor(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := repo.TwoFactor{
+		UserID:            userID,
+		Secret:            secret,
+		RecoveryCodesLeft: int32(len(recoveryCodeHashes)),
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO user_two_factor(user_id, secret) VALUES($1, $2)
+		RETURNING enabled_at
+	`, userID, secret).Scan(&result.EnabledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec(`INSERT INTO user_recovery_codes(user_id, code_hash) VALUES($1, $2)`, userID, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (tr *twoFactorRepo) Get(userID int64) (*repo.TwoFactor, error) {
+	var result repo.TwoFactor
+
+	query := `
+		SELECT
+			tf.user_id,
+			tf.secret,
+			(SELECT count(1) FROM user_recovery_codes rc
+			WHERE rc.user_id=tf.user_id AND rc.used_at IS NULL),
+			tf.enabled_at
+		FROM user_two_factor tf
+		WHERE tf.user_id=$1
+	`
+
+	err := tr.db.QueryRow(query, userID).Scan(
+		&result.UserID,
+		&result.Secret,
+		&result.RecoveryCodesLeft,
+		&result.EnabledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (tr *twoFactorRepo) Disable(userID int64) error {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM user_two_factor WHERE user_id=$1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id=$1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (tr *twoFactorRepo) UseRecoveryCode(userID int64, codeHash string) error {
+	query := `
+		UPDATE user_recovery_codes SET used_at=CURRENT_TIMESTAMP
+		WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+	`
+
+	result, err := tr.db.Exec(query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// disableTwoFactor removes the secret and the recovery codes of the user
+func disableTwoFactor(tx *sql.Tx, userID int64) error {
+	for _, query := range []string{
+		`DELETE FROM user_recovery_codes WHERE user_id=$1`,
+		`DELETE FROM user_two_factor WHERE user_id=$1`,
+	} {
+		_, err := tx.Exec(query, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,20 @@
 package postgres
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
 
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// uniqueViolation is the Postgres error code of unique constraint violations
+const uniqueViolation = "23505"
+
+// foreignKeyViolation is the Postgres error code of foreign key violations
+const foreignKeyViolation = "23503"
+
 type userRepo struct {
 	db *sqlx.DB
 }
@@ -18,6 +26,20 @@ func NewUser(db *sqlx.DB) repo.UserStorageI {
 }
 
 func (ur *userRepo) Create(user *repo.User) (*repo.User, error) {
+	err := insertUser(ur.db, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// rowQuerier runs queries on the database or in a transaction
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func insertUser(q rowQuerier, user *repo.User) error {
 	query := `
 		INSERT INTO users(
 			first_name,
@@ -33,7 +55,7 @@ func (ur *userRepo) Create(user *repo.User) (*repo.User, error) {
 		RETURNING id, created_at
 	`
 
-	row := ur.db.QueryRow(
+	row := q.QueryRow(
 		query,
 		user.FirstName,
 		user.LastName,
@@ -46,15 +68,10 @@ func (ur *userRepo) Create(user *repo.User) (*repo.User, error) {
 		user.Type,
 	)
 
-	err := row.Scan(
+	return row.Scan(
 		&user.ID,
 		&user.CreatedAt,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	return user, nil
 }
 
 func (ur *userRepo) Get(id int64) (*repo.User, error) {
@@ -74,7 +91,7 @@ func (ur *userRepo) Get(id int64) (*repo.User, error) {
 			type,
 			created_at
 		FROM users
-		WHERE id=$1
+		WHERE id=$1 AND deleted_at IS NULL
 	`
 
 	row := ur.db.QueryRow(query, id)
@@ -103,21 +120,18 @@ func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersRes
 		Users: make([]*repo.User, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
-
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
-	filter := ""
-	if params.Search != "" {
-		str := "%" + params.Search + "%"
-		filter += fmt.Sprintf(`
-			WHERE first_name ILIKE '%s' OR last_name ILIKE '%s' OR email ILIKE '%s' 
-				OR username ILIKE '%s' OR phone_number ILIKE '%s'`,
-			str, str, str, str, str,
-		)
+	columns := []string{"first_name", "last_name", "username"}
+	if params.SearchContacts {
+		columns = append(columns, "email", "phone_number")
 	}
 
-	query := `
+	qb := newQueryBuilder().
+		Where("deleted_at IS NULL").
+		Search(params.Search, columns...).
+		OrderBy("created_at", "desc").
+		Paginate(params.Page, params.Limit)
+
+	query, args := qb.Query(`
 		SELECT
 			id,
 			first_name,
@@ -131,11 +145,9 @@ func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersRes
 			type,
 			created_at
 		FROM users
-		` + filter + `
-		ORDER BY created_at desc
-		` + limit
+	`)
 
-	rows, err := ur.db.Query(query)
+	rows, err := ur.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -165,8 +177,8 @@ func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersRes
 		result.Users = append(result.Users, &u)
 	}
 
-	queryCount := `SELECT count(1) FROM users ` + filter
-	err = ur.db.QueryRow(queryCount).Scan(&result.Count)
+	queryCount, args := qb.CountQuery(`SELECT count(1) FROM users`)
+	err = ur.db.QueryRow(queryCount, args...).Scan(&result.Count)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +203,7 @@ func (ur *userRepo) GetByEmail(email string) (*repo.User, error) {
 			type,
 			created_at
 		FROM users
-		WHERE email=$1
+		WHERE email=$1 AND deleted_at IS NULL
 	`
 
 	row := ur.db.QueryRow(query, email)
@@ -225,3 +237,223 @@ func (ur *userRepo) UpdatePassword(req *repo.UpdatePassword) error {
 
 	return nil
 }
+
+func (ur *userRepo) UpdateType(userID int64, userType string) error {
+	result, err := ur.db.Exec(`UPDATE users SET type=$1 WHERE id=$2 AND deleted_at IS NULL`, userType, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (ur *userRepo) Update(user *repo.User) (*repo.User, error) {
+	query := `
+		UPDATE users SET
+			first_name=$1,
+			last_name=$2,
+			phone_number=$3,
+			gender=$4,
+			username=$5,
+			profile_image_url=$6
+		WHERE id=$7 AND deleted_at IS NULL
+		RETURNING email, password, type, created_at
+	`
+
+	row := ur.db.QueryRow(
+		query,
+		user.FirstName,
+		user.LastName,
+		user.PhoneNumber,
+		user.Gender,
+		user.Username,
+		user.ProfileImageUrl,
+		user.ID,
+	)
+
+	err := row.Scan(
+		&user.Email,
+		&user.Password,
+		&user.Type,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			switch pqErr.Constraint {
+			case "users_username_key":
+				return nil, repo.ErrUsernameTaken
+			case "users_phone_number_key":
+				return nil, repo.ErrPhoneNumberTaken
+			}
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (ur *userRepo) UpdateEmail(userID int64, email string) error {
+	result, err := ur.db.Exec(`UPDATE users SET email=$1 WHERE id=$2 AND deleted_at IS NULL`, email, userID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return repo.ErrEmailTaken
+		}
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (ur *userRepo) Delete(id int64, policy string) error {
+	tx, err := ur.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if policy == repo.UserDeletePolicyRemove {
+		err = removeUserContent(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = disableTwoFactor(tx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM api_tokens WHERE user_id=$1`,
+		`DELETE FROM user_identities WHERE user_id=$1`,
+		`DELETE FROM sessions WHERE user_id=$1`,
+	} {
+		_, err = tx.Exec(query, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE users SET
+			first_name=$1,
+			last_name=$2,
+			phone_number=NULL,
+			email='deleted_' || id || '@deleted.invalid',
+			gender=NULL,
+			password='',
+			username=NULL,
+			profile_image_url=NULL,
+			deleted_at=CURRENT_TIMESTAMP
+		WHERE id=$3 AND deleted_at IS NULL
+	`
+
+	result, err := tx.Exec(query, repo.DeletedUserFirstName, repo.DeletedUserLastName, id)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// removeUserContent removes the posts, comments and likes of the user.
+// Comments replied to by others are kept as deleted comments
+func removeUserContent(tx *sql.Tx, userID int64) error {
+	posts := `SELECT id FROM posts WHERE user_id=$1`
+
+	for _, query := range []string{
+		`DELETE FROM likes WHERE user_id=$1 OR post_id IN (` + posts + `)`,
+		`DELETE FROM comments WHERE post_id IN (` + posts + `)`,
+		`DELETE FROM post_tags WHERE post_id IN (` + posts + `)`,
+		`DELETE FROM post_revisions WHERE post_id IN (` + posts + `)`,
+		`DELETE FROM posts WHERE user_id=$1`,
+		`UPDATE comments SET description='', deleted_at=CURRENT_TIMESTAMP
+		WHERE user_id=$1 AND deleted_at IS NULL`,
+	} {
+		_, err := tx.Exec(query, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// removing a reply can turn its parent into a leaf
+	parents := make([]*int64, 0)
+	for {
+		removed, err := deleteUserLeafComments(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if len(removed) == 0 {
+			break
+		}
+
+		parents = append(parents, removed...)
+	}
+
+	// the placeholders of others only replied to by the user are empty now
+	for _, parentID := range parents {
+		err := deleteEmptyPlaceholders(tx, parentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteUserLeafComments removes the comments of the user without replies
+// and returns their parents
+func deleteUserLeafComments(tx *sql.Tx, userID int64) ([]*int64, error) {
+	rows, err := tx.Query(`
+		DELETE FROM comments c WHERE c.user_id=$1
+		AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id=c.id)
+		RETURNING c.parent_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make([]*int64, 0)
+	for rows.Next() {
+		var parentID *int64
+		err := rows.Scan(&parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		parents = append(parents, parentID)
+	}
+
+	return parents, rows.Err()
+}
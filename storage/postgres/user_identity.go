@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type userIdentityRepo struct {
+	db *sqlx.DB
+}
+
+func NewUserIdentity(db *sqlx.DB) repo.UserIdentityStorageI {
+	return &userIdentityRepo{
+		db: db,
+	}
+}
+
+const userIdentityColumns = `
+	id,
+	user_id,
+	provider,
+	subject,
+	email,
+	created_at
+`
+
+func scanUserIdentity(row scanner) (*repo.UserIdentity, error) {
+	var i repo.UserIdentity
+
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (ir *userIdentityRepo) Create(i *repo.UserIdentity) (*repo.UserIdentity, error) {
+	return insertUserIdentity(ir.db, i)
+}
+
+func (ir *userIdentityRepo) CreateUser(user *repo.User, i *repo.UserIdentity) (*repo.User, error) {
+	tx, err := ir.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = insertUser(tx, user)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "users_email_key" {
+			return nil, repo.ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	identity := *i
+	identity.UserID = user.ID
+	_, err = insertUserIdentity(tx, &identity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func insertUserIdentity(q rowQuerier, i *repo.UserIdentity) (*repo.UserIdentity, error) {
+	query := `
+		INSERT INTO user_identities(
+			user_id,
+			provider,
+			subject,
+			email
+		) VALUES($1, $2, $3, $4)
+		RETURNING ` + userIdentityColumns
+
+	result, err := scanUserIdentity(q.QueryRow(query, i.UserID, i.Provider, i.Subject, i.Email))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, repo.ErrIdentityTaken
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ir *userIdentityRepo) Get(provider, subject string) (*repo.UserIdentity, error) {
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE provider=$1 AND subject=$2`
+
+	return scanUserIdentity(ir.db.QueryRow(query, provider, subject))
+}
+
+func (ir *userIdentityRepo) GetAll(userID int64) ([]*repo.UserIdentity, error) {
+	query := `SELECT ` + userIdentityColumns + ` FROM user_identities WHERE user_id=$1 ORDER BY created_at, id`
+
+	rows, err := ir.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*repo.UserIdentity, 0)
+	for rows.Next() {
+		i, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, i)
+	}
+
+	return result, rows.Err()
+}
+
+func (ir *userIdentityRepo) Delete(userID, id int64) error {
+	result, err := ir.db.Exec(`DELETE FROM user_identities WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsEffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsEffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
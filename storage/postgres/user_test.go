@@ -14,7 +14,7 @@ func createUser(t *testing.T) *repo.User {
 		LastName:  faker.LastName(),
 		Email:     faker.Email(),
 		Password:  faker.Password(),
-		Type:      repo.UserTypeUser,
+		Type:      repo.UserTypeAuthor,
 	})
 	require.NoError(t, err)
 	require.NotEmpty(t, u)
@@ -0,0 +1,30 @@
+package repo
+
+import "time"
+
+// APIToken is a personal access token. Only the hash of the token is stored
+type APIToken struct {
+	ID     int64
+	UserID int64
+	Name   string
+	// Prefix is the start of the token to tell the tokens apart
+	Prefix     string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type APITokenStorageI interface {
+	Create(t *APIToken) (*APIToken, error)
+	// GetByHash returns the token of the hash, expired ones included
+	GetByHash(tokenHash string) (*APIToken, error)
+	// GetAll returns the tokens of the user, newest first
+	GetAll(userID int64) ([]*APIToken, error)
+	// Delete revokes the token of the user
+	Delete(userID, id int64) error
+	// DeleteAll revokes every token of the user
+	DeleteAll(userID int64) error
+	UpdateLastUsed(id int64, usedAt time.Time) error
+}
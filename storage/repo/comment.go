@@ -3,33 +3,59 @@ package repo
 import "time"
 
 type Comment struct {
-	ID          int64
-	UserID      int64
-	PostID      int64
-	Description string
-	CreatedAt   time.Time
-	UpdatedAt   *time.Time
-	User        struct {
+	ID           int64
+	UserID       int64
+	PostID       int64
+	ParentID     *int64
+	Description  string
+	CreatedAt    time.Time
+	UpdatedAt    *time.Time
+	DeletedAt    *time.Time
+	RepliesCount int32
+	User         struct {
 		FirstName       string
 		LastName        string
 		Email           string
 		ProfileImageUrl *string
 	}
+	Post struct {
+		UserID int64
+	}
 }
 
 type GetAllCommentsParams struct {
-	Limit  int32
-	Page   int32
-	UserID int64
-	PostID int64
+	Limit    int32
+	Page     int32
+	UserID   int64
+	PostID   int64
+	ParentID int64
+	RootOnly bool
+	// Cursor switches from page to keyset pagination
+	Cursor *Cursor
+	// Comments of posts which are not published are listed only to the
+	// post author ViewerID
+	ViewerID int64
 }
 
 type GetAllCommentsResult struct {
 	Comments []*Comment
-	Count    int32
+	// Count is not filled when paginating by cursor
+	Count int32
+	// HasMore reports whether more rows follow in the paging direction
+	HasMore bool
 }
 
 type CommentStorageI interface {
 	Create(c *Comment) (*Comment, error)
+	Get(id int64) (*Comment, error)
 	GetAll(params *GetAllCommentsParams) (*GetAllCommentsResult, error)
+	// GetReplies returns the replies of the given comments down to depth levels
+	GetReplies(parentIDs []int64, depth int32) ([]*Comment, error)
+	Update(c *Comment) (*Comment, error)
+	// Delete removes a comment, or only blanks it out when it has replies.
+	// Blanked out ancestors left without replies are removed as well
+	Delete(id int64) error
+	// Search returns the comments of published posts matching the
+	// full-text query, best matches first
+	Search(params *SearchParams) (*SearchCommentsResult, error)
 }
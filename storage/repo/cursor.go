@@ -0,0 +1,12 @@
+package repo
+
+import "time"
+
+// Cursor points at a row of a listing sorted by (created_at, id).
+// A listing with a cursor returns the rows after it, or the rows
+// before it when Backward is set, without counting the total
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+	Backward  bool
+}
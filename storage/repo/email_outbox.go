@@ -0,0 +1,57 @@
+package repo
+
+import "time"
+
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+)
+
+// OutboxEmail is an email waiting to be sent, sent or given up on. It is
+// rendered from its type and body at send time, and Secrets only holds the
+// keys the secret template fields are looked up by
+type OutboxEmail struct {
+	ID            int64
+	To            []string
+	Subject       string
+	Type          string
+	Body          map[string]string
+	Secrets       map[string]string
+	Status        string
+	Attempts      int32
+	LastError     *string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+type GetAllEmailsParams struct {
+	Limit  int32
+	Page   int32
+	Status string
+}
+
+type GetAllEmailsResult struct {
+	Emails []*OutboxEmail
+	Count  int32
+}
+
+type EmailOutboxStorageI interface {
+	// Create queues a pending email due right away
+	Create(e *OutboxEmail) (*OutboxEmail, error)
+	Get(id int64) (*OutboxEmail, error)
+	// GetAll returns the emails, newest first
+	GetAll(params *GetAllEmailsParams) (*GetAllEmailsResult, error)
+	// ClaimDue returns up to limit pending emails due by now and postpones
+	// them by lease, so other workers skip them while they are being sent
+	ClaimDue(now time.Time, lease time.Duration, limit int32) ([]*OutboxEmail, error)
+	// ClaimFailed makes a failed email pending again, postponed by lease so
+	// the workers skip it while it is being resent. It returns sql.ErrNoRows
+	// unless the email is failed
+	ClaimFailed(id int64, now time.Time, lease time.Duration) (*OutboxEmail, error)
+	MarkSent(id int64, sentAt time.Time) error
+	// MarkFailed records a failed attempt. The email is retried at
+	// nextAttemptAt or dead-lettered as failed when nextAttemptAt is nil
+	MarkFailed(id int64, lastError string, nextAttemptAt *time.Time) error
+}
@@ -1,6 +1,19 @@
 package repo
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+	PostStatusArchived  = "archived"
+)
+
+// ErrCategoryNotFound is returned when the category of a post doesn't exist
+var ErrCategoryNotFound = errors.New("category not found")
 
 type Post struct {
 	ID          int64
@@ -12,6 +25,11 @@ type Post struct {
 	CreatedAt   time.Time
 	UpdatedAt   *time.Time
 	ViewsCount  int32
+	Tags        []string
+	Status      string
+	// PublishAt is when a scheduled post gets published or
+	// when a published post was published
+	PublishAt *time.Time
 }
 
 type GetAllPostsParams struct {
@@ -21,15 +39,36 @@ type GetAllPostsParams struct {
 	UserID     int64
 	CategoryID int64
 	SortByData string
+	Tags       []string
+	// TagsMatchAll requires posts to have every tag instead of any of them
+	TagsMatchAll bool
+	// Cursor switches from page to keyset pagination
+	Cursor *Cursor
+	// Status lists only the posts with the status, any status when empty.
+	// Posts which are not published are listed only to their author ViewerID
+	Status   string
+	ViewerID int64
 }
 
 type GetAllPostsResult struct {
 	Posts []*Post
+	// Count is not filled when paginating by cursor
 	Count int32
+	// HasMore reports whether more rows follow in the paging direction
+	HasMore bool
 }
 
 type PostStorageI interface {
 	Create(u *Post) (*Post, error)
+	// Get returns the post without counting a view
 	Get(id int64) (*Post, error)
+	// IncrementViews counts a view of the post
+	IncrementViews(id int64) error
 	GetAll(params *GetAllPostsParams) (*GetAllPostsResult, error)
+	Update(u *Post) (*Post, error)
+	Delete(id int64) error
+	// Search returns published posts matching the full-text query, best matches first
+	Search(params *SearchParams) (*SearchPostsResult, error)
+	// PublishScheduled publishes the scheduled posts due by now and returns their count
+	PublishScheduled(now time.Time) (int64, error)
 }
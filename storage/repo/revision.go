@@ -0,0 +1,34 @@
+package repo
+
+import "time"
+
+// PostRevision is a snapshot of the editable fields of a post
+type PostRevision struct {
+	ID          int64
+	PostID      int64
+	Revision    int32
+	Title       string
+	Description string
+	ImageUrl    *string
+	CategoryID  int64
+	CreatedAt   time.Time
+}
+
+type GetAllRevisionsParams struct {
+	PostID int64
+	Limit  int32
+	Page   int32
+}
+
+type GetAllRevisionsResult struct {
+	Revisions []*PostRevision
+	Count     int32
+}
+
+// RevisionStorageI reads the post revisions. They are written by
+// PostStorageI whenever a post is created or its content changes
+type RevisionStorageI interface {
+	Get(postID int64, revision int32) (*PostRevision, error)
+	// GetAll returns the revisions of a post, newest first
+	GetAll(params *GetAllRevisionsParams) (*GetAllRevisionsResult, error)
+}
@@ -0,0 +1,34 @@
+package repo
+
+type SearchParams struct {
+	Query string
+	Limit int32
+	Page  int32
+}
+
+type PostSearchResult struct {
+	Post Post
+	Rank float32
+	// Headline is the title and Snippet the part of the description
+	// around the matches. Both are HTML escaped, with the matched words
+	// wrapped in <b></b>
+	Headline string
+	Snippet  string
+}
+
+type SearchPostsResult struct {
+	Posts []*PostSearchResult
+	Count int32
+}
+
+type CommentSearchResult struct {
+	Comment Comment
+	Rank    float32
+	// Snippet is HTML escaped like PostSearchResult.Snippet
+	Snippet string
+}
+
+type SearchCommentsResult struct {
+	Comments []*CommentSearchResult
+	Count    int32
+}
@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login of a user. Its ID is the family id carried by every
+// access and refresh token issued for the login
+type Session struct {
+	ID         uuid.UUID
+	UserID     int64
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// ExpiresAt is when the last issued refresh token expires
+	ExpiresAt time.Time
+}
+
+type SessionStorageI interface {
+	Create(s *Session) (*Session, error)
+	Get(id uuid.UUID) (*Session, error)
+	// GetAll returns the unexpired sessions of the user, last seen first
+	GetAll(userID int64) ([]*Session, error)
+	UpdateLastSeen(id uuid.UUID, ip string, seenAt time.Time) error
+	Extend(id uuid.UUID, expiresAt time.Time) error
+	Delete(id uuid.UUID) error
+	// DeleteAll deletes the sessions of the user and returns their number
+	DeleteAll(userID int64) (int64, error)
+}
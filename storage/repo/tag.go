@@ -0,0 +1,26 @@
+package repo
+
+import "time"
+
+type Tag struct {
+	ID         int64
+	Name       string
+	PostsCount int32
+	CreatedAt  time.Time
+}
+
+type GetAllTagsParams struct {
+	Limit  int32
+	Page   int32
+	Search string
+}
+
+type GetAllTagsResult struct {
+	Tags  []*Tag
+	Count int32
+}
+
+type TagStorageI interface {
+	// GetAll returns tags with the number of published posts using them, most used first
+	GetAll(params *GetAllTagsParams) (*GetAllTagsResult, error)
+}
@@ -0,0 +1,24 @@
+package repo
+
+import "time"
+
+// TwoFactor is the enabled TOTP two-factor authentication of a user
+type TwoFactor struct {
+	UserID int64
+	Secret string
+	// RecoveryCodesLeft is the number of unused recovery codes
+	RecoveryCodesLeft int32
+	EnabledAt         time.Time
+}
+
+type TwoFactorStorageI interface {
+	// Enable enables two-factor authentication with the secret and the
+	// hashes of new recovery codes, replacing the previous ones
+	Enable(userID int64, secret string, recoveryCodeHashes []string) (*TwoFactor, error)
+	// Get returns sql.ErrNoRows if the user hasn't enabled two-factor authentication
+	Get(userID int64) (*TwoFactor, error)
+	Disable(userID int64) error
+	// UseRecoveryCode marks the recovery code of the hash used. It returns
+	// sql.ErrNoRows for unknown and already used codes
+	UseRecoveryCode(userID int64, codeHash string) error
+}
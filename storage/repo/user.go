@@ -1,10 +1,39 @@
 package repo
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 const (
 	UserTypeSuperadmin = "superadmin"
-	UserTypeUser       = "user"
+	UserTypeEditor     = "editor"
+	UserTypeModerator  = "moderator"
+	UserTypeAuthor     = "author"
+	UserTypeReader     = "reader"
+)
+
+const (
+	// UserDeletePolicyAnonymize keeps the posts and comments of a deleted
+	// user under an anonymized account
+	UserDeletePolicyAnonymize = "anonymize"
+	// UserDeletePolicyRemove removes the posts, comments and likes of a
+	// deleted user as well
+	UserDeletePolicyRemove = "remove"
+)
+
+// Names of the anonymized account left behind by a deleted user. Its email
+// becomes deleted_<id>@deleted.invalid
+const (
+	DeletedUserFirstName = "Deleted"
+	DeletedUserLastName  = "User"
+)
+
+// Errors returned by the updates when the new value belongs to another user
+var (
+	ErrUsernameTaken    = errors.New("username is already taken")
+	ErrPhoneNumberTaken = errors.New("phone number is already taken")
+	ErrEmailTaken       = errors.New("email is already taken")
 )
 
 type User struct {
@@ -25,6 +54,9 @@ type GetAllUsersParams struct {
 	Limit  int32
 	Page   int32
 	Search string
+	// SearchContacts also matches Search against the email and phone
+	// number, the other fields matched are public
+	SearchContacts bool
 }
 
 type GetAllUsersResult struct {
@@ -43,4 +75,13 @@ type UserStorageI interface {
 	GetByEmail(email string) (*User, error)
 	GetAll(params *GetAllUsersParams) (*GetAllUsersResult, error)
 	UpdatePassword(req *UpdatePassword) error
+	UpdateType(userID int64, userType string) error
+	// Update updates the profile fields of the user: the names, phone
+	// number, gender, username and profile image
+	Update(u *User) (*User, error)
+	UpdateEmail(userID int64, email string) error
+	// Delete anonymizes the account and, depending on the policy, removes
+	// the posts, comments and likes of the user. Deleted users aren't
+	// returned by the getters anymore
+	Delete(id int64, policy string) error
 }
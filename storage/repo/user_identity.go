@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIdentityTaken is returned when the provider account is linked to a user already
+var ErrIdentityTaken = errors.New("identity is already linked")
+
+// UserIdentity links a user to an account of an OpenID Connect provider
+type UserIdentity struct {
+	ID       int64
+	UserID   int64
+	Provider string
+	// Subject is the account id at the provider
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type UserIdentityStorageI interface {
+	Create(i *UserIdentity) (*UserIdentity, error)
+	// CreateUser creates the user along with its identity. It returns
+	// ErrEmailTaken or ErrIdentityTaken when another user got the email or
+	// the provider account first
+	CreateUser(user *User, i *UserIdentity) (*User, error)
+	Get(provider, subject string) (*UserIdentity, error)
+	// GetAll returns the identities of the user, oldest first
+	GetAll(userID int64) ([]*UserIdentity, error)
+	Delete(userID, id int64) error
+}
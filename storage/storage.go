@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"github.com/TemurMannonov/blog/storage/memory"
 	"github.com/TemurMannonov/blog/storage/postgres"
 	"github.com/TemurMannonov/blog/storage/repo"
 	"github.com/jmoiron/sqlx"
@@ -12,23 +13,44 @@ type StorageI interface {
 	Post() repo.PostStorageI
 	Comment() repo.CommentStorageI
 	Like() repo.LikeStorageI
+	Tag() repo.TagStorageI
+	Revision() repo.RevisionStorageI
+	EmailOutbox() repo.EmailOutboxStorageI
+	TwoFactor() repo.TwoFactorStorageI
+	APIToken() repo.APITokenStorageI
+	UserIdentity() repo.UserIdentityStorageI
+	Session() repo.SessionStorageI
 }
 
 type storagePg struct {
-	userRepo     repo.UserStorageI
-	categoryRepo repo.CategoryStorageI
-	postRepo     repo.PostStorageI
-	commentRepo  repo.CommentStorageI
-	likeRepo     repo.LikeStorageI
+	userRepo      repo.UserStorageI
+	categoryRepo  repo.CategoryStorageI
+	postRepo      repo.PostStorageI
+	commentRepo   repo.CommentStorageI
+	likeRepo      repo.LikeStorageI
+	tagRepo       repo.TagStorageI
+	revisionRepo  repo.RevisionStorageI
+	emailRepo     repo.EmailOutboxStorageI
+	twoFactorRepo repo.TwoFactorStorageI
+	apiTokenRepo  repo.APITokenStorageI
+	identityRepo  repo.UserIdentityStorageI
+	sessionRepo   repo.SessionStorageI
 }
 
 func NewStoragePg(db *sqlx.DB) StorageI {
 	return &storagePg{
-		userRepo:     postgres.NewUser(db),
-		categoryRepo: postgres.NewCategory(db),
-		postRepo:     postgres.NewPost(db),
-		commentRepo:  postgres.NewComment(db),
-		likeRepo:     postgres.NewLike(db),
+		userRepo:      postgres.NewUser(db),
+		categoryRepo:  postgres.NewCategory(db),
+		postRepo:      postgres.NewPost(db),
+		commentRepo:   postgres.NewComment(db),
+		likeRepo:      postgres.NewLike(db),
+		tagRepo:       postgres.NewTag(db),
+		revisionRepo:  postgres.NewRevision(db),
+		emailRepo:     postgres.NewEmailOutbox(db),
+		twoFactorRepo: postgres.NewTwoFactor(db),
+		apiTokenRepo:  postgres.NewAPIToken(db),
+		identityRepo:  postgres.NewUserIdentity(db),
+		sessionRepo:   postgres.NewSession(db),
 	}
 }
 
@@ -51,3 +73,114 @@ func (s *storagePg) Comment() repo.CommentStorageI {
 func (s *storagePg) Like() repo.LikeStorageI {
 	return s.likeRepo
 }
+
+func (s *storagePg) Tag() repo.TagStorageI {
+	return s.tagRepo
+}
+
+func (s *storagePg) Revision() repo.RevisionStorageI {
+	return s.revisionRepo
+}
+
+func (s *storagePg) EmailOutbox() repo.EmailOutboxStorageI {
+	return s.emailRepo
+}
+
+func (s *storagePg) TwoFactor() repo.TwoFactorStorageI {
+	return s.twoFactorRepo
+}
+
+func (s *storagePg) APIToken() repo.APITokenStorageI {
+	return s.apiTokenRepo
+}
+
+func (s *storagePg) UserIdentity() repo.UserIdentityStorageI {
+	return s.identityRepo
+}
+
+func (s *storagePg) Session() repo.SessionStorageI {
+	return s.sessionRepo
+}
+
+type storageMemory struct {
+	userRepo      repo.UserStorageI
+	categoryRepo  repo.CategoryStorageI
+	postRepo      repo.PostStorageI
+	commentRepo   repo.CommentStorageI
+	likeRepo      repo.LikeStorageI
+	tagRepo       repo.TagStorageI
+	revisionRepo  repo.RevisionStorageI
+	emailRepo     repo.EmailOutboxStorageI
+	twoFactorRepo repo.TwoFactorStorageI
+	apiTokenRepo  repo.APITokenStorageI
+	identityRepo  repo.UserIdentityStorageI
+	sessionRepo   repo.SessionStorageI
+}
+
+// NewStorageMemory returns a map-backed storage for tests and local demos
+func NewStorageMemory() StorageI {
+	db := memory.NewDB()
+
+	return &storageMemory{
+		userRepo:      memory.NewUser(db),
+		categoryRepo:  memory.NewCategory(db),
+		postRepo:      memory.NewPost(db),
+		commentRepo:   memory.NewComment(db),
+		likeRepo:      memory.NewLike(db),
+		tagRepo:       memory.NewTag(db),
+		revisionRepo:  memory.NewRevision(db),
+		emailRepo:     memory.NewEmailOutbox(db),
+		twoFactorRepo: memory.NewTwoFactor(db),
+		apiTokenRepo:  memory.NewAPIToken(db),
+		identityRepo:  memory.NewUserIdentity(db),
+		sessionRepo:   memory.NewSession(db),
+	}
+}
+
+func (s *storageMemory) User() repo.UserStorageI {
+	return s.userRepo
+}
+
+func (s *storageMemory) Category() repo.CategoryStorageI {
+	return s.categoryRepo
+}
+
+func (s *storageMemory) Post() repo.PostStorageI {
+	return s.postRepo
+}
+
+func (s *storageMemory) Comment() repo.CommentStorageI {
+	return s.commentRepo
+}
+
+func (s *storageMemory) Like() repo.LikeStorageI {
+	return s.likeRepo
+}
+
+func (s *storageMemory) Tag() repo.TagStorageI {
+	return s.tagRepo
+}
+
+func (s *storageMemory) Revision() repo.RevisionStorageI {
+	return s.revisionRepo
+}
+
+func (s *storageMemory) EmailOutbox() repo.EmailOutboxStorageI {
+	return s.emailRepo
+}
+
+func (s *storageMemory) TwoFactor() repo.TwoFactorStorageI {
+	return s.twoFactorRepo
+}
+
+func (s *storageMemory) APIToken() repo.APITokenStorageI {
+	return s.apiTokenRepo
+}
+
+func (s *storageMemory) UserIdentity() repo.UserIdentityStorageI {
+	return s.identityRepo
+}
+
+func (s *storageMemory) Session() repo.SessionStorageI {
+	return s.sessionRepo
+}
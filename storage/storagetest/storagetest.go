@@ -0,0 +1,1542 @@
+// Package storagetest contains the conformance suite every storage.StorageI
+// implementation has to pass.
+package storagetest
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TemurMannonov/blog/storage"
+	"github.com/TemurMannonov/blog/storage/repo"
+	"github.com/bxcodec/faker/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance suite against strg
+func Run(t *testing.T, strg storage.StorageI) {
+	t.Run("User", func(t *testing.T) { testUser(t, strg) })
+	t.Run("Category", func(t *testing.T) { testCategory(t, strg) })
+	t.Run("Post", func(t *testing.T) { testPost(t, strg) })
+	t.Run("PostUpdateDelete", func(t *testing.T) { testPostUpdateDelete(t, strg) })
+	t.Run("Comment", func(t *testing.T) { testComment(t, strg) })
+	t.Run("CommentThread", func(t *testing.T) { testCommentThread(t, strg) })
+	t.Run("Like", func(t *testing.T) { testLike(t, strg) })
+	t.Run("Tag", func(t *testing.T) { testTag(t, strg) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, strg) })
+	t.Run("SearchEscaping", func(t *testing.T) { testSearchEscaping(t, strg) })
+	t.Run("FilterInjection", func(t *testing.T) { testFilterInjection(t, strg) })
+	t.Run("CursorPagination", func(t *testing.T) { testCursorPagination(t, strg) })
+	t.Run("PostStatus", func(t *testing.T) { testPostStatus(t, strg) })
+	t.Run("Revision", func(t *testing.T) { testRevision(t, strg) })
+	t.Run("EmailOutbox", func(t *testing.T) { testEmailOutbox(t, strg) })
+	t.Run("UserUpdateDelete", func(t *testing.T) { testUserUpdateDelete(t, strg) })
+	t.Run("TwoFactor", func(t *testing.T) { testTwoFactor(t, strg) })
+	t.Run("APIToken", func(t *testing.T) { testAPIToken(t, strg) })
+	t.Run("UserIdentity", func(t *testing.T) { testUserIdentity(t, strg) })
+	t.Run("UserIdentityCreateUser", func(t *testing.T) { testUserIdentityCreateUser(t, strg) })
+	t.Run("Session", func(t *testing.T) { testSession(t, strg) })
+}
+
+func CreateUser(t *testing.T, strg storage.StorageI) *repo.User {
+	u, err := strg.User().Create(&repo.User{
+		FirstName: faker.FirstName(),
+		LastName:  faker.LastName(),
+		Email:     faker.UUIDDigit() + "@example.com",
+		Password:  faker.Password(),
+		Type:      repo.UserTypeAuthor,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, u.ID)
+	require.NotZero(t, u.CreatedAt)
+
+	return u
+}
+
+func CreateCategory(t *testing.T, strg storage.StorageI) *repo.Category {
+	c, err := strg.Category().Create(&repo.Category{
+		Title: faker.UUIDHyphenated(),
+	})
+	require.NoError(t, err)
+	require.NotZero(t, c.ID)
+	require.NotZero(t, c.CreatedAt)
+
+	return c
+}
+
+func CreatePost(t *testing.T, strg storage.StorageI, userID, categoryID int64) *repo.Post {
+	p, err := strg.Post().Create(&repo.Post{
+		Title:       faker.UUIDHyphenated(),
+		Description: faker.Sentence(),
+		UserID:      userID,
+		CategoryID:  categoryID,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, p.ID)
+	require.NotZero(t, p.CreatedAt)
+
+	return p
+}
+
+func testUser(t *testing.T, strg storage.StorageI) {
+	u := CreateUser(t, strg)
+
+	user, err := strg.User().Get(u.ID)
+	require.NoError(t, err)
+	require.Equal(t, u.Email, user.Email)
+	require.Equal(t, u.FirstName, user.FirstName)
+
+	user, err = strg.User().GetByEmail(u.Email)
+	require.NoError(t, err)
+	require.Equal(t, u.ID, user.ID)
+
+	_, err = strg.User().GetByEmail(faker.UUIDDigit() + "@example.com")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = strg.User().Create(&repo.User{
+		FirstName: faker.FirstName(),
+		LastName:  faker.LastName(),
+		Email:     u.Email,
+		Password:  faker.Password(),
+		Type:      repo.UserTypeAuthor,
+	})
+	require.Error(t, err)
+
+	result, err := strg.User().GetAll(&repo.GetAllUsersParams{
+		Limit:          10,
+		Page:           1,
+		Search:         u.Email,
+		SearchContacts: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result.Count)
+	require.Len(t, result.Users, 1)
+	require.Equal(t, u.ID, result.Users[0].ID)
+
+	// the email isn't matched unless the contacts are searched
+	result, err = strg.User().GetAll(&repo.GetAllUsersParams{
+		Limit:  10,
+		Page:   1,
+		Search: u.Email,
+	})
+	require.NoError(t, err)
+	require.Zero(t, result.Count)
+
+	err = strg.User().UpdatePassword(&repo.UpdatePassword{
+		UserID:   u.ID,
+		Password: "new_password",
+	})
+	require.NoError(t, err)
+
+	user, err = strg.User().Get(u.ID)
+	require.NoError(t, err)
+	require.Equal(t, "new_password", user.Password)
+
+	require.NoError(t, strg.User().UpdateType(u.ID, repo.UserTypeEditor))
+
+	user, err = strg.User().Get(u.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.UserTypeEditor, user.Type)
+
+	err = strg.User().UpdateType(-1, repo.UserTypeEditor)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testUserUpdateDelete(t *testing.T, strg storage.StorageI) {
+	strPtr := func(s string) *string { return &s }
+
+	taken := CreateUser(t, strg)
+	_, err := strg.User().Update(&repo.User{
+		ID:          taken.ID,
+		FirstName:   taken.FirstName,
+		LastName:    taken.LastName,
+		PhoneNumber: strPtr(faker.UUIDDigit()[:20]),
+		Username:    strPtr(faker.UUIDDigit()[:30]),
+	})
+	require.NoError(t, err)
+	taken, err = strg.User().Get(taken.ID)
+	require.NoError(t, err)
+
+	u := CreateUser(t, strg)
+	updated, err := strg.User().Update(&repo.User{
+		ID:              u.ID,
+		FirstName:       faker.FirstName(),
+		LastName:        faker.LastName(),
+		Gender:          strPtr("female"),
+		ProfileImageUrl: strPtr(faker.URL()),
+	})
+	require.NoError(t, err)
+	require.Equal(t, u.Email, updated.Email)
+	require.Equal(t, u.Type, updated.Type)
+
+	user, err := strg.User().Get(u.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated.FirstName, user.FirstName)
+	require.Equal(t, "female", *user.Gender)
+	require.Equal(t, *updated.ProfileImageUrl, *user.ProfileImageUrl)
+
+	_, err = strg.User().Update(&repo.User{ID: u.ID, FirstName: "a", LastName: "b", Username: taken.Username})
+	require.ErrorIs(t, err, repo.ErrUsernameTaken)
+
+	_, err = strg.User().Update(&repo.User{ID: u.ID, FirstName: "a", LastName: "b", PhoneNumber: taken.PhoneNumber})
+	require.ErrorIs(t, err, repo.ErrPhoneNumberTaken)
+
+	_, err = strg.User().Update(&repo.User{ID: -1, FirstName: "a", LastName: "b"})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	email := faker.UUIDDigit() + "@example.com"
+	require.NoError(t, strg.User().UpdateEmail(u.ID, email))
+	require.ErrorIs(t, strg.User().UpdateEmail(u.ID, taken.Email), repo.ErrEmailTaken)
+	require.ErrorIs(t, strg.User().UpdateEmail(-1, faker.UUIDDigit()+"@example.com"), sql.ErrNoRows)
+
+	user, err = strg.User().GetByEmail(email)
+	require.NoError(t, err)
+	require.Equal(t, u.ID, user.ID)
+
+	_, err = strg.User().GetByEmail(u.Email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	u.Email = email
+
+	// the content of an anonymized user stays
+	other := CreateUser(t, strg)
+	category := CreateCategory(t, strg)
+	post := CreatePost(t, strg, u.ID, category.ID)
+	comment, err := strg.Comment().Create(&repo.Comment{UserID: u.ID, PostID: post.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+
+	require.NoError(t, strg.User().Delete(u.ID, repo.UserDeletePolicyAnonymize))
+	require.ErrorIs(t, strg.User().Delete(u.ID, repo.UserDeletePolicyAnonymize), sql.ErrNoRows)
+
+	_, err = strg.User().Get(u.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = strg.User().GetByEmail(u.Email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = strg.Post().Get(post.ID)
+	require.NoError(t, err)
+
+	comment, err = strg.Comment().Get(comment.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.DeletedUserFirstName, comment.User.FirstName)
+	require.NotEqual(t, u.Email, comment.User.Email)
+
+	// the content of a removed user goes away
+	u = CreateUser(t, strg)
+	post = CreatePost(t, strg, u.ID, category.ID)
+	otherPost := CreatePost(t, strg, other.ID, category.ID)
+
+	_, err = strg.Comment().Create(&repo.Comment{UserID: other.ID, PostID: post.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	replied, err := strg.Comment().Create(&repo.Comment{UserID: u.ID, PostID: otherPost.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	_, err = strg.Comment().Create(&repo.Comment{UserID: other.ID, PostID: otherPost.ID, ParentID: &replied.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	leaf, err := strg.Comment().Create(&repo.Comment{UserID: u.ID, PostID: otherPost.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	require.NoError(t, strg.Like().CreateOrUpdate(&repo.Like{UserID: u.ID, PostID: otherPost.ID, Status: true}))
+
+	// deleted comments of others whose only replies are the user's
+	root, err := strg.Comment().Create(&repo.Comment{UserID: other.ID, PostID: otherPost.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	middle, err := strg.Comment().Create(&repo.Comment{UserID: other.ID, PostID: otherPost.ID, ParentID: &root.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	_, err = strg.Comment().Create(&repo.Comment{UserID: u.ID, PostID: otherPost.ID, ParentID: &middle.ID, Description: faker.Sentence()})
+	require.NoError(t, err)
+	require.NoError(t, strg.Comment().Delete(root.ID))
+	require.NoError(t, strg.Comment().Delete(middle.ID))
+
+	require.NoError(t, strg.User().Delete(u.ID, repo.UserDeletePolicyRemove))
+
+	for _, id := range []int64{root.ID, middle.ID} {
+		_, err = strg.Comment().Get(id)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	}
+
+	_, err = strg.Post().Get(post.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	comment, err = strg.Comment().Get(replied.ID)
+	require.NoError(t, err)
+	require.NotNil(t, comment.DeletedAt)
+	require.Empty(t, comment.Description)
+
+	_, err = strg.Comment().Get(leaf.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = strg.Like().Get(u.ID, otherPost.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testCategory(t *testing.T, strg storage.StorageI) {
+	c := CreateCategory(t, strg)
+
+	category, err := strg.Category().Get(c.ID)
+	require.NoError(t, err)
+	require.Equal(t, c.Title, category.Title)
+
+	_, err = strg.Category().Create(&repo.Category{Title: c.Title})
+	require.Error(t, err)
+
+	result, err := strg.Category().GetAll(&repo.GetAllCategoriesParams{
+		Limit:  10,
+		Page:   1,
+		Search: c.Title,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result.Count)
+	require.Equal(t, c.ID, result.Categories[0].ID)
+
+	c.Title = faker.UUIDHyphenated()
+	category, err = strg.Category().Update(c)
+	require.NoError(t, err)
+	require.Equal(t, c.Title, category.Title)
+
+	_, err = strg.Category().Update(&repo.Category{ID: -1, Title: faker.UUIDHyphenated()})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	used := CreateCategory(t, strg)
+	CreatePost(t, strg, CreateUser(t, strg).ID, used.ID)
+	require.Error(t, strg.Category().Delete(used.ID))
+
+	require.NoError(t, strg.Category().Delete(c.ID))
+	require.ErrorIs(t, strg.Category().Delete(c.ID), sql.ErrNoRows)
+
+	_, err = strg.Category().Get(c.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testPost(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	category := CreateCategory(t, strg)
+
+	first := CreatePost(t, strg, user.ID, category.ID)
+	second := CreatePost(t, strg, user.ID, category.ID)
+	CreatePost(t, strg, CreateUser(t, strg).ID, category.ID)
+
+	_, err := strg.Post().Create(&repo.Post{
+		Title:       faker.Sentence(),
+		Description: faker.Sentence(),
+		UserID:      -1,
+		CategoryID:  category.ID,
+	})
+	require.Error(t, err)
+
+	_, err = strg.Post().Create(&repo.Post{
+		Title:       faker.Sentence(),
+		Description: faker.Sentence(),
+		UserID:      user.ID,
+		CategoryID:  -1,
+	})
+	require.ErrorIs(t, err, repo.ErrCategoryNotFound)
+
+	post, err := strg.Post().Get(first.ID)
+	require.NoError(t, err)
+	require.Equal(t, first.Title, post.Title)
+	require.Equal(t, int32(0), post.ViewsCount)
+
+	require.NoError(t, strg.Post().IncrementViews(first.ID))
+	require.NoError(t, strg.Post().IncrementViews(first.ID))
+
+	post, err = strg.Post().Get(first.ID)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), post.ViewsCount)
+
+	_, err = strg.Post().Get(-1)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, strg.Post().IncrementViews(-1), sql.ErrNoRows)
+
+	result, err := strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:  10,
+		Page:   1,
+		UserID: user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+	require.Equal(t, second.ID, result.Posts[0].ID)
+	require.Equal(t, first.ID, result.Posts[1].ID)
+
+	result, err = strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:      1,
+		Page:       1,
+		UserID:     user.ID,
+		SortByData: "asc",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+	require.Len(t, result.Posts, 1)
+	require.Equal(t, first.ID, result.Posts[0].ID)
+
+	result, err = strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:      1,
+		Page:       2,
+		UserID:     user.ID,
+		SortByData: "asc",
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Posts, 1)
+	require.Equal(t, second.ID, result.Posts[0].ID)
+
+	result, err = strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:      10,
+		Page:       1,
+		CategoryID: category.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), result.Count)
+	post.CategoryID = -1
+	_, err = strg.Post().Update(post)
+	require.ErrorIs(t, err, repo.ErrCategoryNotFound)
+}
+
+func testSearch(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	category := CreateCategory(t, strg)
+	word := uniqueWord()
+
+	inTitle, err := strg.Post().Create(&repo.Post{
+		Title:       faker.Sentence() + " " + word,
+		Description: faker.Paragraph(),
+		UserID:      user.ID,
+		CategoryID:  category.ID,
+	})
+	require.NoError(t, err)
+
+	inDescription, err := strg.Post().Create(&repo.Post{
+		Title:       faker.Sentence(),
+		Description: faker.Sentence() + " " + strings.ToUpper(word) + " " + faker.Sentence(),
+		UserID:      user.ID,
+		CategoryID:  category.ID,
+	})
+	require.NoError(t, err)
+
+	result, err := strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:  10,
+		Page:   1,
+		Search: word,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+
+	result, err = strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:  10,
+		Page:   1,
+		Search: word + " " + uniqueWord(),
+	})
+	require.NoError(t, err)
+	require.Zero(t, result.Count)
+
+	posts, err := strg.Post().Search(&repo.SearchParams{Query: word, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), posts.Count)
+	require.Equal(t, inTitle.ID, posts.Posts[0].Post.ID)
+	require.Equal(t, inDescription.ID, posts.Posts[1].Post.ID)
+	require.Greater(t, posts.Posts[0].Rank, posts.Posts[1].Rank)
+	require.Contains(t, posts.Posts[0].Headline, "<b>"+word+"</b>")
+	require.Contains(t, posts.Posts[1].Snippet, "<b>"+strings.ToUpper(word)+"</b>")
+
+	_, err = strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      inTitle.ID,
+		Description: faker.Sentence() + " " + word,
+	})
+	require.NoError(t, err)
+
+	draft, err := strg.Post().Create(&repo.Post{
+		Title:       faker.Sentence(),
+		Description: faker.Sentence(),
+		UserID:      user.ID,
+		CategoryID:  category.ID,
+		Status:      repo.PostStatusDraft,
+	})
+	require.NoError(t, err)
+
+	// comments of posts which are not published are not searched
+	_, err = strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      draft.ID,
+		Description: faker.Sentence() + " " + word,
+	})
+	require.NoError(t, err)
+
+	comments, err := strg.Comment().Search(&repo.SearchParams{Query: word, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), comments.Count)
+	require.Equal(t, inTitle.ID, comments.Comments[0].Comment.PostID)
+	require.Equal(t, user.Email, comments.Comments[0].Comment.User.Email)
+	require.Contains(t, comments.Comments[0].Snippet, "<b>"+word+"</b>")
+}
+
+func testSearchEscaping(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	word := uniqueWord()
+	markup := `<img src=x onerror="alert(1)">`
+
+	post, err := strg.Post().Create(&repo.Post{
+		Title:       markup + " " + word,
+		Description: markup + " " + word,
+		UserID:      user.ID,
+		CategoryID:  CreateCategory(t, strg).ID,
+	})
+	require.NoError(t, err)
+
+	_, err = strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      post.ID,
+		Description: markup + " " + word,
+	})
+	require.NoError(t, err)
+
+	// the text around the matches is escaped, <b></b> is the only markup
+	posts, err := strg.Post().Search(&repo.SearchParams{Query: word, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Len(t, posts.Posts, 1)
+	require.NotContains(t, posts.Posts[0].Headline, "<img")
+	require.Contains(t, posts.Posts[0].Headline, "&lt;img")
+	require.Contains(t, posts.Posts[0].Headline, "<b>"+word+"</b>")
+	require.NotContains(t, posts.Posts[0].Snippet, "<img")
+
+	comments, err := strg.Comment().Search(&repo.SearchParams{Query: word, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Len(t, comments.Comments, 1)
+	require.NotContains(t, comments.Comments[0].Snippet, "<img")
+	require.Contains(t, comments.Comments[0].Snippet, "<b>"+word+"</b>")
+}
+
+func testFilterInjection(t *testing.T, strg storage.StorageI) {
+	word := uniqueWord()
+	c, err := strg.Category().Create(&repo.Category{Title: word + " 100%"})
+	require.NoError(t, err)
+
+	categories, err := strg.Category().GetAll(&repo.GetAllCategoriesParams{Limit: 10, Page: 1, Search: word + " 100%"})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), categories.Count)
+	require.Equal(t, c.ID, categories.Categories[0].ID)
+
+	// wildcards in the search match literally
+	categories, err = strg.Category().GetAll(&repo.GetAllCategoriesParams{Limit: 10, Page: 1, Search: word + "_100"})
+	require.NoError(t, err)
+	require.Zero(t, categories.Count)
+
+	payloads := []string{
+		"' OR '1'='1",
+		word + "%'; DROP TABLE users; --",
+		word + "') OR true --",
+	}
+
+	for _, payload := range payloads {
+		categories, err := strg.Category().GetAll(&repo.GetAllCategoriesParams{Limit: 10, Page: 1, Search: payload})
+		require.NoError(t, err)
+		require.Zero(t, categories.Count)
+
+		users, err := strg.User().GetAll(&repo.GetAllUsersParams{Limit: 10, Page: 1, Search: payload})
+		require.NoError(t, err)
+		require.Zero(t, users.Count)
+
+		tags, err := strg.Tag().GetAll(&repo.GetAllTagsParams{Limit: 10, Page: 1, Search: payload})
+		require.NoError(t, err)
+		require.Zero(t, tags.Count)
+
+		_, err = strg.Post().GetAll(&repo.GetAllPostsParams{Limit: 10, Page: 1, Search: payload, SortByData: payload})
+		require.NoError(t, err)
+	}
+
+	_, err = strg.User().Get(CreateUser(t, strg).ID)
+	require.NoError(t, err)
+}
+
+func testCursorPagination(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	category := CreateCategory(t, strg)
+
+	for i := 0; i < 5; i++ {
+		CreatePost(t, strg, user.ID, category.ID)
+	}
+
+	postIDs := func(posts []*repo.Post) []int64 {
+		ids := make([]int64, 0, len(posts))
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	cursor := func(p *repo.Post, backward bool) *repo.Cursor {
+		return &repo.Cursor{CreatedAt: p.CreatedAt, ID: p.ID, Backward: backward}
+	}
+
+	for _, order := range []string{"desc", "asc"} {
+		all, err := strg.Post().GetAll(&repo.GetAllPostsParams{Limit: 10, Page: 1, UserID: user.ID, SortByData: order})
+		require.NoError(t, err)
+		require.Equal(t, int32(5), all.Count)
+		require.False(t, all.HasMore)
+
+		first, err := strg.Post().GetAll(&repo.GetAllPostsParams{Limit: 2, Page: 1, UserID: user.ID, SortByData: order})
+		require.NoError(t, err)
+		require.True(t, first.HasMore)
+		require.Equal(t, postIDs(all.Posts[:2]), postIDs(first.Posts))
+
+		second, err := strg.Post().GetAll(&repo.GetAllPostsParams{
+			Limit:      2,
+			UserID:     user.ID,
+			SortByData: order,
+			Cursor:     cursor(first.Posts[1], false),
+		})
+		require.NoError(t, err)
+		require.True(t, second.HasMore)
+		require.Equal(t, postIDs(all.Posts[2:4]), postIDs(second.Posts))
+
+		// posts created while scrolling do not shift the next pages
+		CreatePost(t, strg, user.ID, category.ID)
+
+		last, err := strg.Post().GetAll(&repo.GetAllPostsParams{
+			Limit:      2,
+			UserID:     user.ID,
+			SortByData: order,
+			Cursor:     cursor(second.Posts[1], false),
+		})
+		require.NoError(t, err)
+		require.False(t, last.HasMore)
+		require.Equal(t, all.Posts[4].ID, last.Posts[0].ID)
+		if order == "desc" {
+			require.Len(t, last.Posts, 1)
+		} else {
+			require.Len(t, last.Posts, 2)
+		}
+
+		previous, err := strg.Post().GetAll(&repo.GetAllPostsParams{
+			Limit:      2,
+			UserID:     user.ID,
+			SortByData: order,
+			Cursor:     cursor(last.Posts[0], true),
+		})
+		require.NoError(t, err)
+		require.True(t, previous.HasMore)
+		require.Equal(t, postIDs(second.Posts), postIDs(previous.Posts))
+
+		previous, err = strg.Post().GetAll(&repo.GetAllPostsParams{
+			Limit:      2,
+			UserID:     user.ID,
+			SortByData: order,
+			Cursor:     cursor(previous.Posts[0], true),
+		})
+		require.NoError(t, err)
+		// the newest post created while scrolling precedes the first page
+		require.Equal(t, order == "desc", previous.HasMore)
+		require.Equal(t, postIDs(first.Posts), postIDs(previous.Posts))
+
+		user = CreateUser(t, strg)
+		for i := 0; i < 5; i++ {
+			CreatePost(t, strg, user.ID, category.ID)
+		}
+	}
+
+	post := CreatePost(t, strg, user.ID, category.ID)
+	for i := 0; i < 3; i++ {
+		_, err := strg.Comment().Create(&repo.Comment{
+			UserID:      user.ID,
+			PostID:      post.ID,
+			Description: faker.Sentence(),
+		})
+		require.NoError(t, err)
+	}
+
+	all, err := strg.Comment().GetAll(&repo.GetAllCommentsParams{Limit: 10, Page: 1, PostID: post.ID})
+	require.NoError(t, err)
+	require.Len(t, all.Comments, 3)
+
+	comments, err := strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:  10,
+		PostID: post.ID,
+		Cursor: &repo.Cursor{CreatedAt: all.Comments[0].CreatedAt, ID: all.Comments[0].ID},
+	})
+	require.NoError(t, err)
+	require.False(t, comments.HasMore)
+	require.Len(t, comments.Comments, 2)
+	require.Equal(t, all.Comments[1].ID, comments.Comments[0].ID)
+	require.Equal(t, all.Comments[2].ID, comments.Comments[1].ID)
+
+	comments, err = strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:  1,
+		PostID: post.ID,
+		Cursor: &repo.Cursor{CreatedAt: all.Comments[2].CreatedAt, ID: all.Comments[2].ID, Backward: true},
+	})
+	require.NoError(t, err)
+	require.True(t, comments.HasMore)
+	require.Len(t, comments.Comments, 1)
+	require.Equal(t, all.Comments[1].ID, comments.Comments[0].ID)
+}
+
+func testPostStatus(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	category := CreateCategory(t, strg)
+
+	published := CreatePost(t, strg, user.ID, category.ID)
+	require.Equal(t, repo.PostStatusPublished, published.Status)
+	require.NotNil(t, published.PublishAt)
+
+	word := uniqueWord()
+	draft, err := strg.Post().Create(&repo.Post{
+		Title:      word,
+		UserID:     user.ID,
+		CategoryID: category.ID,
+		Status:     repo.PostStatusDraft,
+	})
+	require.NoError(t, err)
+	require.Nil(t, draft.PublishAt)
+
+	hour := time.Now().Add(time.Hour)
+	scheduled, err := strg.Post().Create(&repo.Post{
+		Title:      faker.Sentence(),
+		UserID:     user.ID,
+		CategoryID: category.ID,
+		Status:     repo.PostStatusScheduled,
+		PublishAt:  &hour,
+	})
+	require.NoError(t, err)
+
+	minute := time.Now().Add(-time.Minute)
+	due, err := strg.Post().Create(&repo.Post{
+		Title:      faker.Sentence(),
+		UserID:     user.ID,
+		CategoryID: category.ID,
+		Status:     repo.PostStatusScheduled,
+		PublishAt:  &minute,
+	})
+	require.NoError(t, err)
+
+	listed := func(params *repo.GetAllPostsParams) []int64 {
+		params.Limit, params.Page, params.UserID = 10, 1, user.ID
+
+		result, err := strg.Post().GetAll(params)
+		require.NoError(t, err)
+
+		ids := make([]int64, 0, len(result.Posts))
+		for _, p := range result.Posts {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	require.Equal(t, []int64{published.ID}, listed(&repo.GetAllPostsParams{}))
+	require.Equal(t, []int64{published.ID}, listed(&repo.GetAllPostsParams{ViewerID: CreateUser(t, strg).ID}))
+	require.ElementsMatch(t, []int64{published.ID, draft.ID, scheduled.ID, due.ID}, listed(&repo.GetAllPostsParams{ViewerID: user.ID}))
+	require.Equal(t, []int64{draft.ID}, listed(&repo.GetAllPostsParams{ViewerID: user.ID, Status: repo.PostStatusDraft}))
+	require.Empty(t, listed(&repo.GetAllPostsParams{Status: repo.PostStatusDraft}))
+
+	search, err := strg.Post().Search(&repo.SearchParams{Query: word, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Zero(t, search.Count)
+
+	count, err := strg.Post().PublishScheduled(time.Now())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, count, int64(1))
+
+	post, err := strg.Post().Get(due.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.PostStatusPublished, post.Status)
+
+	post, err = strg.Post().Get(scheduled.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.PostStatusScheduled, post.Status)
+
+	require.ElementsMatch(t, []int64{published.ID, due.ID}, listed(&repo.GetAllPostsParams{}))
+
+	published.Status = repo.PostStatusArchived
+	published, err = strg.Post().Update(published)
+	require.NoError(t, err)
+	require.Equal(t, repo.PostStatusArchived, published.Status)
+
+	// updating without a status keeps it
+	published.Status = ""
+	published, err = strg.Post().Update(published)
+	require.NoError(t, err)
+	require.Equal(t, repo.PostStatusArchived, published.Status)
+
+	require.Equal(t, []int64{due.ID}, listed(&repo.GetAllPostsParams{}))
+}
+
+func testRevision(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	post := CreatePost(t, strg, user.ID, CreateCategory(t, strg).ID)
+
+	first, err := strg.Revision().Get(post.ID, 1)
+	require.NoError(t, err)
+	require.Equal(t, post.Title, first.Title)
+	require.Equal(t, post.Description, first.Description)
+	require.Equal(t, post.CategoryID, first.CategoryID)
+
+	title := post.Title
+	post.Title = faker.UUIDHyphenated()
+	post, err = strg.Post().Update(post)
+	require.NoError(t, err)
+
+	// changing only the tags does not add a revision
+	post.Tags = []string{faker.Word()}
+	post, err = strg.Post().Update(post)
+	require.NoError(t, err)
+
+	result, err := strg.Revision().GetAll(&repo.GetAllRevisionsParams{PostID: post.ID, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+	require.Equal(t, int32(2), result.Revisions[0].Revision)
+	require.Equal(t, post.Title, result.Revisions[0].Title)
+	require.Equal(t, int32(1), result.Revisions[1].Revision)
+	require.Equal(t, title, result.Revisions[1].Title)
+
+	_, err = strg.Revision().Get(post.ID, 3)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, strg.Post().Delete(post.ID))
+
+	result, err = strg.Revision().GetAll(&repo.GetAllRevisionsParams{PostID: post.ID, Limit: 10, Page: 1})
+	require.NoError(t, err)
+	require.Zero(t, result.Count)
+}
+
+func testEmailOutbox(t *testing.T, strg storage.StorageI) {
+	create := func() *repo.OutboxEmail {
+		e, err := strg.EmailOutbox().Create(&repo.OutboxEmail{
+			To:      []string{faker.Email()},
+			Subject: faker.Sentence(),
+			Type:    "verification_email",
+			Body:    map[string]string{"name": faker.FirstName()},
+			Secrets: map[string]string{"code": "register_code_" + faker.Email()},
+		})
+		require.NoError(t, err)
+		require.Equal(t, repo.EmailStatusPending, e.Status)
+		require.Equal(t, "verification_email", e.Type)
+		require.Len(t, e.Body, 1)
+		require.Len(t, e.Secrets, 1)
+		require.Zero(t, e.Attempts)
+		return e
+	}
+
+	claimed := func(now time.Time, id int64) bool {
+		emails, err := strg.EmailOutbox().ClaimDue(now, time.Minute, 1000)
+		require.NoError(t, err)
+		for _, e := range emails {
+			if e.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	failing := create()
+
+	now := time.Now().Add(time.Second)
+	require.True(t, claimed(now, failing.ID))
+	// claimed emails are leased to the worker
+	require.False(t, claimed(now, failing.ID))
+
+	retryAt := now.Add(time.Hour)
+	require.NoError(t, strg.EmailOutbox().MarkFailed(failing.ID, "connection refused", &retryAt))
+
+	e, err := strg.EmailOutbox().Get(failing.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.EmailStatusPending, e.Status)
+	require.Equal(t, int32(1), e.Attempts)
+	require.Equal(t, "connection refused", *e.LastError)
+	require.Equal(t, failing.To, e.To)
+	require.Equal(t, failing.Body, e.Body)
+	require.Equal(t, failing.Secrets, e.Secrets)
+
+	require.False(t, claimed(now.Add(time.Minute), failing.ID))
+	require.True(t, claimed(retryAt, failing.ID))
+
+	require.NoError(t, strg.EmailOutbox().MarkFailed(failing.ID, "mailbox unavailable", nil))
+
+	e, err = strg.EmailOutbox().Get(failing.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.EmailStatusFailed, e.Status)
+	require.Equal(t, int32(2), e.Attempts)
+	require.False(t, claimed(retryAt.Add(time.Hour), failing.ID))
+
+	failed, err := strg.EmailOutbox().GetAll(&repo.GetAllEmailsParams{Limit: 1, Page: 1, Status: repo.EmailStatusFailed})
+	require.NoError(t, err)
+	require.Equal(t, failing.ID, failed.Emails[0].ID)
+
+	resent, err := strg.EmailOutbox().ClaimFailed(failing.ID, retryAt, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, repo.EmailStatusPending, resent.Status)
+	// a claimed email can't be resent again or picked up by the workers
+	_, err = strg.EmailOutbox().ClaimFailed(failing.ID, retryAt, time.Minute)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.False(t, claimed(retryAt, failing.ID))
+	require.NoError(t, strg.EmailOutbox().MarkFailed(failing.ID, "mailbox unavailable", nil))
+
+	sent := create()
+	require.NoError(t, strg.EmailOutbox().MarkSent(sent.ID, time.Now()))
+
+	e, err = strg.EmailOutbox().Get(sent.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.EmailStatusSent, e.Status)
+	require.NotNil(t, e.SentAt)
+
+	_, err = strg.EmailOutbox().ClaimFailed(sent.ID, time.Now(), time.Minute)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.ErrorIs(t, strg.EmailOutbox().MarkSent(-1, time.Now()), sql.ErrNoRows)
+	_, err = strg.EmailOutbox().Get(-1)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+// uniqueWord returns a single word search token unlikely to exist in the storage
+func uniqueWord() string {
+	return "w" + faker.UUIDDigit()
+}
+
+func testPostUpdateDelete(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	post := CreatePost(t, strg, user.ID, CreateCategory(t, strg).ID)
+	require.Nil(t, post.UpdatedAt)
+
+	category := CreateCategory(t, strg)
+	updated, err := strg.Post().Update(&repo.Post{
+		ID:          post.ID,
+		Title:       faker.UUIDHyphenated(),
+		Description: faker.Sentence(),
+		CategoryID:  category.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.ID, updated.UserID)
+	require.NotNil(t, updated.UpdatedAt)
+
+	got, err := strg.Post().Get(post.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated.Title, got.Title)
+	require.Equal(t, updated.Description, got.Description)
+	require.Equal(t, category.ID, got.CategoryID)
+	require.NotNil(t, got.UpdatedAt)
+
+	_, err = strg.Post().Update(&repo.Post{ID: -1, Title: faker.Sentence(), CategoryID: category.ID})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      post.ID,
+		Description: faker.Sentence(),
+	})
+	require.NoError(t, err)
+
+	err = strg.Like().CreateOrUpdate(&repo.Like{UserID: user.ID, PostID: post.ID, Status: true})
+	require.NoError(t, err)
+
+	require.NoError(t, strg.Post().Delete(post.ID))
+	require.ErrorIs(t, strg.Post().Delete(post.ID), sql.ErrNoRows)
+
+	_, err = strg.Post().Get(post.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	comments, err := strg.Comment().GetAll(&repo.GetAllCommentsParams{Limit: 10, Page: 1, PostID: post.ID})
+	require.NoError(t, err)
+	require.Zero(t, comments.Count)
+
+	_, err = strg.Like().Get(user.ID, post.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testComment(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	post := CreatePost(t, strg, user.ID, CreateCategory(t, strg).ID)
+
+	first, err := strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      post.ID,
+		Description: faker.Sentence(),
+	})
+	require.NoError(t, err)
+	require.NotZero(t, first.ID)
+
+	second, err := strg.Comment().Create(&repo.Comment{
+		UserID:      CreateUser(t, strg).ID,
+		PostID:      post.ID,
+		Description: faker.Sentence(),
+	})
+	require.NoError(t, err)
+
+	_, err = strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      -1,
+		Description: faker.Sentence(),
+	})
+	require.Error(t, err)
+
+	result, err := strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:  10,
+		Page:   1,
+		PostID: post.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+	require.Equal(t, second.ID, result.Comments[0].ID)
+	require.Equal(t, first.ID, result.Comments[1].ID)
+
+	result, err = strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:  10,
+		Page:   1,
+		PostID: post.ID,
+		UserID: user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result.Count)
+	require.Equal(t, first.Description, result.Comments[0].Description)
+	require.Equal(t, user.Email, result.Comments[0].User.Email)
+	require.Equal(t, user.FirstName, result.Comments[0].User.FirstName)
+
+	draft := CreatePost(t, strg, user.ID, CreateCategory(t, strg).ID)
+	draft.Status = repo.PostStatusDraft
+	_, err = strg.Post().Update(draft)
+	require.NoError(t, err)
+
+	_, err = strg.Comment().Create(&repo.Comment{
+		UserID:      user.ID,
+		PostID:      draft.ID,
+		Description: faker.Sentence(),
+	})
+	require.NoError(t, err)
+
+	// comments of drafts are listed only to the post author
+	result, err = strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:  10,
+		Page:   1,
+		UserID: user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result.Count)
+
+	result, err = strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:    10,
+		Page:     1,
+		UserID:   user.ID,
+		ViewerID: user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+}
+
+func testCommentThread(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	post := CreatePost(t, strg, user.ID, CreateCategory(t, strg).ID)
+
+	createComment := func(parentID *int64) *repo.Comment {
+		c, err := strg.Comment().Create(&repo.Comment{
+			UserID:      user.ID,
+			PostID:      post.ID,
+			ParentID:    parentID,
+			Description: faker.Sentence(),
+		})
+		require.NoError(t, err)
+		return c
+	}
+
+	root := createComment(nil)
+	reply := createComment(&root.ID)
+	nested := createComment(&reply.ID)
+	leaf := createComment(&root.ID)
+
+	comment, err := strg.Comment().Get(root.ID)
+	require.NoError(t, err)
+	require.Nil(t, comment.ParentID)
+	require.Equal(t, int32(2), comment.RepliesCount)
+	require.Equal(t, user.ID, comment.Post.UserID)
+
+	result, err := strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:    10,
+		Page:     1,
+		PostID:   post.ID,
+		RootOnly: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result.Count)
+	require.Equal(t, root.ID, result.Comments[0].ID)
+
+	result, err = strg.Comment().GetAll(&repo.GetAllCommentsParams{
+		Limit:    10,
+		Page:     1,
+		ParentID: root.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+
+	replies, err := strg.Comment().GetReplies([]int64{root.ID}, 1)
+	require.NoError(t, err)
+	require.Len(t, replies, 2)
+	require.Equal(t, reply.ID, replies[0].ID)
+	require.Equal(t, leaf.ID, replies[1].ID)
+
+	replies, err = strg.Comment().GetReplies([]int64{root.ID}, 2)
+	require.NoError(t, err)
+	require.Len(t, replies, 3)
+
+	reply.Description = faker.Sentence()
+	updated, err := strg.Comment().Update(reply)
+	require.NoError(t, err)
+	require.NotNil(t, updated.UpdatedAt)
+	require.Equal(t, root.ID, *updated.ParentID)
+
+	// a comment with replies is kept as a placeholder
+	require.NoError(t, strg.Comment().Delete(reply.ID))
+
+	comment, err = strg.Comment().Get(reply.ID)
+	require.NoError(t, err)
+	require.NotNil(t, comment.DeletedAt)
+	require.Empty(t, comment.Description)
+	require.Equal(t, int32(1), comment.RepliesCount)
+
+	_, err = strg.Comment().Update(comment)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, strg.Comment().Delete(reply.ID), sql.ErrNoRows)
+
+	// a comment without replies is removed, along with the placeholders
+	// it leaves without replies
+	require.NoError(t, strg.Comment().Delete(nested.ID))
+
+	_, err = strg.Comment().Get(nested.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = strg.Comment().Get(reply.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	comment, err = strg.Comment().Get(root.ID)
+	require.NoError(t, err)
+	require.Nil(t, comment.DeletedAt)
+	require.Equal(t, int32(1), comment.RepliesCount)
+
+	require.NoError(t, strg.Comment().Delete(root.ID))
+	require.NoError(t, strg.Comment().Delete(leaf.ID))
+
+	_, err = strg.Comment().Get(root.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, strg.Post().Delete(post.ID))
+}
+
+func testLike(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	post := CreatePost(t, strg, user.ID, CreateCategory(t, strg).ID)
+
+	_, err := strg.Like().Get(user.ID, post.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	requireCounts := func(likes, dislikes int64) {
+		counts, err := strg.Like().GetLikesDislikesCount(post.ID)
+		require.NoError(t, err)
+		require.Equal(t, likes, counts.LikesCount)
+		require.Equal(t, dislikes, counts.DislikesCount)
+	}
+
+	err = strg.Like().CreateOrUpdate(&repo.Like{UserID: user.ID, PostID: post.ID, Status: true})
+	require.NoError(t, err)
+
+	like, err := strg.Like().Get(user.ID, post.ID)
+	require.NoError(t, err)
+	require.True(t, like.Status)
+	requireCounts(1, 0)
+
+	other := CreateUser(t, strg)
+	err = strg.Like().CreateOrUpdate(&repo.Like{UserID: other.ID, PostID: post.ID, Status: false})
+	require.NoError(t, err)
+	requireCounts(1, 1)
+
+	// the opposite status switches the reaction
+	err = strg.Like().CreateOrUpdate(&repo.Like{UserID: user.ID, PostID: post.ID, Status: false})
+	require.NoError(t, err)
+
+	like, err = strg.Like().Get(user.ID, post.ID)
+	require.NoError(t, err)
+	require.False(t, like.Status)
+	requireCounts(0, 2)
+
+	// the same status again removes it
+	err = strg.Like().CreateOrUpdate(&repo.Like{UserID: user.ID, PostID: post.ID, Status: false})
+	require.NoError(t, err)
+
+	_, err = strg.Like().Get(user.ID, post.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	requireCounts(0, 1)
+}
+
+func testTag(t *testing.T, strg storage.StorageI) {
+	user := CreateUser(t, strg)
+	category := CreateCategory(t, strg)
+
+	common, rare := faker.UUIDDigit(), faker.UUIDDigit()
+
+	createPost := func(tags ...string) *repo.Post {
+		p, err := strg.Post().Create(&repo.Post{
+			Title:       faker.Sentence(),
+			Description: faker.Sentence(),
+			UserID:      user.ID,
+			CategoryID:  category.ID,
+			Tags:        tags,
+		})
+		require.NoError(t, err)
+		return p
+	}
+
+	both := createPost(common, rare)
+	createPost(common)
+	createPost()
+
+	post, err := strg.Post().Get(both.ID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{common, rare}, post.Tags)
+
+	result, err := strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:  10,
+		Page:   1,
+		UserID: user.ID,
+		Tags:   []string{common, rare},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), result.Count)
+
+	result, err = strg.Post().GetAll(&repo.GetAllPostsParams{
+		Limit:        10,
+		Page:         1,
+		UserID:       user.ID,
+		Tags:         []string{common, rare},
+		TagsMatchAll: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result.Count)
+	require.Equal(t, both.ID, result.Posts[0].ID)
+	require.ElementsMatch(t, []string{common, rare}, result.Posts[0].Tags)
+
+	tags, err := strg.Tag().GetAll(&repo.GetAllTagsParams{Limit: 10, Page: 1, Search: common})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), tags.Count)
+	require.Equal(t, common, tags.Tags[0].Name)
+	require.Equal(t, int32(2), tags.Tags[0].PostsCount)
+
+	// updating replaces the tags of the post
+	both.Tags = []string{common}
+	_, err = strg.Post().Update(both)
+	require.NoError(t, err)
+
+	tags, err = strg.Tag().GetAll(&repo.GetAllTagsParams{Limit: 10, Page: 1, Search: rare})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), tags.Count)
+	require.Zero(t, tags.Tags[0].PostsCount)
+
+	require.NoError(t, strg.Post().Delete(both.ID))
+
+	tags, err = strg.Tag().GetAll(&repo.GetAllTagsParams{Limit: 10, Page: 1, Search: common})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), tags.Tags[0].PostsCount)
+
+	// drafts are not counted
+	_, err = strg.Post().Create(&repo.Post{
+		Title:       faker.Sentence(),
+		Description: faker.Sentence(),
+		UserID:      user.ID,
+		CategoryID:  category.ID,
+		Tags:        []string{common},
+		Status:      repo.PostStatusDraft,
+	})
+	require.NoError(t, err)
+
+	tags, err = strg.Tag().GetAll(&repo.GetAllTagsParams{Limit: 10, Page: 1, Search: common})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), tags.Tags[0].PostsCount)
+}
+
+func testTwoFactor(t *testing.T, strg storage.StorageI) {
+	u := CreateUser(t, strg)
+
+	_, err := strg.TwoFactor().Get(u.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, strg.TwoFactor().Disable(u.ID), sql.ErrNoRows)
+
+	tf, err := strg.TwoFactor().Enable(u.ID, "OLDSECRET", []string{"old"})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), tf.RecoveryCodesLeft)
+
+	// enabling again replaces the secret and the recovery codes
+	tf, err = strg.TwoFactor().Enable(u.ID, "SECRET", []string{"hash1", "hash2"})
+	require.NoError(t, err)
+	require.Equal(t, "SECRET", tf.Secret)
+	require.Equal(t, int32(2), tf.RecoveryCodesLeft)
+	require.False(t, tf.EnabledAt.IsZero())
+
+	require.ErrorIs(t, strg.TwoFactor().UseRecoveryCode(u.ID, "old"), sql.ErrNoRows)
+	require.NoError(t, strg.TwoFactor().UseRecoveryCode(u.ID, "hash1"))
+	require.ErrorIs(t, strg.TwoFactor().UseRecoveryCode(u.ID, "hash1"), sql.ErrNoRows)
+
+	tf, err = strg.TwoFactor().Get(u.ID)
+	require.NoError(t, err)
+	require.Equal(t, "SECRET", tf.Secret)
+	require.Equal(t, int32(1), tf.RecoveryCodesLeft)
+
+	require.NoError(t, strg.TwoFactor().Disable(u.ID))
+	_, err = strg.TwoFactor().Get(u.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, strg.TwoFactor().UseRecoveryCode(u.ID, "hash2"), sql.ErrNoRows)
+
+	// deleted users lose their second factor
+	_, err = strg.TwoFactor().Enable(u.ID, "SECRET", []string{"hash"})
+	require.NoError(t, err)
+	require.NoError(t, strg.User().Delete(u.ID, repo.UserDeletePolicyAnonymize))
+	_, err = strg.TwoFactor().Get(u.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testAPIToken(t *testing.T, strg storage.StorageI) {
+	u := CreateUser(t, strg)
+	other := CreateUser(t, strg)
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	first, err := strg.APIToken().Create(&repo.APIToken{
+		UserID:    u.ID,
+		Name:      "ci",
+		Prefix:    "blog_pat_abc",
+		TokenHash: faker.UUIDDigit(),
+		Scopes:    []string{"posts:read", "posts:write"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, first.ID)
+	require.WithinDuration(t, expiresAt, first.ExpiresAt, time.Millisecond)
+	require.Nil(t, first.LastUsedAt)
+
+	second, err := strg.APIToken().Create(&repo.APIToken{
+		UserID:    u.ID,
+		Name:      "backup",
+		Prefix:    "blog_pat_def",
+		TokenHash: faker.UUIDDigit(),
+		Scopes:    []string{"comments:read"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+
+	_, err = strg.APIToken().Create(&repo.APIToken{
+		UserID:    u.ID,
+		Name:      "duplicate",
+		Prefix:    "blog_pat_abc",
+		TokenHash: first.TokenHash,
+		Scopes:    []string{"posts:read"},
+		ExpiresAt: expiresAt,
+	})
+	require.Error(t, err)
+
+	token, err := strg.APIToken().GetByHash(first.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, token.ID)
+	require.Equal(t, []string{"posts:read", "posts:write"}, token.Scopes)
+
+	_, err = strg.APIToken().GetByHash("unknown")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, strg.APIToken().UpdateLastUsed(first.ID, time.Now()))
+	token, err = strg.APIToken().GetByHash(first.TokenHash)
+	require.NoError(t, err)
+	require.NotNil(t, token.LastUsedAt)
+
+	tokens, err := strg.APIToken().GetAll(u.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.Equal(t, second.ID, tokens[0].ID)
+	require.Equal(t, first.ID, tokens[1].ID)
+
+	require.ErrorIs(t, strg.APIToken().Delete(other.ID, first.ID), sql.ErrNoRows)
+	require.NoError(t, strg.APIToken().Delete(u.ID, first.ID))
+	require.ErrorIs(t, strg.APIToken().Delete(u.ID, first.ID), sql.ErrNoRows)
+
+	_, err = strg.APIToken().GetByHash(first.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	third, err := strg.APIToken().Create(&repo.APIToken{
+		UserID:    other.ID,
+		Name:      "other",
+		Prefix:    "blog_pat_ghi",
+		TokenHash: faker.UUIDDigit(),
+		Scopes:    []string{"posts:read"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+
+	// revoking all the tokens of a user keeps the tokens of the others
+	require.NoError(t, strg.APIToken().DeleteAll(u.ID))
+	_, err = strg.APIToken().GetByHash(second.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = strg.APIToken().GetByHash(third.TokenHash)
+	require.NoError(t, err)
+
+	// deleted users lose their tokens
+	require.NoError(t, strg.User().Delete(other.ID, repo.UserDeletePolicyAnonymize))
+	_, err = strg.APIToken().GetByHash(third.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testUserIdentity(t *testing.T, strg storage.StorageI) {
+	u := CreateUser(t, strg)
+	other := CreateUser(t, strg)
+	subject := faker.UUIDDigit()
+
+	first, err := strg.UserIdentity().Create(&repo.UserIdentity{
+		UserID:   u.ID,
+		Provider: "google",
+		Subject:  subject,
+		Email:    u.Email,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, first.ID)
+
+	_, err = strg.UserIdentity().Create(&repo.UserIdentity{
+		UserID:   other.ID,
+		Provider: "google",
+		Subject:  subject,
+		Email:    other.Email,
+	})
+	require.ErrorIs(t, err, repo.ErrIdentityTaken)
+
+	// the same subject of another provider is another account
+	second, err := strg.UserIdentity().Create(&repo.UserIdentity{
+		UserID:   u.ID,
+		Provider: "github",
+		Subject:  subject,
+		Email:    u.Email,
+	})
+	require.NoError(t, err)
+
+	identity, err := strg.UserIdentity().Get("google", subject)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, identity.ID)
+	require.Equal(t, u.ID, identity.UserID)
+
+	_, err = strg.UserIdentity().Get("google", "unknown")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	identities, err := strg.UserIdentity().GetAll(u.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+	require.Equal(t, first.ID, identities[0].ID)
+	require.Equal(t, second.ID, identities[1].ID)
+
+	require.ErrorIs(t, strg.UserIdentity().Delete(other.ID, first.ID), sql.ErrNoRows)
+	require.NoError(t, strg.UserIdentity().Delete(u.ID, first.ID))
+	require.ErrorIs(t, strg.UserIdentity().Delete(u.ID, first.ID), sql.ErrNoRows)
+
+	// deleted users lose their identities
+	require.NoError(t, strg.User().Delete(u.ID, repo.UserDeletePolicyAnonymize))
+	_, err = strg.UserIdentity().Get("github", subject)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testUserIdentityCreateUser(t *testing.T, strg storage.StorageI) {
+	newUser := func(email string) *repo.User {
+		return &repo.User{
+			FirstName: faker.FirstName(),
+			LastName:  faker.LastName(),
+			Email:     email,
+			Type:      repo.UserTypeAuthor,
+		}
+	}
+	address := faker.Email()
+	subject := faker.UUIDDigit()
+
+	u, err := strg.UserIdentity().CreateUser(newUser(address), &repo.UserIdentity{
+		Provider: "google",
+		Subject:  subject,
+		Email:    address,
+	})
+	require.NoError(t, err)
+
+	identity, err := strg.UserIdentity().Get("google", subject)
+	require.NoError(t, err)
+	require.Equal(t, u.ID, identity.UserID)
+
+	_, err = strg.UserIdentity().CreateUser(newUser(address), &repo.UserIdentity{
+		Provider: "github",
+		Subject:  subject,
+		Email:    address,
+	})
+	require.ErrorIs(t, err, repo.ErrEmailTaken)
+
+	// the user isn't created when its identity can't be
+	other := faker.Email()
+	_, err = strg.UserIdentity().CreateUser(newUser(other), &repo.UserIdentity{
+		Provider: "google",
+		Subject:  subject,
+		Email:    other,
+	})
+	require.ErrorIs(t, err, repo.ErrIdentityTaken)
+
+	_, err = strg.User().GetByEmail(other)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testSession(t *testing.T, strg storage.StorageI) {
+	u := CreateUser(t, strg)
+	expiresAt := time.Now().Add(time.Hour)
+
+	first, err := strg.Session().Create(&repo.Session{
+		ID:        uuid.New(),
+		UserID:    u.ID,
+		IP:        "10.0.0.1",
+		UserAgent: "curl/8.0",
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "curl/8.0", first.UserAgent)
+	require.False(t, first.CreatedAt.IsZero())
+	require.WithinDuration(t, expiresAt, first.ExpiresAt, time.Millisecond)
+
+	second, err := strg.Session().Create(&repo.Session{
+		ID:        uuid.New(),
+		UserID:    u.ID,
+		IP:        "10.0.0.2",
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+
+	expired, err := strg.Session().Create(&repo.Session{
+		ID:        uuid.New(),
+		UserID:    u.ID,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	// the first session is seen last
+	seenAt := time.Now().Add(time.Minute)
+	require.NoError(t, strg.Session().UpdateLastSeen(first.ID, "10.0.0.3", seenAt))
+
+	sessions, err := strg.Session().GetAll(u.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, first.ID, sessions[0].ID)
+	require.Equal(t, "10.0.0.3", sessions[0].IP)
+	require.WithinDuration(t, seenAt, sessions[0].LastSeenAt, time.Millisecond)
+	require.Equal(t, second.ID, sessions[1].ID)
+
+	require.NoError(t, strg.Session().Extend(expired.ID, expiresAt))
+	sessions, err = strg.Session().GetAll(u.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+
+	require.NoError(t, strg.Session().Delete(second.ID))
+	_, err = strg.Session().Get(second.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, strg.Session().Delete(second.ID), sql.ErrNoRows)
+	require.ErrorIs(t, strg.Session().UpdateLastSeen(second.ID, "", time.Now()), sql.ErrNoRows)
+	require.ErrorIs(t, strg.Session().Extend(second.ID, expiresAt), sql.ErrNoRows)
+
+	count, err := strg.Session().DeleteAll(u.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	sessions, err = strg.Session().GetAll(u.ID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	// deleted users lose their sessions
+	_, err = strg.Session().Create(&repo.Session{ID: uuid.New(), UserID: u.ID, ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	require.NoError(t, strg.User().Delete(u.ID, repo.UserDeletePolicyAnonymize))
+	sessions, err = strg.Session().GetAll(u.ID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}